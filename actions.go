@@ -1,6 +1,555 @@
 package enthasura
 
-// type ActionBody struct {
-// 	Type string      `json:"type"`
-// 	Args interface{} `json:"args"`
-// }
+import (
+	"encoding"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+)
+
+// actionBaseURL is the template Hasura replaces with the ACTION_BASE_URL environment variable.
+const actionBaseURL = "{{ACTION_BASE_URL}}"
+
+type ActionType string
+
+const (
+	ActionQuery    ActionType = "query"
+	ActionMutation ActionType = "mutation"
+)
+
+type ActionKind string
+
+const (
+	ActionSync  ActionKind = "synchronous"
+	ActionAsync ActionKind = "asynchronous"
+)
+
+// Action is a Hasura action backed by a Go handler. The fields of Input become the arguments of the
+// action and Output its output object, the GraphQL custom types are derived from both structs.
+type Action struct {
+	Name string
+	// Type defaults to ActionMutation and Kind to ActionSync, queries are always synchronous.
+	Type ActionType
+	Kind ActionKind
+	// Handler is the path of the handler, relative to ACTION_BASE_URL, or a full URL.
+	Handler              string
+	Input                interface{}
+	Output               interface{}
+	Roles                []string
+	Comment              string
+	ForwardClientHeaders bool
+	Headers              []EventTriggerHeader
+	Timeout              int
+}
+
+// GraphQLScalar is implemented by Go types declared as custom scalars of the actions.
+type GraphQLScalar interface {
+	GraphQLScalar() string
+}
+
+type CustomTypes struct {
+	InputObjects []*CustomObject `json:"input_objects,omitempty"`
+	Objects      []*CustomObject `json:"objects,omitempty"`
+	Scalars      []*CustomScalar `json:"scalars,omitempty"`
+	Enums        []interface{}   `json:"enums,omitempty"`
+}
+
+type CustomObject struct {
+	Name          string         `json:"name"`
+	Description   string         `json:"description,omitempty"`
+	Fields        []*CustomField `json:"fields"`
+	Relationships []interface{}  `json:"relationships,omitempty"`
+}
+
+type CustomField struct {
+	Name        string `json:"name"`
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+}
+
+type CustomScalar struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+type ActionDefinition struct {
+	Handler              string               `json:"handler"`
+	OutputType           string               `json:"output_type"`
+	Arguments            []*CustomField       `json:"arguments,omitempty"`
+	Type                 ActionType           `json:"type"`
+	Kind                 ActionKind           `json:"kind,omitempty"`
+	Headers              []EventTriggerHeader `json:"headers,omitempty"`
+	ForwardClientHeaders bool                 `json:"forward_client_headers,omitempty"`
+	Timeout              int                  `json:"timeout,omitempty"`
+}
+
+type ActionPermission struct {
+	Role    string `json:"role"`
+	Comment string `json:"comment,omitempty"`
+}
+
+// ActionMetadata is an action as stored in the metadata.
+type ActionMetadata struct {
+	Name        string              `json:"name"`
+	Definition  *ActionDefinition   `json:"definition"`
+	Permissions []*ActionPermission `json:"permissions,omitempty"`
+	Comment     string              `json:"comment,omitempty"`
+}
+
+// ActionArgs are the arguments of create_action and update_action, the types of hasura-api are empty.
+type ActionArgs struct {
+	Name       string            `json:"name"`
+	Definition *ActionDefinition `json:"definition"`
+	Comment    string            `json:"comment,omitempty"`
+}
+
+type ActionPermissionArgs struct {
+	Action  string `json:"action"`
+	Role    string `json:"role"`
+	Comment string `json:"comment,omitempty"`
+}
+
+type DropActionArgs struct {
+	Name string `json:"name"`
+}
+
+func setCustomTypesQuery(types *CustomTypes) metadata.MetadataQuery {
+	return metadata.MetadataQuery{Type: metadata.SetCustomTypes, Args: types}
+}
+
+func createActionQuery(args *ActionArgs) metadata.MetadataQuery {
+	return metadata.MetadataQuery{Type: metadata.CreateAction, Args: args}
+}
+
+func updateActionQuery(args *ActionArgs) metadata.MetadataQuery {
+	return metadata.MetadataQuery{Type: metadata.UpdateAction, Args: args}
+}
+
+func createActionPermissionQuery(args *ActionPermissionArgs) metadata.MetadataQuery {
+	return metadata.MetadataQuery{Type: metadata.CreateActionPermission, Args: args}
+}
+
+// customTypesBuilder derives GraphQL custom types from Go types.
+type customTypesBuilder struct {
+	types *CustomTypes
+	kinds map[string]string
+}
+
+func newCustomTypesBuilder() *customTypesBuilder {
+	return &customTypesBuilder{types: &CustomTypes{}, kinds: map[string]string{}}
+}
+
+var (
+	timeType          = reflect.TypeOf(time.Time{})
+	scalarType        = reflect.TypeOf((*GraphQLScalar)(nil)).Elem()
+	textMarshalerType = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+)
+
+// graphqlType returns the GraphQL type of t, registering the objects and scalars it needs. Pointers
+// and slices are nullable, every other type is non null.
+func (b *customTypesBuilder) graphqlType(t reflect.Type, input bool) (string, error) {
+	// the scalar and text checks below take the element type, a *Money is a nullable Money
+	if t.Kind() == reflect.Ptr {
+		name, err := b.graphqlType(t.Elem(), input)
+		return strings.TrimSuffix(name, "!"), err
+	}
+
+	if t.Implements(scalarType) || reflect.PtrTo(t).Implements(scalarType) {
+		name := reflect.New(t).Interface().(GraphQLScalar).GraphQLScalar()
+		if err := b.register(name, "scalar"); err != nil {
+			return "", errors.WithStack(err)
+		}
+
+		return name + "!", nil
+	}
+
+	// IDs like uuid.UUID or pulid.ID are sent as text, 16 byte arrays are UUIDs.
+	if t != timeType && t.Implements(textMarshalerType) {
+		if t.Kind() == reflect.Array && t.Len() == 16 && t.Elem().Kind() == reflect.Uint8 {
+			return "uuid!", nil
+		}
+
+		return "String!", nil
+	}
+
+	switch t.Kind() {
+	case reflect.Slice, reflect.Array:
+		name, err := b.graphqlType(t.Elem(), input)
+		return "[" + name + "]", err
+	case reflect.String:
+		return "String!", nil
+	case reflect.Bool:
+		return "Boolean!", nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "Int!", nil
+	case reflect.Float32, reflect.Float64:
+		return "Float!", nil
+	case reflect.Map, reflect.Interface:
+		return "jsonb!", nil
+	case reflect.Struct:
+		if t == timeType {
+			return "timestamptz!", nil
+		}
+
+		name, err := b.object(t, input)
+		return name + "!", err
+	}
+
+	return "", errors.Errorf("unsupported type %s", t)
+}
+
+func (b *customTypesBuilder) register(name, kind string) error {
+	if current, isOk := b.kinds[name]; isOk && current != kind {
+		return errors.Errorf("%s is used as %s and %s", name, current, kind)
+	}
+
+	if _, isOk := b.kinds[name]; !isOk && kind == "scalar" {
+		b.types.Scalars = append(b.types.Scalars, &CustomScalar{Name: name})
+	}
+
+	b.kinds[name] = kind
+
+	return nil
+}
+
+// object registers a struct as an input object or an object and returns its name.
+func (b *customTypesBuilder) object(t reflect.Type, input bool) (string, error) {
+	if t.Name() == "" {
+		return "", errors.Errorf("anonymous struct %s can not be a custom type", t)
+	}
+
+	kind := "object"
+	if input {
+		kind = "input object"
+	}
+
+	if _, isOk := b.kinds[t.Name()]; isOk {
+		return t.Name(), b.register(t.Name(), kind)
+	}
+
+	if err := b.register(t.Name(), kind); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	object := &CustomObject{Name: t.Name()}
+	if input {
+		b.types.InputObjects = append(b.types.InputObjects, object)
+	} else {
+		b.types.Objects = append(b.types.Objects, object)
+	}
+
+	fields, err := b.fields(t, input)
+	if err != nil {
+		return "", errors.Wrapf(err, "in %s", t.Name())
+	}
+
+	object.Fields = fields
+
+	return t.Name(), nil
+}
+
+// fields returns the fields of a struct, named as encoding/json would.
+func (b *customTypesBuilder) fields(t reflect.Type, input bool) ([]*CustomField, error) {
+	fields := []*CustomField{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" && !field.Anonymous {
+			continue
+		}
+
+		name := field.Name
+		if tag := strings.Split(field.Tag.Get("json"), ",")[0]; tag == "-" {
+			continue
+		} else if tag != "" {
+			name = tag
+		}
+
+		if field.Anonymous && field.Type.Kind() == reflect.Struct && field.Tag.Get("json") == "" {
+			embedded, err := b.fields(field.Type, input)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			fields = append(fields, embedded...)
+			continue
+		}
+
+		fieldType, err := b.graphqlType(field.Type, input)
+		if err != nil {
+			return nil, errors.Wrapf(err, "field %s", field.Name)
+		}
+
+		fields = append(fields, &CustomField{Name: name, Type: fieldType})
+	}
+
+	return fields, nil
+}
+
+func structType(value interface{}) reflect.Type {
+	if value == nil {
+		return nil
+	}
+
+	t := reflect.TypeOf(value)
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	return t
+}
+
+// actionHandler prefixes relative handler paths with ACTION_BASE_URL.
+func actionHandler(handler string) string {
+	if strings.Contains(handler, "://") || strings.HasPrefix(handler, "{{") {
+		return handler
+	}
+
+	return actionBaseURL + "/" + strings.TrimPrefix(handler, "/")
+}
+
+// actionsMetadata derives the custom types and the metadata of every action.
+func actionsMetadata(actions []*Action) (*CustomTypes, []*ActionMetadata, error) {
+	builder := newCustomTypesBuilder()
+	result := []*ActionMetadata{}
+
+	for _, action := range actions {
+		if action.Name == "" {
+			return nil, nil, errors.New("action without name")
+		}
+
+		actionType, kind := action.Type, action.Kind
+		if actionType == "" {
+			actionType = ActionMutation
+		}
+
+		if kind == "" {
+			kind = ActionSync
+		}
+
+		if actionType == ActionQuery && kind == ActionAsync {
+			return nil, nil, errors.Errorf("action %s: queries can not be asynchronous", action.Name)
+		}
+
+		output := structType(action.Output)
+		if output == nil || output.Kind() != reflect.Struct {
+			return nil, nil, errors.Errorf("action %s: output must be a struct", action.Name)
+		}
+
+		outputType, err := builder.graphqlType(output, false)
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "action %s", action.Name)
+		}
+
+		definition := &ActionDefinition{
+			Handler:              actionHandler(action.Handler),
+			OutputType:           outputType,
+			Type:                 actionType,
+			Headers:              action.Headers,
+			ForwardClientHeaders: action.ForwardClientHeaders,
+			Timeout:              action.Timeout,
+		}
+
+		if actionType == ActionMutation {
+			definition.Kind = kind
+		}
+
+		if input := structType(action.Input); input != nil {
+			if input.Kind() != reflect.Struct {
+				return nil, nil, errors.Errorf("action %s: input must be a struct", action.Name)
+			}
+
+			definition.Arguments, err = builder.fields(input, true)
+			if err != nil {
+				return nil, nil, errors.Wrapf(err, "action %s", action.Name)
+			}
+		}
+
+		actionMetadata := &ActionMetadata{Name: action.Name, Definition: definition, Comment: action.Comment}
+		for _, role := range action.Roles {
+			actionMetadata.Permissions = append(actionMetadata.Permissions, &ActionPermission{Role: role})
+		}
+
+		result = append(result, actionMetadata)
+	}
+
+	return builder.types, result, nil
+}
+
+// actionPhases returns the queries registering the actions on a server without actions nor custom
+// types, for BuildQueries which has no current metadata to merge with.
+func actionPhases(actions []*Action) ([]*PlanPhase, error) {
+	return reconcileActionPhases(&Metadata{}, actions)
+}
+
+// reconcileActionPhases returns the queries needed to register the actions on a server with the
+// current metadata. Custom types and actions not derived from the Go types are kept.
+func reconcileActionPhases(current *Metadata, actions []*Action) ([]*PlanPhase, error) {
+	if len(actions) == 0 {
+		return nil, nil
+	}
+
+	types, actionsMeta, err := actionsMetadata(actions)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	customTypes := []metadata.MetadataQuery{}
+	if merged := mergeCustomTypes(current.CustomTypes, types); !sameJSON(current.CustomTypes, merged) {
+		customTypes = append(customTypes, setCustomTypesQuery(merged))
+	}
+
+	creates := []metadata.MetadataQuery{}
+	permissions := []metadata.MetadataQuery{}
+
+	for _, action := range actionsMeta {
+		args := &ActionArgs{Name: action.Name, Definition: action.Definition, Comment: action.Comment}
+
+		existing := findAction(current.Actions, action.Name)
+		switch {
+		case existing == nil:
+			creates = append(creates, createActionQuery(args))
+		case !sameJSON(existing.Definition, action.Definition):
+			creates = append(creates, updateActionQuery(args))
+		}
+
+		for _, perm := range action.Permissions {
+			if existing == nil || findActionPermission(existing.Permissions, perm.Role) == nil {
+				permissions = append(permissions, createActionPermissionQuery(&ActionPermissionArgs{Action: action.Name, Role: perm.Role}))
+			}
+		}
+	}
+
+	return []*PlanPhase{
+		{Name: "custom types", Queries: customTypes},
+		{Name: "actions", Queries: creates},
+		{Name: "action permissions", Queries: permissions},
+	}, nil
+}
+
+// mergeCustomTypes returns the current custom types with the generated ones added or replaced by name.
+func mergeCustomTypes(current, generated *CustomTypes) *CustomTypes {
+	merged := &CustomTypes{}
+	if current != nil {
+		merged.InputObjects = append(merged.InputObjects, current.InputObjects...)
+		merged.Objects = append(merged.Objects, current.Objects...)
+		merged.Scalars = append(merged.Scalars, current.Scalars...)
+		merged.Enums = current.Enums
+	}
+
+	merged.InputObjects = mergeCustomObjects(merged.InputObjects, generated.InputObjects)
+	merged.Objects = mergeCustomObjects(merged.Objects, generated.Objects)
+
+	for _, scalar := range generated.Scalars {
+		found := false
+		for _, s := range merged.Scalars {
+			found = found || s.Name == scalar.Name
+		}
+
+		if !found {
+			merged.Scalars = append(merged.Scalars, scalar)
+		}
+	}
+
+	return merged
+}
+
+func mergeCustomObjects(objects, generated []*CustomObject) []*CustomObject {
+	for _, object := range generated {
+		replaced := false
+		for i, o := range objects {
+			if o.Name == object.Name {
+				objects[i], replaced = object, true
+			}
+		}
+
+		if !replaced {
+			objects = append(objects, object)
+		}
+	}
+
+	return objects
+}
+
+// addActionsMetadata stores the actions and their custom types in the metadata, replacing the ones
+// with the same names.
+func addActionsMetadata(m *Metadata, actions []*Action) error {
+	if len(actions) == 0 {
+		return nil
+	}
+
+	types, actionsMeta, err := actionsMetadata(actions)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	m.CustomTypes = mergeCustomTypes(m.CustomTypes, types)
+
+	for _, action := range actionsMeta {
+		m.Actions = setAction(m.Actions, action)
+	}
+
+	return nil
+}
+
+// setAction replaces the action with the same name or appends it. Actions are kept as interface{}
+// values so unknown fields of hand-made actions survive a round trip.
+func setAction(actions []interface{}, action *ActionMetadata) []interface{} {
+	for i, a := range actions {
+		if actionName(a) == action.Name {
+			actions[i] = action
+			return actions
+		}
+	}
+
+	return append(actions, action)
+}
+
+func actionName(action interface{}) string {
+	switch a := action.(type) {
+	case *ActionMetadata:
+		return a.Name
+	case map[string]interface{}:
+		name, _ := a["name"].(string)
+		return name
+	}
+
+	return ""
+}
+
+func findAction(actions []interface{}, name string) *ActionMetadata {
+	for _, a := range actions {
+		if actionName(a) != name {
+			continue
+		}
+
+		data, err := json.Marshal(a)
+		if err != nil {
+			return nil
+		}
+
+		action := &ActionMetadata{}
+		if err := json.Unmarshal(data, action); err != nil {
+			return nil
+		}
+
+		return action
+	}
+
+	return nil
+}
+
+func findActionPermission(perms []*ActionPermission, role string) *ActionPermission {
+	for _, perm := range perms {
+		if perm.Role == role {
+			return perm
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package actions
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Error is returned to Hasura as {"message": ..., "extensions": ...}, the message and extensions
+// reach the GraphQL client.
+type Error struct {
+	StatusCode int                    `json:"-"`
+	Message    string                 `json:"message"`
+	Extensions map[string]interface{} `json:"extensions,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// NewError returns an error with a code extension, sent with status 400.
+func NewError(message, code string) *Error {
+	return &Error{
+		Message:    message,
+		Extensions: map[string]interface{}{"code": code},
+	}
+}
+
+// internalError is sent in place of errors other than *Error, whose message may expose internals.
+var internalError = &Error{
+	StatusCode: http.StatusInternalServerError,
+	Message:    "internal error",
+	Extensions: map[string]interface{}{"code": "internal-error"},
+}
+
+// WriteError writes err in the format expected by Hasura. Errors other than *Error are logged and
+// sent as a generic internal error with status 500.
+func WriteError(w http.ResponseWriter, err error) {
+	actionErr := &Error{}
+	if !errors.As(err, &actionErr) {
+		logrus.Errorf("action failed: %+v", err)
+		actionErr = internalError
+	}
+
+	status := actionErr.StatusCode
+	if status == 0 {
+		status = http.StatusBadRequest
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(actionErr); err != nil {
+		logrus.Error(err)
+	}
+}
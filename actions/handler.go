@@ -0,0 +1,200 @@
+// Package actions serves the webhooks of Hasura actions, routing every call by action name to a
+// typed Go function.
+package actions
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// Session holds the session variables Hasura sends with every action call.
+type Session struct {
+	Role      string
+	UserID    string
+	Variables map[string]string
+}
+
+// Get returns a session variable, names are case insensitive.
+func (s Session) Get(name string) string {
+	return s.Variables[strings.ToLower(name)]
+}
+
+func newSession(variables map[string]string) Session {
+	session := Session{Variables: map[string]string{}}
+
+	for name, value := range variables {
+		session.Variables[strings.ToLower(name)] = value
+	}
+
+	session.Role = session.Variables["x-hasura-role"]
+	session.UserID = session.Variables["x-hasura-user-id"]
+
+	return session
+}
+
+// Payload is the body Hasura posts to the handler of an action.
+type Payload struct {
+	Action struct {
+		Name string `json:"name"`
+	} `json:"action"`
+	Input            json.RawMessage   `json:"input"`
+	SessionVariables map[string]string `json:"session_variables"`
+	RequestQuery     string            `json:"request_query,omitempty"`
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	sessionType = reflect.TypeOf(Session{})
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+// Handler is an http.Handler calling the function registered for the action of every request.
+type Handler struct {
+	client interface{}
+
+	mu      sync.RWMutex
+	actions map[string]reflect.Value
+}
+
+// NewHandler returns a handler passing client (usually an *ent.Client) to every action.
+func NewHandler(client interface{}) *Handler {
+	return &Handler{
+		client:  client,
+		actions: map[string]reflect.Value{},
+	}
+}
+
+// Handle registers the function of an action. The function must look like
+//
+//	func(ctx context.Context, input SignupInput, session actions.Session, client *ent.Client) (*SignupOutput, error)
+//
+// where the input can also be a pointer and the client any type the client of the handler is
+// assignable to.
+func (h *Handler) Handle(name string, fn interface{}) error {
+	if fn == nil {
+		return errors.Errorf("action %s: expected a function, got nil", name)
+	}
+
+	value := reflect.ValueOf(fn)
+	if err := h.checkSignature(value.Type()); err != nil {
+		return errors.Wrapf(err, "action %s", name)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.actions[name] = value
+
+	return nil
+}
+
+// MustHandle is like Handle but panics if the function has an invalid signature.
+func (h *Handler) MustHandle(name string, fn interface{}) *Handler {
+	if err := h.Handle(name, fn); err != nil {
+		panic(err)
+	}
+
+	return h
+}
+
+func (h *Handler) checkSignature(t reflect.Type) error {
+	if t.Kind() != reflect.Func {
+		return errors.Errorf("expected a function, got %s", t)
+	}
+
+	if t.NumIn() != 4 || t.NumOut() != 2 {
+		return errors.Errorf("expected func(context.Context, Input, actions.Session, Client) (Output, error), got %s", t)
+	}
+
+	if t.In(0) != contextType {
+		return errors.Errorf("first argument must be a context.Context, got %s", t.In(0))
+	}
+
+	if t.In(2) != sessionType {
+		return errors.Errorf("third argument must be an actions.Session, got %s", t.In(2))
+	}
+
+	if h.client == nil || !reflect.TypeOf(h.client).AssignableTo(t.In(3)) {
+		return errors.Errorf("the client of the handler (%T) is not assignable to %s", h.client, t.In(3))
+	}
+
+	if !t.Out(1).Implements(errorType) {
+		return errors.Errorf("second result must be an error, got %s", t.Out(1))
+	}
+
+	return nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		WriteError(w, &Error{StatusCode: http.StatusMethodNotAllowed, Message: "only POST requests are accepted"})
+		return
+	}
+
+	payload := &Payload{}
+	if err := json.NewDecoder(r.Body).Decode(payload); err != nil {
+		WriteError(w, &Error{Message: "invalid action payload", Extensions: map[string]interface{}{"code": "invalid-payload"}})
+		return
+	}
+
+	h.mu.RLock()
+	fn, isOk := h.actions[payload.Action.Name]
+	h.mu.RUnlock()
+
+	if !isOk {
+		WriteError(w, &Error{
+			StatusCode: http.StatusNotFound,
+			Message:    "action " + payload.Action.Name + " is not handled",
+			Extensions: map[string]interface{}{"code": "not-found"},
+		})
+		return
+	}
+
+	output, err := h.call(r.Context(), fn, payload)
+	if err != nil {
+		logrus.WithField("action", payload.Action.Name).Debug(err)
+		WriteError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(output); err != nil {
+		logrus.WithField("action", payload.Action.Name).Error(err)
+	}
+}
+
+func (h *Handler) call(ctx context.Context, fn reflect.Value, payload *Payload) (interface{}, error) {
+	inputType := fn.Type().In(1)
+
+	input := reflect.New(inputType)
+	if inputType.Kind() == reflect.Ptr {
+		input.Elem().Set(reflect.New(inputType.Elem()))
+	}
+
+	if len(payload.Input) > 0 {
+		if err := json.Unmarshal(payload.Input, input.Interface()); err != nil {
+			return nil, &Error{Message: "invalid input: " + err.Error(), Extensions: map[string]interface{}{"code": "invalid-input"}}
+		}
+	}
+
+	results := fn.Call([]reflect.Value{
+		reflect.ValueOf(ctx),
+		input.Elem(),
+		reflect.ValueOf(newSession(payload.SessionVariables)),
+		reflect.ValueOf(h.client),
+	})
+
+	if err, isOk := results[1].Interface().(error); isOk && err != nil {
+		return nil, err
+	}
+
+	return results[0].Interface(), nil
+}
@@ -0,0 +1,204 @@
+package actions_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minskylab/ent-hasura/actions"
+)
+
+type store struct {
+	users map[string]int
+}
+
+type SignupInput struct {
+	Email string `json:"email"`
+}
+
+type SignupOutput struct {
+	ID     int    `json:"id"`
+	Role   string `json:"role"`
+	UserID string `json:"user_id"`
+	Org    string `json:"org"`
+}
+
+func signup(ctx context.Context, input *SignupInput, session actions.Session, client *store) (*SignupOutput, error) {
+	if input.Email == "" {
+		return nil, actions.NewError("email is required", "invalid-email")
+	}
+
+	id, isOk := client.users[input.Email]
+	if !isOk {
+		return nil, fmt.Errorf("pq: relation %q does not exist", "users")
+	}
+
+	return &SignupOutput{ID: id, Role: session.Role, UserID: session.UserID, Org: session.Get("X-Hasura-Org-Id")}, nil
+}
+
+func ping(ctx context.Context, input struct{}, session actions.Session, client *store) (string, error) {
+	return "pong", nil
+}
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+
+	handler := actions.NewHandler(&store{users: map[string]int{"ada@example.com": 1}}).
+		MustHandle("signup", signup).
+		MustHandle("ping", ping)
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func post(t *testing.T, server *httptest.Server, body string) (int, map[string]interface{}) {
+	t.Helper()
+
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	decoded := map[string]interface{}{}
+	if err := json.NewDecoder(res.Body).Decode(&decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	return res.StatusCode, decoded
+}
+
+func TestHandlerRoutesActions(t *testing.T) {
+	server := newServer(t)
+
+	status, body := post(t, server, `{
+		"action": {"name": "signup"},
+		"input": {"email": "ada@example.com"},
+		"session_variables": {"x-hasura-role": "user", "X-Hasura-User-Id": "7", "x-hasura-org-id": "acme"}
+	}`)
+
+	if status != http.StatusOK {
+		t.Fatalf("status: got %d, want %d: %v", status, http.StatusOK, body)
+	}
+
+	want := map[string]interface{}{"id": float64(1), "role": "user", "user_id": "7", "org": "acme"}
+	for key, value := range want {
+		if body[key] != value {
+			t.Errorf("%s: got %v, want %v", key, body[key], value)
+		}
+	}
+}
+
+func TestHandlerErrors(t *testing.T) {
+	server := newServer(t)
+
+	tests := []struct {
+		name    string
+		body    string
+		status  int
+		message string
+		code    string
+	}{
+		{
+			name:    "typed error",
+			body:    `{"action": {"name": "signup"}, "input": {"email": ""}}`,
+			status:  http.StatusBadRequest,
+			message: "email is required",
+			code:    "invalid-email",
+		},
+		{
+			name:    "internal error",
+			body:    `{"action": {"name": "signup"}, "input": {"email": "bob@example.com"}}`,
+			status:  http.StatusInternalServerError,
+			message: "internal error",
+			code:    "internal-error",
+		},
+		{
+			name:    "unknown action",
+			body:    `{"action": {"name": "login"}, "input": {}}`,
+			status:  http.StatusNotFound,
+			message: "action login is not handled",
+			code:    "not-found",
+		},
+		{
+			name:   "invalid input",
+			body:   `{"action": {"name": "signup"}, "input": {"email": 1}}`,
+			status: http.StatusBadRequest,
+			code:   "invalid-input",
+		},
+		{
+			name:    "invalid payload",
+			body:    `{"action": `,
+			status:  http.StatusBadRequest,
+			message: "invalid action payload",
+			code:    "invalid-payload",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			status, body := post(t, server, test.body)
+
+			if status != test.status {
+				t.Errorf("status: got %d, want %d", status, test.status)
+			}
+
+			if test.message != "" && body["message"] != test.message {
+				t.Errorf("message: got %v, want %q", body["message"], test.message)
+			}
+
+			extensions, _ := body["extensions"].(map[string]interface{})
+			if extensions["code"] != test.code {
+				t.Errorf("code: got %v, want %q", extensions["code"], test.code)
+			}
+		})
+	}
+}
+
+func TestHandlerValueInput(t *testing.T) {
+	server := newServer(t)
+
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(`{"action": {"name": "ping"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	var output string
+	if err := json.NewDecoder(res.Body).Decode(&output); err != nil {
+		t.Fatal(err)
+	}
+
+	if output != "pong" {
+		t.Errorf("got %q, want %q", output, "pong")
+	}
+}
+
+func TestHandleInvalidFunctions(t *testing.T) {
+	handler := actions.NewHandler(&store{})
+
+	tests := []struct {
+		name string
+		fn   interface{}
+	}{
+		{name: "nil", fn: nil},
+		{name: "not a function", fn: "signup"},
+		{name: "missing session", fn: func(context.Context, SignupInput, *store) (*SignupOutput, error) { return nil, nil }},
+		{name: "wrong client", fn: func(context.Context, SignupInput, actions.Session, string) (*SignupOutput, error) { return nil, nil }},
+		{name: "no error", fn: func(context.Context, SignupInput, actions.Session, *store) (*SignupOutput, string) { return nil, "" }},
+	}
+
+	for _, test := range tests {
+		if err := handler.Handle("signup", test.fn); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
@@ -0,0 +1,165 @@
+package enthasura_test
+
+import (
+	"sort"
+	"testing"
+
+	enthasura "github.com/minskylab/ent-hasura"
+	"github.com/minskylab/ent-hasura/hasuratest"
+	"github.com/minskylab/hasura-api/metadata"
+)
+
+type LoginInput struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type LoginOutput struct {
+	Token string `json:"token"`
+}
+
+type SignupInput struct {
+	Email string `json:"email"`
+}
+
+type SignupOutput struct {
+	ID int `json:"id"`
+}
+
+var (
+	loginAction  = &enthasura.Action{Name: "login", Handler: "/login", Input: LoginInput{}, Output: LoginOutput{}, Roles: []string{"anonymous"}}
+	signupAction = &enthasura.Action{Name: "signup", Handler: "/signup", Input: SignupInput{}, Output: SignupOutput{}}
+)
+
+func TestRegisterActionsTwice(t *testing.T) {
+	client := hasuratest.NewMetadataClient()
+	run := enthasura.NewRuntimeWithClient(client)
+
+	// a hand-made action with its own custom type, unknown to the runtime
+	handMade := []metadata.MetadataQuery{
+		{Type: metadata.SetCustomTypes, Args: &enthasura.CustomTypes{Objects: []*enthasura.CustomObject{
+			{Name: "Report", Fields: []*enthasura.CustomField{{Name: "url", Type: "String!"}}},
+		}}},
+		{Type: metadata.CreateAction, Args: &enthasura.ActionArgs{Name: "report", Definition: &enthasura.ActionDefinition{
+			Handler: "https://reports.example.com", OutputType: "Report", Type: enthasura.ActionQuery,
+		}}},
+	}
+
+	if _, err := client.Bulk(handMade); err != nil {
+		t.Fatal(err)
+	}
+
+	run.SetActions(loginAction)
+	if err := run.RegisterActions(); err != nil {
+		t.Fatalf("registering the actions: %+v", err)
+	}
+
+	run.SetActions(loginAction, signupAction)
+	if err := run.RegisterActions(); err != nil {
+		t.Fatalf("registering the actions again: %+v", err)
+	}
+
+	exported, err := client.ExportMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := actionNames(t, exported.Metadata.Actions), []string{"login", "report", "signup"}; !equalStrings(got, want) {
+		t.Errorf("actions: got %v, want %v", got, want)
+	}
+
+	objects := []string{}
+	for _, object := range exported.Metadata.CustomTypes.Objects {
+		objects = append(objects, object.Name)
+	}
+
+	sort.Strings(objects)
+
+	if want := []string{"LoginOutput", "Report", "SignupOutput"}; !equalStrings(objects, want) {
+		t.Errorf("custom objects: got %v, want %v", objects, want)
+	}
+
+	applied := len(client.Queries())
+
+	if err := run.RegisterActions(); err != nil {
+		t.Fatalf("registering unchanged actions: %+v", err)
+	}
+
+	if queries := client.Queries()[applied:]; len(queries) != 0 {
+		t.Errorf("registering unchanged actions sent %d queries: %v", len(queries), queries)
+	}
+}
+
+// Money is a custom scalar, PriceInput and PriceOutput use it nullable and non null.
+type Money int64
+
+func (Money) GraphQLScalar() string {
+	return "Money"
+}
+
+type PriceInput struct {
+	Amount   Money  `json:"amount"`
+	Discount *Money `json:"discount"`
+}
+
+type PriceOutput struct {
+	Total    Money  `json:"total"`
+	Discount *Money `json:"discount"`
+}
+
+func TestActionNullableScalars(t *testing.T) {
+	price := &enthasura.Action{Name: "price", Handler: "/price", Type: enthasura.ActionQuery, Input: PriceInput{}, Output: PriceOutput{}}
+
+	m, err := enthasura.BuildMetadata(basicGraph(t), enthasura.WithActions(price))
+	if err != nil {
+		t.Fatalf("building metadata: %+v", err)
+	}
+
+	assertSameJSON(t, m.CustomTypes, &enthasura.CustomTypes{
+		Objects: []*enthasura.CustomObject{{Name: "PriceOutput", Fields: []*enthasura.CustomField{
+			{Name: "total", Type: "Money!"},
+			{Name: "discount", Type: "Money"},
+		}}},
+		Scalars: []*enthasura.CustomScalar{{Name: "Money"}},
+	})
+
+	action := m.Actions[0].(*enthasura.ActionMetadata)
+	assertSameJSON(t, action.Definition.Arguments, []*enthasura.CustomField{
+		{Name: "amount", Type: "Money!"},
+		{Name: "discount", Type: "Money"},
+	})
+}
+
+func actionNames(t *testing.T, actions []interface{}) []string {
+	t.Helper()
+
+	names := []string{}
+
+	for _, action := range actions {
+		named, isOk := action.(map[string]interface{})
+		if !isOk {
+			t.Fatalf("unexpected action: %#v", action)
+		}
+
+		name, _ := named["name"].(string)
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
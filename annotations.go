@@ -1,18 +1,20 @@
 package enthasura
 
 import (
+	"entgo.io/ent/schema"
 	"github.com/minskylab/hasura-api/metadata"
 )
 
 const (
-	// hasuraPermissionsAnnotationName     = "hasura-permissions"
+	hasuraPermissionsAnnotationName     = "hasura-permissions"
 	hasuraPermissionsRoleAnnotationName = "hasura-permissions-role"
 	// hasuraNotInheritedAnnotationName    = "hasura-not-inherited"
 )
 
+// M is a boolean expression, see boolexp.go for a typed builder.
 type M map[string]interface{}
 
-func Eq(val string) M {
+func Eq(val interface{}) M {
 	return M{
 		"_eq": val,
 	}
@@ -28,24 +30,74 @@ type A []string
 // 	DeletePermission *PermissionDeleteAnnotation `json:"delete_permission,omitempty"`
 // }
 
+// PermissionsRoleAnnotation declares the permissions of a role. AllColumns is expanded to the columns
+// of the node without its sensitive fields on select and its immutable fields on update, unless
+// KeepAllColumns is set. Columns hidden from the role or preset with ColumnAnnotation are always left
+// out, expanding AllColumns even with KeepAllColumns.
 type PermissionsRoleAnnotation struct {
 	Role             string            `json:"role"`
 	InsertPermission *InsertPermission `json:"insert_permission,omitempty"`
 	SelectPermission *SelectPermission `json:"select_permission,omitempty"`
 	UpdatePermission *UpdatePermission `json:"update_permission,omitempty"`
 	DeletePermission *DeletePermission `json:"delete_permission,omitempty"`
+	KeepAllColumns   bool              `json:"keep_all_columns,omitempty"`
+}
+
+// PermissionsAnnotation holds the permissions of several roles for the same node.
+type PermissionsAnnotation struct {
+	Roles []PermissionsRoleAnnotation `json:"roles"`
+}
+
+// Permissions declares the permissions of every given role on the node.
+func Permissions(roles ...PermissionsRoleAnnotation) PermissionsAnnotation {
+	return PermissionsAnnotation{Roles: roles}
 }
 
 type NotInheritedPermissionsAnnotation struct{}
 
-// func (PermissionsAnnotation) Name() string {
-// 	return hasuraPermissionsAnnotationName
-// }
+func (PermissionsAnnotation) Name() string {
+	return hasuraPermissionsAnnotationName
+}
+
+// Merge implements the schema.Merger interface, roles of both annotations are kept.
+func (a PermissionsAnnotation) Merge(other schema.Annotation) schema.Annotation {
+	roles := append([]PermissionsRoleAnnotation{}, a.Roles...)
+
+	switch other := other.(type) {
+	case PermissionsAnnotation:
+		roles = append(roles, other.Roles...)
+	case *PermissionsAnnotation:
+		if other != nil {
+			roles = append(roles, other.Roles...)
+		}
+	case PermissionsRoleAnnotation:
+		roles = append(roles, other)
+	case *PermissionsRoleAnnotation:
+		if other != nil {
+			roles = append(roles, *other)
+		}
+	}
+
+	return PermissionsAnnotation{Roles: roles}
+}
 
 func (PermissionsRoleAnnotation) Name() string {
 	return hasuraPermissionsRoleAnnotationName
 }
 
+// Merge implements the schema.Merger interface, so a node can be annotated with several
+// PermissionsRoleAnnotation values, one per role.
+func (a PermissionsRoleAnnotation) Merge(other schema.Annotation) schema.Annotation {
+	return Permissions(a).Merge(other)
+}
+
+var (
+	_ schema.Annotation = (*PermissionsAnnotation)(nil)
+	_ schema.Merger     = (*PermissionsAnnotation)(nil)
+	_ schema.Annotation = (*PermissionsRoleAnnotation)(nil)
+	_ schema.Merger     = (*PermissionsRoleAnnotation)(nil)
+)
+
 // func (NotInheritedPermissionsAnnotation) Name() string {
 // 	return hasuraNotInheritedAnnotationName
 // }
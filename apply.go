@@ -1,12 +1,11 @@
 package enthasura
 
 import (
+	"encoding/json"
 	"strings"
 
 	"entgo.io/ent/entc"
 	"entgo.io/ent/entc/gen"
-	"github.com/iancoleman/strcase"
-	"github.com/minskylab/hasura-api/metadata"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
 )
@@ -17,6 +16,20 @@ func (r *Runtime) PerformFullMetadataTransform(entSchemaPath string, sourceName,
 		return errors.WithStack(err)
 	}
 
+	return r.PerformFullGraphTransform(graph, sourceName, schemaName)
+}
+
+// PerformFullGraphTransform is PerformFullMetadataTransform for an already loaded graph.
+func (r *Runtime) PerformFullGraphTransform(graph *gen.Graph, sourceName, schemaName string) error {
+	if err := validateGraph(graph, schemaName, r.naming); err != nil {
+		return err
+	}
+
+	before, err := r.metadataBeforeApply()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
 	logrus.Info("[1] Prelude, untracking tables or cleaning metadata")
 	if err := r.PerformPrelude(graph, sourceName, schemaName, false); err != nil {
 		return errors.WithMessage(err, "error at prelude")
@@ -37,15 +50,23 @@ func (r *Runtime) PerformFullMetadataTransform(entSchemaPath string, sourceName,
 		return errors.WithMessage(err, "error at permissions for all tables")
 	}
 
-	return nil
-}
+	logrus.Info("[5] Creating the event triggers of your Ent Schema")
+	if err := r.EventTriggersForAllTables(graph, sourceName, schemaName); err != nil {
+		return errors.WithMessage(err, "error at event triggers for all tables")
+	}
 
-func (r *Runtime) PerformPrelude(graph *gen.Graph, sourceName, schemaName string, clearMetadata bool) error {
-	allTables, err := graph.Tables()
-	if err != nil {
-		return errors.WithStack(err)
+	if len(r.actions) > 0 {
+		logrus.Info("[6] Registering actions and their custom types")
+		if err := r.RegisterActions(); err != nil {
+			return errors.WithMessage(err, "error at register actions")
+		}
 	}
 
+	logrus.Info("[7] Checking the consistency of the applied metadata")
+	return r.checkConsistency(graph, schemaName, before)
+}
+
+func (r *Runtime) PerformPrelude(graph *gen.Graph, sourceName, schemaName string, clearMetadata bool) error {
 	if clearMetadata {
 		if err := r.clearMetadata(); err != nil {
 			return errors.WithStack(err)
@@ -54,428 +75,130 @@ func (r *Runtime) PerformPrelude(graph *gen.Graph, sourceName, schemaName string
 		return nil
 	}
 
-	untrackBatch := []metadata.MetadataQuery{}
-	for _, table := range allTables {
-		untrackBatch = append(untrackBatch, metadata.PgUntrackTableQuery(&metadata.PgUntrackTableArgs{
-			Table: metadata.QualifiedTableName{
-				Name:   table.Name,
-				Schema: schemaName,
-			},
-			Cascade: true,
-			Source:  sourceName,
-		}))
-	}
-
-	res, err := r.hasura.Metadata.Bulk(untrackBatch)
+	phases, err := preludePhases(graph, sourceName, schemaName)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	return logAndResponseMetadataResponse(res, true)
+	annotateOrigins(graph, schemaName, r.naming, phases...)
+
+	return r.applyPhases(phases...)
 }
 
 func (r *Runtime) TrackAllTables(graph *gen.Graph, sourceName, schemaName string) error {
-	allTables, err := graph.Tables()
+	phases, err := trackPhases(graph, sourceName, schemaName)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	trackBatch := []metadata.MetadataQuery{}
-	for _, table := range allTables {
-		trackBatch = append(trackBatch, metadata.PgTrackTableQuery(&metadata.PgTrackTableArgs{
-			Table: metadata.QualifiedTableName{
-				Name:   table.Name,
-				Schema: schemaName,
-			},
-			Source: sourceName,
-		}))
-	}
-
-	if len(trackBatch) > 0 {
-		logrus.Infof("ready to TRACK %d tables", len(trackBatch))
-
-		res, err := r.hasura.Metadata.Bulk(trackBatch)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-
-		logAndResponseMetadataResponse(res, true)
-	}
+	annotateOrigins(graph, schemaName, r.naming, phases...)
 
-	return nil
+	return r.applyPhases(phases...)
 }
 
 func (r *Runtime) CustomizeAllTables(graph *gen.Graph, sourceName, schemaName string) error {
-	tables, err := obtainHasuraTablesFromEntSchema(graph, schemaName)
+	phases, err := customizePhases(graph, sourceName, schemaName, r.naming)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	tableCustomizeBatch := []metadata.MetadataQuery{}
-	objectRelationBulk := []metadata.MetadataQuery{}
-	arrayRelationBulk := []metadata.MetadataQuery{}
-
-	for _, def := range tables {
-		tableName, err := r.tableNameFromDefinition(*def)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-
-		tableCustomizeBatch = append(tableCustomizeBatch, metadata.PgSetTableCustomizationQuery(&metadata.PgSetTableCustomizationArgs{
-			Table: metadata.QualifiedTableName{
-				Name:   tableName,
-				Schema: schemaName,
-			},
-			Source:        sourceName,
-			Configuration: def.Configuration,
-		}))
-
-		for _, rel := range def.ObjectRelationships {
-			var using metadata.IObjRelUsingChoice
-
-			switch u := rel.Using.ForeignKeyConstraintOn.(type) {
-			case string:
-				using = metadata.SameTable(u)
-			case metadata.RemoteTable:
-				using = u
-			}
-
-			objectRelationBulk = append(objectRelationBulk, metadata.PgCreateObjectRelationshipQuery(&metadata.PgCreateObjectRelationshipArgs{
-				Table: metadata.QualifiedTableName{
-					Name:   tableName,
-					Schema: schemaName,
-				},
-				Name:   rel.Name,
-				Source: sourceName,
-				Using: metadata.ObjRelUsing{
-					ForeignKeyConstraintOn: using,
-				},
-			}))
-		}
-
-		for _, rel := range def.ArrayRelationships {
-			arrayRelationBulk = append(arrayRelationBulk, metadata.PgCreateArrayRelationshipQuery(&metadata.PgCreateArrayRelationshipArgs{
-				Table: metadata.QualifiedTableName{
-					Name:   tableName,
-					Schema: schemaName,
-				},
-				Name:   rel.Name,
-				Source: sourceName,
-				Using: metadata.ArrRelUsing{
-					ForeignKeyConstraintOn: &metadata.ArrRelUsingFKeyOn{
-						Table:  rel.Using.ForeignKeyConstraintOn.Table,
-						Column: rel.Using.ForeignKeyConstraintOn.Column,
-					},
-				},
-			}))
-		}
-	}
-
-	if len(tableCustomizeBatch) > 0 {
-		logrus.Infof("ready to set %d CUSTOMIZE TABLES", len(tableCustomizeBatch))
+	annotateOrigins(graph, schemaName, r.naming, phases...)
 
-		res, err := r.hasura.Metadata.Bulk(tableCustomizeBatch)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-
-		logAndResponseMetadataResponse(res, true)
-	}
-
-	if len(objectRelationBulk) > 0 {
-		logrus.Infof("ready to set %d OBJECT RELATIONSHIPS", len(objectRelationBulk))
-
-		res, err := r.hasura.Metadata.Bulk(objectRelationBulk)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-
-		logAndResponseMetadataResponse(res, true)
-	}
-
-	if len(arrayRelationBulk) > 0 {
-		logrus.Infof("ready to set %d ARRAY RELATIONSHIPS", len(arrayRelationBulk))
-
-		res, err := r.hasura.Metadata.Bulk(arrayRelationBulk)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-
-		logAndResponseMetadataResponse(res, true)
-	}
-
-	return nil
+	return r.applyPhases(phases...)
 }
 
 func (r *Runtime) PermissionsForAllTables(graph *gen.Graph, sourceName, schemaName string) error {
-	insertPermissionBulk := []metadata.MetadataQuery{}
-	selectPermissionBulk := []metadata.MetadataQuery{}
-	updatePermissionBulk := []metadata.MetadataQuery{}
-	deletePermissionBulk := []metadata.MetadataQuery{}
-
-	nodeTables := []string{} // "permissions"
-
-	for _, n := range graph.Nodes {
-		nodeTables = append(nodeTables, n.Table())
-	}
-
-	for _, node := range graph.Nodes {
-		permAnn, isOk := node.Annotations[hasuraPermissionsRoleAnnotationName].(map[string]interface{})
-		if !isOk {
-			// logrus.Debug("skipping node: ", node.Name, " as it does not have permissions annotation")
-			continue
-		}
-
-		roleName, isOk := permAnn["role"].(string)
-		if !isOk {
-			logrus.Warn("skipping node: ", node.Name, " as it does not have permissions role name in annotation")
-			continue
-		}
-
-		if insertPermission, isOk := permAnn["insert_permission"].(map[string]interface{}); isOk {
-			// logrus.Info("creating insert permission for table: ", node.Table(), " with role: ", roleName)
-
-			insertPermissionBulk = append(
-				insertPermissionBulk,
-				r.pgCreateInsertPermission(insertPermission, node.Table(), roleName, sourceName, schemaName),
-			)
-
-			insertPermissionBulk = append(
-				insertPermissionBulk,
-				r.createInsertPermissionForEdges(nodeTables, node, insertPermission, roleName, sourceName, schemaName)...,
-			)
-		}
-
-		if selectPermission, isOk := permAnn["select_permission"].(map[string]interface{}); isOk {
-			// logrus.Info("creating select permission for table: ", node.Table(), " with role: ", roleName)
-			selectPermissionBulk = append(
-				selectPermissionBulk,
-				r.pgCreateSelectPermission(selectPermission, node.Table(), roleName, sourceName, schemaName),
-			)
-
-			selectPermissionBulk = append(
-				selectPermissionBulk,
-				r.createSelectPermissionForEdges(nodeTables, node, selectPermission, roleName, sourceName, schemaName)...,
-			)
-		}
-
-		if updatePermission, isOk := permAnn["update_permission"].(map[string]interface{}); isOk {
-			// logrus.Info("creating update permission for table: ", node.Table(), " with role: ", roleName)
-
-			updatePermissionBulk = append(
-				updatePermissionBulk,
-				r.pgCreateUpdatePermission(updatePermission, node.Table(), roleName, sourceName, schemaName),
-			)
-
-			updatePermissionBulk = append(
-				updatePermissionBulk,
-				r.createUpdatePermissionForEdges(nodeTables, node, updatePermission, roleName, sourceName, schemaName)...,
-			)
-
-		}
-
-		if deletePermission, isOk := permAnn["delete_permission"].(map[string]interface{}); isOk {
-			// logrus.Info("creating delete permission for table: ", node.Table(), " with role: ", roleName)
-
-			deletePermissionBulk = append(
-				deletePermissionBulk,
-				r.pgCreateDeletePermission(deletePermission, node.Table(), roleName, sourceName, schemaName),
-			)
-
-			deletePermissionBulk = append(
-				deletePermissionBulk,
-				r.createDeletePermissionForEdges(nodeTables, node, deletePermission, roleName, sourceName, schemaName)...,
-			)
-		}
+	phases, err := permissionPhases(graph, sourceName, schemaName, "", r.naming)
+	if err != nil {
+		return errors.WithStack(err)
 	}
 
-	if len(insertPermissionBulk) > 0 {
-		logrus.Infof("ready to create %d INSERT permissions", len(insertPermissionBulk))
+	annotateOrigins(graph, schemaName, r.naming, phases...)
 
-		res, err := r.hasura.Metadata.Bulk(insertPermissionBulk)
-		if err != nil {
-			return errors.WithStack(err)
-		}
+	return r.applyPhases(phases...)
+}
 
-		logAndResponseMetadataResponse(res, true)
+func (r *Runtime) EventTriggersForAllTables(graph *gen.Graph, sourceName, schemaName string) error {
+	phases, err := eventTriggerPhases(graph, sourceName, schemaName)
+	if err != nil {
+		return errors.WithStack(err)
 	}
 
-	if len(selectPermissionBulk) > 0 {
-		logrus.Infof("ready to create %d SELECT permissions", len(selectPermissionBulk))
+	annotateOrigins(graph, schemaName, r.naming, phases...)
 
-		res, err := r.hasura.Metadata.Bulk(selectPermissionBulk)
-		if err != nil {
-			return errors.WithStack(err)
-		}
+	return r.applyPhases(phases...)
+}
 
-		logAndResponseMetadataResponse(res, true)
+// RegisterActions creates the actions set with SetActions that are missing on the server and updates
+// the changed ones. Their custom types are merged with the ones of the server, so hand-made types
+// and actions are kept.
+func (r *Runtime) RegisterActions() error {
+	if len(r.actions) == 0 {
+		return nil
 	}
 
-	if len(updatePermissionBulk) > 0 {
-		logrus.Infof("ready to create %d UPDATE permissions", len(updatePermissionBulk))
-
-		res, err := r.hasura.Metadata.Bulk(updatePermissionBulk)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-
-		logAndResponseMetadataResponse(res, true)
+	current, err := r.exportMetadata()
+	if err != nil {
+		return errors.WithMessage(err, "error exporting metadata")
 	}
 
-	if len(deletePermissionBulk) > 0 {
-		logrus.Infof("ready to create %d DELETE permissions", len(deletePermissionBulk))
-
-		res, err := r.hasura.Metadata.Bulk(deletePermissionBulk)
-		if err != nil {
-			return errors.WithStack(err)
-		}
-
-		logAndResponseMetadataResponse(res, true)
+	phases, err := reconcileActionPhases(current, r.actions)
+	if err != nil {
+		return errors.WithStack(err)
 	}
 
-	return nil
-}
-
-func (r *Runtime) isNodeTable(nodeTables []string, tableName string) bool {
-	for _, nodeTable := range nodeTables {
-		if nodeTable == tableName {
-			return true
-		}
-	}
+	annotateOrigins(nil, "", r.naming, phases...)
 
-	return false
+	return r.applyPhases(phases...)
 }
 
-func (r *Runtime) createInsertPermissionForEdges(nodeTables []string, node *gen.Type, permission map[string]interface{}, role string, sourceName, schemaName string) []metadata.MetadataQuery {
-	bulkEdgePermissions := []metadata.MetadataQuery{}
-
-	for _, edge := range node.Edges {
-		if !edge.IsInverse() && !edge.OwnFK() {
-			tableName := edge.Rel.Table
-			if r.isNodeTable(nodeTables, tableName) {
-				continue
-			}
-
-			tableName, newPermission := r.tableAndPermissionsFromEdge(edge, nodeTables, permission)
-
-			// logrus.Info("creating [edge] insert permission for table: ", tableName, " with role: ", role)
-
-			bulkEdgePermissions = append(bulkEdgePermissions, r.pgCreateInsertPermission(newPermission, tableName, role, sourceName, schemaName))
-		}
-	}
-
-	return bulkEdgePermissions
-}
-
-func (r *Runtime) createSelectPermissionForEdges(nodeTables []string, node *gen.Type, permission map[string]interface{}, role string, sourceName, schemaName string) []metadata.MetadataQuery {
-	bulkEdgePermissions := []metadata.MetadataQuery{}
-
-	for _, edge := range node.Edges {
-		if !edge.IsInverse() && !edge.OwnFK() {
-			tableName := edge.Rel.Table
-			if r.isNodeTable(nodeTables, tableName) {
-				continue
-			}
-
-			tableName, newPermission := r.tableAndPermissionsFromEdge(edge, nodeTables, permission)
-
-			// logrus.Info("creating [edge] insert permission for table: ", tableName, " with role: ", role)
-
-			bulkEdgePermissions = append(bulkEdgePermissions, r.pgCreateSelectPermission(newPermission, tableName, role, sourceName, schemaName))
+// applyPhases sends every non empty phase as a bulk request, in order. It stops at the first
+// failing phase unless the phase is soft.
+func (r *Runtime) applyPhases(phases ...*PlanPhase) error {
+	for _, phase := range phases {
+		if len(phase.Queries) == 0 {
+			continue
 		}
-	}
-
-	return bulkEdgePermissions
-}
-
-func (r *Runtime) createUpdatePermissionForEdges(nodeTables []string, node *gen.Type, permission map[string]interface{}, role string, sourceName, schemaName string) []metadata.MetadataQuery {
-	bulkEdgePermissions := []metadata.MetadataQuery{}
-
-	for _, edge := range node.Edges {
-		if !edge.IsInverse() && !edge.OwnFK() {
-			tableName := edge.Rel.Table
-			if r.isNodeTable(nodeTables, tableName) {
-				continue
-			}
 
-			tableName, newPermission := r.tableAndPermissionsFromEdge(edge, nodeTables, permission)
+		logrus.Infof("ready to apply %d %s", len(phase.Queries), strings.ToUpper(phase.Name))
 
-			// logrus.Info("creating [edge] insert permission for table: ", tableName, " with role: ", role)
-
-			bulkEdgePermissions = append(bulkEdgePermissions, r.pgCreateUpdatePermission(newPermission, tableName, role, sourceName, schemaName))
+		res, err := r.hasura.Bulk(phase.Queries)
+		if err != nil {
+			return errors.WithStack(err)
 		}
-	}
-
-	return bulkEdgePermissions
-}
-
-func (r *Runtime) createDeletePermissionForEdges(nodeTables []string, node *gen.Type, permission map[string]interface{}, role string, sourceName, schemaName string) []metadata.MetadataQuery {
-	bulkEdgePermissions := []metadata.MetadataQuery{}
 
-	for _, edge := range node.Edges {
-		if !edge.IsInverse() && !edge.OwnFK() {
-			tableName := edge.Rel.Table
-			if r.isNodeTable(nodeTables, tableName) {
-				continue
-			}
-
-			tableName, newPermission := r.tableAndPermissionsFromEdge(edge, nodeTables, permission)
-
-			// logrus.Info("creating [edge] insert permission for table: ", tableName, " with role: ", role)
-
-			bulkEdgePermissions = append(bulkEdgePermissions, r.pgCreateDeletePermission(newPermission, tableName, role, sourceName, schemaName))
+		if err := logAndResponseMetadataResponse(res, phase, r.isSoftPhase(phase.Name)); err != nil {
+			return err
 		}
 	}
 
-	return bulkEdgePermissions
+	return nil
 }
 
-func (r *Runtime) tableAndPermissionsFromEdge(edge *gen.Edge, nodeTables []string, permission map[string]interface{}) (string, map[string]interface{}) {
-	tableName := edge.Rel.Table
-
-	levelUp := strcase.ToLowerCamel(strings.TrimSuffix(edge.Rel.Column(), "_id"))
-	newPermission := make(map[string]interface{})
-
-	for k, v := range permission {
-		newPermission[k] = v
-	}
-
-	newPermission["columns"] = edge.Rel.Columns
-
-	if newPermission["check"] != nil || levelUp == "" {
-		newPermission["check"] = map[string]interface{}{
-			levelUp: newPermission["check"],
-		}
-	}
-
-	if newPermission["filter"] != nil || levelUp == "" {
-		newPermission["filter"] = map[string]interface{}{
-			levelUp: newPermission["filter"],
-		}
+func (r *Runtime) clearMetadata() error {
+	res, err := r.hasura.ClearMetadata()
+	if err != nil {
+		return errors.WithStack(err)
 	}
 
-	return tableName, newPermission
+	return metadataResponseError(res, nil)
 }
 
-func (r *Runtime) tableNameFromDefinition(table metadata.TableDefinition) (string, error) {
-	tableName := ""
-	switch tName := table.Table.(type) {
-	case metadata.TableName:
-		tableName = string(tName)
-	case metadata.QualifiedTableName:
-		tableName = string(tName.Name)
-	default:
-		return "", errors.Errorf("unexpected type for table name: %T", tName)
+// ReplaceMetadata replaces the whole metadata of the engine, e.g. with the document of BuildMetadata.
+func (r *Runtime) ReplaceMetadata(m *Metadata) error {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return errors.WithStack(err)
 	}
 
-	return tableName, nil
+	return r.replaceRawMetadata(data)
 }
 
-func (r *Runtime) clearMetadata() error {
-	_, err := r.hasura.Metadata.ClearMetadata(&metadata.ClearMetadataArgs{})
+func (r *Runtime) replaceRawMetadata(m json.RawMessage) error {
+	res, err := r.hasura.ReplaceMetadata(m)
 	if err != nil {
 		return errors.WithStack(err)
 	}
 
-	return nil
+	return metadataResponseError(res, nil)
 }
@@ -0,0 +1,126 @@
+package enthasura
+
+import (
+	"strings"
+
+	"github.com/minskylab/hasura-api/metadata"
+)
+
+// XHasuraUserID is the session variable usually holding the id of the current user.
+const XHasuraUserID = "X-Hasura-User-Id"
+
+// And returns a boolean expression true when every expression is true.
+func And(exps ...M) M {
+	return M{"_and": boolExpList(exps)}
+}
+
+// Or returns a boolean expression true when at least one of the expressions is true.
+func Or(exps ...M) M {
+	return M{"_or": boolExpList(exps)}
+}
+
+// Not negates a boolean expression.
+func Not(exp M) M {
+	return M{"_not": exp}
+}
+
+func boolExpList(exps []M) []M {
+	if exps == nil {
+		return []M{}
+	}
+
+	return exps
+}
+
+// Field applies the operators to a column. A dotted path traverses relationships, so
+// Field("authors.id", Eq(XHasuraUserID)) is the same as M{"authors": M{"id": Eq(XHasuraUserID)}}.
+func Field(path string, ops ...M) M {
+	exp := M{}
+	for _, op := range ops {
+		for key, value := range op {
+			exp[key] = value
+		}
+	}
+
+	parts := strings.Split(path, ".")
+	for i := len(parts) - 1; i >= 0; i-- {
+		exp = M{parts[i]: exp}
+	}
+
+	return exp
+}
+
+// Rel traverses a relationship, the expression is evaluated against the related rows.
+func Rel(name string, exp M) M {
+	return M{name: exp}
+}
+
+// Exists returns a boolean expression true when a row of an unrelated table matches where. The
+// expression is validated only when the table is part of the ent graph.
+func Exists(schemaName, tableName string, where M) M {
+	return M{
+		"_exists": M{
+			"_table": metadata.QualifiedTableName{Schema: schemaName, Name: tableName},
+			"_where": where,
+		},
+	}
+}
+
+func operator(name string, val interface{}) M {
+	return M{name: val}
+}
+
+func Neq(val interface{}) M { return operator("_neq", val) }
+
+func Gt(val interface{}) M { return operator("_gt", val) }
+
+func Gte(val interface{}) M { return operator("_gte", val) }
+
+func Lt(val interface{}) M { return operator("_lt", val) }
+
+func Lte(val interface{}) M { return operator("_lte", val) }
+
+func In(vals ...interface{}) M { return operator("_in", valueList(vals)) }
+
+func Nin(vals ...interface{}) M { return operator("_nin", valueList(vals)) }
+
+func IsNull(isNull bool) M { return operator("_is_null", isNull) }
+
+func Like(pattern string) M { return operator("_like", pattern) }
+
+func Nlike(pattern string) M { return operator("_nlike", pattern) }
+
+func Ilike(pattern string) M { return operator("_ilike", pattern) }
+
+func Nilike(pattern string) M { return operator("_nilike", pattern) }
+
+// InSession compares a column with an array session variable, e.g. X-Hasura-Allowed-Ids.
+func InSession(sessionVariable string) M { return operator("_in", sessionVariable) }
+
+func valueList(vals []interface{}) []interface{} {
+	if vals == nil {
+		return []interface{}{}
+	}
+
+	return vals
+}
+
+// JSONB operators.
+
+func Contains(val interface{}) M { return operator("_contains", val) }
+
+func ContainedIn(val interface{}) M { return operator("_contained_in", val) }
+
+func HasKey(key string) M { return operator("_has_key", key) }
+
+func HasKeysAny(keys ...string) M { return operator("_has_keys_any", keyList(keys)) }
+
+func HasKeysAll(keys ...string) M { return operator("_has_keys_all", keyList(keys)) }
+
+func keyList(keys []string) A {
+	if keys == nil {
+		return A{}
+	}
+
+	return keys
+}
@@ -0,0 +1,86 @@
+package enthasura
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestBoolExp(t *testing.T) {
+	tests := []struct {
+		name string
+		exp  M
+		want string
+	}{
+		{"eq", Field("id", Eq(XHasuraUserID)), `{"id":{"_eq":"X-Hasura-User-Id"}}`},
+		{"several operators", Field("age", Gte(18), Lt(65)), `{"age":{"_gte":18,"_lt":65}}`},
+		{"no operator", Field("id"), `{"id":{}}`},
+		{"dotted path", Field("authors.user.id", Eq(XHasuraUserID)), `{"authors":{"user":{"id":{"_eq":"X-Hasura-User-Id"}}}}`},
+		{"dotted path with operators", Field("team.members.age", Gt(1), Neq(2)), `{"team":{"members":{"age":{"_gt":1,"_neq":2}}}}`},
+		{"rel", Rel("author", Field("id", Eq(1))), `{"author":{"id":{"_eq":1}}}`},
+		{"rel of dotted path", Rel("team", Field("owner.id", Eq(1))), `{"team":{"owner":{"id":{"_eq":1}}}}`},
+		{"and", And(Field("a", Eq(1)), Field("b", Eq(2))), `{"_and":[{"a":{"_eq":1}},{"b":{"_eq":2}}]}`},
+		{"empty and", And(), `{"_and":[]}`},
+		{"or", Or(Field("a", Eq(1)), Field("b", IsNull(true))), `{"_or":[{"a":{"_eq":1}},{"b":{"_is_null":true}}]}`},
+		{"empty or", Or(), `{"_or":[]}`},
+		{"not", Not(Field("deleted", Eq(true))), `{"_not":{"deleted":{"_eq":true}}}`},
+		{"nested not", Not(Not(Field("a", Eq(1)))), `{"_not":{"_not":{"a":{"_eq":1}}}}`},
+		{"not of or", Not(Or(Field("a", Eq(1)), Field("b", Eq(2)))), `{"_not":{"_or":[{"a":{"_eq":1}},{"b":{"_eq":2}}]}}`},
+		{"and in rel", Rel("author", And(Field("active", Eq(true)), Not(Field("banned", Eq(true))))), `{"author":{"_and":[{"active":{"_eq":true}},{"_not":{"banned":{"_eq":true}}}]}}`},
+		{
+			"exists",
+			Exists("public", "admins", Field("user_id", Eq(XHasuraUserID))),
+			`{"_exists":{"_table":{"schema":"public","name":"admins"},"_where":{"user_id":{"_eq":"X-Hasura-User-Id"}}}}`,
+		},
+		{
+			"nested exists",
+			Or(Field("owner_id", Eq(XHasuraUserID)), Exists("audit", "grants", And(Field("user_id", Eq(XHasuraUserID)), Not(Exists("audit", "revocations", Field("user_id", Eq(XHasuraUserID))))))),
+			`{"_or":[{"owner_id":{"_eq":"X-Hasura-User-Id"}},{"_exists":{"_table":{"schema":"audit","name":"grants"},"_where":{"_and":[{"user_id":{"_eq":"X-Hasura-User-Id"}},{"_not":{"_exists":{"_table":{"schema":"audit","name":"revocations"},"_where":{"user_id":{"_eq":"X-Hasura-User-Id"}}}}}]}}}]}`,
+		},
+		{"neq", Field("a", Neq("x")), `{"a":{"_neq":"x"}}`},
+		{"gt", Field("a", Gt(1)), `{"a":{"_gt":1}}`},
+		{"gte", Field("a", Gte(1)), `{"a":{"_gte":1}}`},
+		{"lt", Field("a", Lt(1)), `{"a":{"_lt":1}}`},
+		{"lte", Field("a", Lte(1)), `{"a":{"_lte":1}}`},
+		{"in", Field("a", In(1, 2)), `{"a":{"_in":[1,2]}}`},
+		{"empty in", Field("a", In()), `{"a":{"_in":[]}}`},
+		{"nin", Field("a", Nin("x", "y")), `{"a":{"_nin":["x","y"]}}`},
+		{"empty nin", Field("a", Nin()), `{"a":{"_nin":[]}}`},
+		{"in session", Field("id", InSession("X-Hasura-Allowed-Ids")), `{"id":{"_in":"X-Hasura-Allowed-Ids"}}`},
+		{"is null", Field("a", IsNull(false)), `{"a":{"_is_null":false}}`},
+		{"like", Field("a", Like("%x")), `{"a":{"_like":"%x"}}`},
+		{"nlike", Field("a", Nlike("%x")), `{"a":{"_nlike":"%x"}}`},
+		{"ilike", Field("a", Ilike("%x")), `{"a":{"_ilike":"%x"}}`},
+		{"nilike", Field("a", Nilike("%x")), `{"a":{"_nilike":"%x"}}`},
+		{"contains", Field("tags", Contains(M{"a": 1})), `{"tags":{"_contains":{"a":1}}}`},
+		{"contained in", Field("tags", ContainedIn([]int{1})), `{"tags":{"_contained_in":[1]}}`},
+		{"has key", Field("tags", HasKey("a")), `{"tags":{"_has_key":"a"}}`},
+		{"has keys any", Field("tags", HasKeysAny("a", "b")), `{"tags":{"_has_keys_any":["a","b"]}}`},
+		{"empty has keys any", Field("tags", HasKeysAny()), `{"tags":{"_has_keys_any":[]}}`},
+		{"has keys all", Field("tags", HasKeysAll("a", "b")), `{"tags":{"_has_keys_all":["a","b"]}}`},
+		{"empty has keys all", Field("tags", HasKeysAll()), `{"tags":{"_has_keys_all":[]}}`},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			got, err := json.Marshal(test.exp)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			assertSameJSON(t, got, []byte(test.want))
+		})
+	}
+}
+
+func TestFieldDoesNotShareOperators(t *testing.T) {
+	op := Eq(1)
+
+	exp := Field("a.b", op)
+	exp["a"].(M)["b"].(M)["_gt"] = 2
+
+	if len(op) != 1 {
+		t.Errorf("Field modified its operator: %v", op)
+	}
+}
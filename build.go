@@ -0,0 +1,114 @@
+package enthasura
+
+import (
+	"entgo.io/ent/entc/gen"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+)
+
+// Options configures BuildMetadata and BuildQueries.
+type Options struct {
+	source      string
+	schema      string
+	defaultRole string
+	naming      NamingStrategy
+	actions     []*Action
+}
+
+type Option func(*Options)
+
+// WithSource sets the Hasura source of the tables, "default" when not set.
+func WithSource(source string) Option {
+	return func(options *Options) {
+		options.source = source
+	}
+}
+
+// WithSchema sets the Postgres schema of the tables, "public" when not set.
+func WithSchema(schema string) Option {
+	return func(options *Options) {
+		options.schema = schema
+	}
+}
+
+// WithDefaultRole sets the role of the permission annotations without one.
+func WithDefaultRole(role string) Option {
+	return func(options *Options) {
+		options.defaultRole = role
+	}
+}
+
+// WithNaming sets the naming strategy, DefaultNaming when not set.
+func WithNaming(naming NamingStrategy) Option {
+	return func(options *Options) {
+		options.naming = naming
+	}
+}
+
+// WithActions adds the actions and their custom types.
+func WithActions(actions ...*Action) Option {
+	return func(options *Options) {
+		options.actions = append(options.actions, actions...)
+	}
+}
+
+func newOptions(opts []Option) *Options {
+	options := &Options{
+		source: DefaultHasuraMetadataConfig.Source,
+		schema: DefaultHasuraMetadataConfig.SchemaName,
+	}
+
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	options.naming = namingOrDefault(options.naming)
+
+	return options
+}
+
+// BuildMetadata validates the annotations of the graph and returns its Hasura metadata: tables,
+// customizations, relationships, permissions, event triggers and actions. It has no side effects.
+func BuildMetadata(graph *gen.Graph, opts ...Option) (*Metadata, error) {
+	options := newOptions(opts)
+
+	if err := validateGraph(graph, options.schema, options.naming); err != nil {
+		return nil, err
+	}
+
+	m, err := hasuraMetadataFromEntSchema(graph, options.source, options.schema, options.defaultRole, options.naming)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if err := addActionsMetadata(m, options.actions); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return m, nil
+}
+
+// BuildQueries validates the annotations of the graph and returns the metadata queries of a full
+// apply, in the order they are sent. It has no side effects.
+func BuildQueries(graph *gen.Graph, opts ...Option) ([]metadata.MetadataQuery, error) {
+	options := newOptions(opts)
+
+	plan, err := planFromGraph(graph, options.source, options.schema, options.defaultRole, options.naming)
+	if err != nil {
+		return nil, err
+	}
+
+	actions, err := actionPhases(options.actions)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	plan.add(actions...)
+
+	queries := []metadata.MetadataQuery{}
+	for _, phase := range plan.Phases {
+		queries = append(queries, phase.Queries...)
+	}
+
+	return queries, nil
+}
@@ -0,0 +1,90 @@
+package enthasura
+
+import (
+	"encoding/json"
+
+	hasura_api "github.com/minskylab/hasura-api"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+)
+
+// MetadataClient is the part of the Hasura metadata API used by the runtime. NewHasuraMetadataClient
+// talks to a running engine, hasuratest.MetadataClient keeps the metadata in memory.
+type MetadataClient interface {
+	// Bulk sends the queries in a single bulk request, applied atomically.
+	Bulk(queries []metadata.MetadataQuery) (metadata.MetadataResponse, error)
+	ClearMetadata() (metadata.MetadataResponse, error)
+	ExportMetadata() (*HasuraMetadata, error)
+	// ReplaceMetadata replaces the whole metadata with the document, sent as is.
+	ReplaceMetadata(m json.RawMessage) (metadata.MetadataResponse, error)
+	GetInconsistentMetadata() (*InconsistentMetadata, error)
+}
+
+type hasuraMetadataClient struct {
+	client *hasura_api.MetadataClient
+}
+
+// NewHasuraMetadataClient returns a MetadataClient sending the queries to the metadata API of a
+// Hasura engine.
+func NewHasuraMetadataClient(options ...hasura_api.HasuraClientOption) (MetadataClient, error) {
+	client, err := hasura_api.NewHasuraClient(options...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &hasuraMetadataClient{client: client.Metadata}, nil
+}
+
+func (c *hasuraMetadataClient) Bulk(queries []metadata.MetadataQuery) (metadata.MetadataResponse, error) {
+	return c.client.Bulk(queries)
+}
+
+func (c *hasuraMetadataClient) ClearMetadata() (metadata.MetadataResponse, error) {
+	return c.client.ClearMetadata(&metadata.ClearMetadataArgs{})
+}
+
+func (c *hasuraMetadataClient) ExportMetadata() (*HasuraMetadata, error) {
+	res, err := c.client.ExportMetadata(&metadata.ExportMetadataArgs{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	response, isOk := res.(metadata.RestyResponse)
+	if !isOk {
+		return nil, errors.Errorf("unexpected export metadata response: %T", res)
+	}
+
+	if response.IsError() {
+		return nil, errors.Errorf("export metadata failed (%d): %s", response.StatusCode(), response.Body())
+	}
+
+	return decodeHasuraMetadata(response.Body())
+}
+
+func (c *hasuraMetadataClient) ReplaceMetadata(m json.RawMessage) (metadata.MetadataResponse, error) {
+	// the arguments of replace_metadata in hasura-api are empty, the document is sent as is
+	return c.client.Exec(metadata.MetadataQuery{Type: metadata.ReplaceMetadata, Args: m})
+}
+
+func (c *hasuraMetadataClient) GetInconsistentMetadata() (*InconsistentMetadata, error) {
+	res, err := c.client.GetInconsistentMetadata(&metadata.GetInconsistentMetadataArgs{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	response, isOk := res.(metadata.RestyResponse)
+	if !isOk {
+		return nil, errors.Errorf("unexpected inconsistent metadata response: %T", res)
+	}
+
+	if response.IsError() {
+		return nil, errors.Errorf("get inconsistent metadata failed (%d): %s", response.StatusCode(), response.Body())
+	}
+
+	inconsistent := &InconsistentMetadata{}
+	if err := json.Unmarshal(response.Body(), inconsistent); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return inconsistent, nil
+}
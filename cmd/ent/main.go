@@ -2,6 +2,7 @@ package main
 
 import (
 	"log"
+	"net"
 	"os"
 	"time"
 
@@ -19,30 +20,57 @@ func main() {
 			{
 				Name:  "generate",
 				Usage: "generate a default metadata file",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					stringFlag("schema", "s", "./ent/schema"),
 					stringFlag("name", "n", "public"),
 					stringFlag("source", "c", "default"),
 					stringFlag("output", "o", "hasura/metadata.json"),
 					stringFlag("input", "i", ""),
+					stringFlag("metadata-dir", "m", ""),
 					stringFlag("role", "r", ""),
 					boolFlag("override", "ov", false),
-				},
+				}, namingFlags()...),
 				Action: generateCommand,
 			},
 			{
 				Name:  "apply",
 				Usage: "apply metadata generate from ent to a Hasura GraphQL Engine",
-				Flags: []cli.Flag{
+				Flags: append([]cli.Flag{
 					stringFlag("schema", "s", "./ent/schema"),
 					stringFlag("name", "n", "public"),
 					stringFlag("source", "c", "default"),
 					stringFlag("envfile", "e", ".env"),
 					stringFlag("configfile", "f", ""),
 					boolFlag("debug", "d", false),
-				},
+					&cli.BoolFlag{
+						Name:    "dry-run",
+						Aliases: []string{"p"},
+						Usage: "print the plan without applying it; unless --recreate is set the plan is computed " +
+							"against the metadata exported from the engine of --envfile, and the --recreate plan is " +
+							"printed when the engine is not reachable",
+					},
+					stringFlag("format", "t", "text"),
+					boolFlag("recreate", "r", false),
+					boolFlag("prune", "x", false),
+					boolFlag("allow-inconsistent", "ai", false),
+					boolFlag("rollback-inconsistent", "ri", false),
+					&cli.StringSliceFlag{
+						Name:  "soft",
+						Usage: "phases whose errors are only logged, e.g. --soft select-permissions or --soft all",
+						Value: cli.NewStringSlice("untrack-tables"),
+					},
+				}, namingFlags()...),
 				Action: applyCommand,
 			},
+			{
+				Name:  "validate",
+				Usage: "check the permission annotations of the ent schema",
+				Flags: append([]cli.Flag{
+					stringFlag("schema", "s", "./ent/schema"),
+					stringFlag("name", "n", "public"),
+				}, namingFlags()...),
+				Action: validateCommand,
+			},
 		},
 	}
 
@@ -67,32 +95,94 @@ func boolFlag(name, alias string, defaultValue bool) *cli.BoolFlag {
 	}
 }
 
+// namingFlags are the flags of namingFromFlags.
+func namingFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "naming",
+			Aliases: []string{"g"},
+			Value:   hasura.DefaultNamingName,
+			Usage:   "naming strategy: default, graphql-default or snake-case",
+		},
+		&cli.StringFlag{
+			Name:    "naming-config",
+			Aliases: []string{"nc"},
+			Usage:   "YAML file with the strategy, the *_verb names and the root_fields of single tables",
+		},
+		&cli.StringFlag{Name: "insert-verb", Usage: "verb of the insert root fields"},
+		&cli.StringFlag{Name: "update-verb", Usage: "verb of the update root fields"},
+		&cli.StringFlag{Name: "delete-verb", Usage: "verb of the delete root fields"},
+		&cli.StringFlag{Name: "aggregate-verb", Usage: "suffix of the aggregate root fields"},
+	}
+}
+
+// namingFromFlags returns the naming strategy of the naming file, if any, with the strategy and the
+// verbs given as flags.
+func namingFromFlags(c *cli.Context) (hasura.NamingStrategy, error) {
+	config := &hasura.NamingConfig{}
+
+	if filename := c.String("naming-config"); filename != "" {
+		read, err := hasura.ReadNamingConfig(filename)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		config = read
+	}
+
+	if c.IsSet("naming") || config.Strategy == "" {
+		config.Strategy = c.String("naming")
+	}
+
+	for flag, verb := range map[string]*string{
+		"insert-verb":    &config.InsertVerbName,
+		"update-verb":    &config.UpdateVerbName,
+		"delete-verb":    &config.DeleteVerbName,
+		"aggregate-verb": &config.AggregateVerbName,
+	} {
+		if c.IsSet(flag) {
+			*verb = c.String(flag)
+		}
+	}
+
+	return config.Naming()
+}
+
 func generateCommand(c *cli.Context) error {
-	// defaultConfig := hasura.DefaultHasuraMetadataConfig
-
-	// schema := c.String("schema")
-	// name := c.String("name")
-	// source := c.String("source")
-	// output := c.String("output")
-	// input := c.String("input")
-	// role := c.String("role")
-	// override := c.Bool("override")
-
-	// if schemaOverride := c.Args().First(); schemaOverride != "" {
-	// 	schema = schemaOverride
-	// }
-
-	// defaultConfig.SchemaPath = schema
-	// defaultConfig.SchemaName = name
-	// defaultConfig.Source = source
-	// defaultConfig.OutputMetadataFile = output
-	// defaultConfig.MetadataInput = input
-	// defaultConfig.DefaultRole = role
-	// defaultConfig.OverrideTables = override
-
-	// if err := hasura.CreateDefaultMetadataFromSchema(&defaultConfig); err != nil {
-	// 	return errors.WithStack(err)
-	// }
+	defaultConfig := hasura.DefaultHasuraMetadataConfig
+
+	schema := c.String("schema")
+	name := c.String("name")
+	source := c.String("source")
+	output := c.String("output")
+	input := c.String("input")
+	metadataDir := c.String("metadata-dir")
+	role := c.String("role")
+	override := c.Bool("override")
+
+	if schemaOverride := c.Args().First(); schemaOverride != "" {
+		schema = schemaOverride
+	}
+
+	defaultConfig.SchemaPath = schema
+	defaultConfig.SchemaName = name
+	defaultConfig.Source = source
+	defaultConfig.OutputMetadataFile = output
+	defaultConfig.MetadataInput = input
+	defaultConfig.MetadataDirectory = metadataDir
+	defaultConfig.DefaultRole = role
+	defaultConfig.OverrideTables = override
+
+	naming, err := namingFromFlags(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defaultConfig.Naming = naming
+
+	if err := hasura.CreateDefaultMetadataFromSchema(&defaultConfig); err != nil {
+		return errors.WithStack(err)
+	}
 
 	return nil
 }
@@ -100,11 +190,35 @@ func generateCommand(c *cli.Context) error {
 func applyCommand(c *cli.Context) error {
 	envFile := c.String("envfile")
 	debug := c.Bool("debug")
+	dryRun := c.Bool("dry-run")
+	recreate := c.Bool("recreate")
 
 	if debug {
 		logrus.SetLevel(logrus.DebugLevel)
 	}
 
+	schema := c.String("schema")
+	name := c.String("name")
+	source := c.String("source")
+
+	if schemaOverride := c.Args().First(); schemaOverride != "" {
+		schema = schemaOverride
+	}
+
+	naming, err := namingFromFlags(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if dryRun && recreate { // the recreate plan does not depend on the current metadata
+		plan, err := hasura.PlanFullMetadataTransform(schema, source, name, naming)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return writePlan(plan, c.String("format"))
+	}
+
 	logrus.Debugf("loadenv: %s\n", envFile)
 
 	run, err := hasura.NewRuntime(
@@ -115,19 +229,88 @@ func applyCommand(c *cli.Context) error {
 		return errors.WithStack(err)
 	}
 
+	run.SetSoftPhases(c.StringSlice("soft")...)
+	run.SetNamingStrategy(naming)
+
+	switch {
+	case c.Bool("allow-inconsistent") && c.Bool("rollback-inconsistent"):
+		return errors.New("--allow-inconsistent and --rollback-inconsistent cannot be used together")
+	case c.Bool("allow-inconsistent"):
+		run.SetInconsistencyPolicy(hasura.InconsistencyAllow)
+	case c.Bool("rollback-inconsistent"):
+		run.SetInconsistencyPolicy(hasura.InconsistencyRollback)
+	}
+
 	logrus.Debugf("run: %+v\n", run)
 
+	if dryRun {
+		plan, err := run.PlanIncrementalMetadataTransform(schema, source, name, c.Bool("prune"))
+		if isUnreachable(err) {
+			logrus.Warnf("the Hasura engine is not reachable (%s), printing the --recreate plan, which does not depend on the current metadata", errors.Cause(err))
+			plan, err = hasura.PlanFullMetadataTransform(schema, source, name, naming)
+		}
+
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return writePlan(plan, c.String("format"))
+	}
+
+	if recreate {
+		if err := run.PerformFullMetadataTransform(schema, source, name); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	}
+
+	if err := run.PerformIncrementalMetadataTransform(schema, source, name, c.Bool("prune")); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func validateCommand(c *cli.Context) error {
 	schema := c.String("schema")
-	name := c.String("name")
-	source := c.String("source")
 
 	if schemaOverride := c.Args().First(); schemaOverride != "" {
 		schema = schemaOverride
 	}
 
-	if err := run.PerformFullMetadataTransform(schema, source, name); err != nil {
+	naming, err := namingFromFlags(c)
+	if err != nil {
 		return errors.WithStack(err)
 	}
 
+	if err := hasura.ValidateSchema(schema, c.String("name"), naming); err != nil {
+		return err
+	}
+
+	logrus.Info("all permissions are valid")
+
 	return nil
 }
+
+// isUnreachable reports if the error is a failure to connect to the engine.
+func isUnreachable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	_, isNetErr := errors.Cause(err).(net.Error)
+
+	return isNetErr
+}
+
+func writePlan(plan *hasura.Plan, format string) error {
+	switch format {
+	case "json":
+		return plan.WriteJSON(os.Stdout)
+	case "text":
+		return plan.WriteText(os.Stdout)
+	default:
+		return errors.Errorf("unknown plan format: %s", format)
+	}
+}
@@ -0,0 +1,256 @@
+package enthasura
+
+import (
+	"encoding/json"
+
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/schema"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const hasuraColumnAnnotationName = "hasura-column"
+
+// ColumnAnnotation customizes the column of an ent field: its GraphQL name and description, the roles
+// that can not see it and the session variable used to preset it on insert and update.
+type ColumnAnnotation struct {
+	GraphQLName string   `json:"graphql_name,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Hidden      bool     `json:"hidden,omitempty"`
+	HiddenFrom  []string `json:"hidden_from,omitempty"`
+	Preset      string   `json:"preset,omitempty"`
+}
+
+func (ColumnAnnotation) Name() string {
+	return hasuraColumnAnnotationName
+}
+
+// Merge implements the schema.Merger interface, the values set in other win.
+func (a ColumnAnnotation) Merge(other schema.Annotation) schema.Annotation {
+	var ann ColumnAnnotation
+
+	switch other := other.(type) {
+	case ColumnAnnotation:
+		ann = other
+	case *ColumnAnnotation:
+		if other == nil {
+			return a
+		}
+		ann = *other
+	default:
+		return a
+	}
+
+	if ann.GraphQLName != "" {
+		a.GraphQLName = ann.GraphQLName
+	}
+
+	if ann.Description != "" {
+		a.Description = ann.Description
+	}
+
+	if ann.Preset != "" {
+		a.Preset = ann.Preset
+	}
+
+	a.Hidden = a.Hidden || ann.Hidden
+	a.HiddenFrom = append(append([]string{}, a.HiddenFrom...), ann.HiddenFrom...)
+
+	return a
+}
+
+var (
+	_ schema.Annotation = (*ColumnAnnotation)(nil)
+	_ schema.Merger     = (*ColumnAnnotation)(nil)
+)
+
+// GraphQLName overrides the GraphQL name of the column.
+func GraphQLName(name string) ColumnAnnotation {
+	return ColumnAnnotation{GraphQLName: name}
+}
+
+// Description sets the description of the column in the GraphQL schema.
+func Description(description string) ColumnAnnotation {
+	return ColumnAnnotation{Description: description}
+}
+
+// Hidden removes the column from the permissions of every role, or only of the given ones.
+func Hidden(roles ...string) ColumnAnnotation {
+	if len(roles) == 0 {
+		return ColumnAnnotation{Hidden: true}
+	}
+
+	return ColumnAnnotation{HiddenFrom: roles}
+}
+
+// PresetFromSession sets the column from a session variable on insert and update, e.g. XHasuraUserID.
+func PresetFromSession(variable string) ColumnAnnotation {
+	return ColumnAnnotation{Preset: variable}
+}
+
+// hiddenFrom reports whether the column is hidden from the role.
+func (a *ColumnAnnotation) hiddenFrom(role string) bool {
+	return a.Hidden || elementInArray(a.HiddenFrom, role)
+}
+
+func columnAnnotationFromField(field *gen.Field) (*ColumnAnnotation, error) {
+	raw, isOk := field.Annotations[hasuraColumnAnnotationName]
+	if !isOk || raw == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	ann := &ColumnAnnotation{}
+	if err := json.Unmarshal(data, ann); err != nil {
+		return nil, errors.Wrapf(err, "decoding column annotation of %s", field.Name)
+	}
+
+	return ann, nil
+}
+
+// columnAnnotations returns the column annotations of the node by column name.
+func columnAnnotations(node *gen.Type) (map[string]*ColumnAnnotation, error) {
+	annotations := map[string]*ColumnAnnotation{}
+
+	for _, field := range node.Fields {
+		ann, err := columnAnnotationFromField(field)
+		if err != nil {
+			return nil, errors.Wrapf(err, "node %s", node.Name)
+		}
+
+		if ann != nil {
+			annotations[field.StorageKey()] = ann
+		}
+	}
+
+	return annotations, nil
+}
+
+// applyColumnAnnotations removes the hidden columns from an insert, select or update permission of
+// the role and presets the columns set from session variables on insert and update. All columns are
+// expanded when some of them are hidden or preset, even with KeepAllColumns.
+func applyColumnAnnotations(node *gen.Type, role, operation string, permission map[string]interface{}) (map[string]interface{}, error) {
+	annotations, err := columnAnnotations(node)
+	if err != nil || len(annotations) == 0 {
+		return permission, err
+	}
+
+	applied := make(map[string]interface{}, len(permission))
+	for key, value := range permission {
+		applied[key] = value
+	}
+
+	presets := operation == "insert" || operation == "update"
+
+	columns, isList := permissionColumnList(permission["columns"])
+	if !isList && permission["columns"] == string(AllColumns) && restrictsColumns(annotations, role, presets) {
+		logrus.Infof("expanding all columns of %s in %s permission of role %s to leave out hidden and preset columns", node.Name, operation, role)
+		columns, isList = nodeColumns(node, nil), true
+	}
+
+	kept := []string{}
+
+	for _, column := range columns {
+		ann := annotations[column]
+
+		switch {
+		case ann == nil:
+			kept = append(kept, column)
+		case ann.hiddenFrom(role):
+			logrus.Infof("hiding column %s of %s from %s permission of role %s", column, node.Name, operation, role)
+		case presets && ann.Preset != "":
+			logrus.Infof("presetting column %s of %s from %s on %s permission of role %s", column, node.Name, ann.Preset, operation, role)
+		default:
+			kept = append(kept, column)
+		}
+	}
+
+	if isList {
+		applied["columns"] = kept
+	}
+
+	if !presets {
+		return applied, nil
+	}
+
+	set := map[string]interface{}{}
+	if current, isOk := permission["set"].(map[string]interface{}); isOk {
+		for key, value := range current {
+			set[key] = value
+		}
+	}
+
+	for column, ann := range annotations {
+		if _, isSet := set[column]; ann.Preset != "" && !isSet {
+			set[column] = ann.Preset
+		}
+	}
+
+	if len(set) > 0 {
+		applied["set"] = set
+	}
+
+	return applied, nil
+}
+
+// restrictsColumns reports whether a column is hidden from the role or, on insert and update, preset.
+func restrictsColumns(annotations map[string]*ColumnAnnotation, role string, presets bool) bool {
+	for _, ann := range annotations {
+		if ann.hiddenFrom(role) || (presets && ann.Preset != "") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// permissionColumnList returns the columns of a permission, false when it uses all columns.
+func permissionColumnList(columns interface{}) ([]string, bool) {
+	switch columns := columns.(type) {
+	case []string:
+		return columns, true
+	case []interface{}:
+		list := []string{}
+		for _, column := range columns {
+			if column, isOk := column.(string); isOk {
+				list = append(list, column)
+			}
+		}
+
+		return list, true
+	case metadata.PGColumns:
+		return columns, true
+	}
+
+	return nil, false
+}
+
+// columnConfig returns the column config of the table of the node: the custom names of the
+// columns and the descriptions declared with ColumnAnnotation.
+func columnConfig(node *gen.Type, customNames map[string]string) (map[string]*ColumnConfig, error) {
+	annotations, err := columnAnnotations(node)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	config := map[string]*ColumnConfig{}
+
+	for column, ann := range annotations {
+		if ann.Description == "" {
+			continue
+		}
+
+		config[column] = &ColumnConfig{CustomName: customNames[column], Comment: ann.Description}
+	}
+
+	if len(config) == 0 {
+		return nil, nil
+	}
+
+	return config, nil
+}
@@ -0,0 +1,203 @@
+package enthasura_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	enthasura "github.com/minskylab/ent-hasura"
+)
+
+// Vault has a column hidden from every role and one preset from the session, Label has none.
+type Vault struct {
+	ent.Schema
+}
+
+func (Vault) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name"),
+		field.String("secret").Annotations(enthasura.Hidden()),
+		field.String("owner").Annotations(enthasura.PresetFromSession(enthasura.XHasuraUserID)),
+	}
+}
+
+func (Vault) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		enthasura.Permissions(
+			enthasura.PermissionsRoleAnnotation{
+				Role:             "admin",
+				KeepAllColumns:   true,
+				InsertPermission: &enthasura.InsertPermission{Columns: enthasura.AllColumns, Check: enthasura.M{}},
+				SelectPermission: &enthasura.SelectPermission{Columns: enthasura.AllColumns, Filter: enthasura.M{}},
+			},
+			enthasura.PermissionsRoleAnnotation{
+				Role:             "user",
+				SelectPermission: &enthasura.SelectPermission{Columns: enthasura.AllColumns, Filter: enthasura.M{}},
+			},
+		),
+	}
+}
+
+type Label struct {
+	ent.Schema
+}
+
+func (Label) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name"),
+	}
+}
+
+func (Label) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		enthasura.PermissionsRoleAnnotation{
+			Role:             "admin",
+			KeepAllColumns:   true,
+			SelectPermission: &enthasura.SelectPermission{Columns: enthasura.AllColumns, Filter: enthasura.M{}},
+		},
+	}
+}
+
+func TestColumnAnnotationsWithAllColumns(t *testing.T) {
+	m, err := enthasura.BuildMetadata(loadGraph(t, Vault{}, Label{}))
+	if err != nil {
+		t.Fatalf("building metadata: %+v", err)
+	}
+
+	vaults := findTable(t, m.Sources[0], "vaults")
+	labels := findTable(t, m.Sources[0], "labels")
+
+	tests := []struct {
+		name        string
+		permissions []*enthasura.RolePermission
+		role        string
+		columns     string
+		set         string
+	}{
+		{name: "admin insert", permissions: vaults.InsertPermissions, role: "admin", columns: `["id","name"]`, set: `{"owner":"X-Hasura-User-Id"}`},
+		{name: "admin select", permissions: vaults.SelectPermissions, role: "admin", columns: `["id","name","owner"]`},
+		{name: "user select", permissions: vaults.SelectPermissions, role: "user", columns: `["id","name","owner"]`},
+		{name: "unannotated", permissions: labels.SelectPermissions, role: "admin", columns: `"*"`},
+	}
+
+	for _, test := range tests {
+		var perm *enthasura.RolePermission
+		for _, p := range test.permissions {
+			if p.Role == test.role {
+				perm = p
+			}
+		}
+
+		if perm == nil {
+			t.Fatalf("%s: no permission for role %s", test.name, test.role)
+		}
+
+		if got := jsonString(t, perm.Permission["columns"]); got != test.columns {
+			t.Errorf("%s: columns: got %s, want %s", test.name, got, test.columns)
+		}
+
+		if _, isSet := perm.Permission["set"]; test.set != "" || isSet {
+			if got := jsonString(t, perm.Permission["set"]); got != test.set {
+				t.Errorf("%s: set: got %s, want %s", test.name, got, test.set)
+			}
+		}
+	}
+}
+
+// Invoice has a foreign key field of the customer edge renamed with a column annotation.
+type Invoice struct {
+	ent.Schema
+}
+
+func (Invoice) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("customer_id").Annotations(enthasura.GraphQLName("buyerID"), enthasura.Description("the buyer")),
+	}
+}
+
+func (Invoice) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("customer", Customer.Type).Ref("invoices").Field("customer_id").Unique().Required(),
+	}
+}
+
+type Customer struct {
+	ent.Schema
+}
+
+func (Customer) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("invoices", Invoice.Type),
+	}
+}
+
+func TestColumnAnnotationOnForeignKey(t *testing.T) {
+	m, err := enthasura.BuildMetadata(loadGraph(t, Customer{}, Invoice{}))
+	if err != nil {
+		t.Fatalf("building metadata: %+v", err)
+	}
+
+	config := findTable(t, m.Sources[0], "invoices").Configuration
+
+	if name := config.CustomColumnNames["customer_id"]; name != "buyerID" {
+		t.Errorf("custom column name of customer_id: got %s, want buyerID", name)
+	}
+
+	assertSameJSON(t, config.ColumnConfig, map[string]interface{}{
+		"customer_id": map[string]interface{}{"custom_name": "buyerID", "comment": "the buyer"},
+	})
+}
+
+// invalidColumnAnnotation has the name of ColumnAnnotation but a field of another type.
+type invalidColumnAnnotation struct {
+	Hidden string `json:"hidden"`
+}
+
+func (invalidColumnAnnotation) Name() string {
+	return "hasura-column"
+}
+
+type Broken struct {
+	ent.Schema
+}
+
+func (Broken) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name").Annotations(invalidColumnAnnotation{Hidden: "yes"}),
+	}
+}
+
+func (Broken) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		enthasura.PermissionsRoleAnnotation{
+			Role:             "user",
+			SelectPermission: &enthasura.SelectPermission{Columns: enthasura.AllColumns, Filter: enthasura.M{}},
+		},
+	}
+}
+
+func TestColumnAnnotationDecodeError(t *testing.T) {
+	graph := loadGraph(t, Broken{})
+
+	if _, err := enthasura.BuildMetadata(graph); err == nil {
+		t.Error("expected an error building the metadata of an invalid column annotation")
+	}
+
+	if _, err := enthasura.BuildQueries(graph); err == nil {
+		t.Error("expected an error building the queries of an invalid column annotation")
+	}
+}
+
+func jsonString(t *testing.T, v interface{}) string {
+	t.Helper()
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
@@ -1,8 +1,37 @@
 package enthasura
 
+// Config holds the verbs used to build the root field names of every table.
 type Config struct {
-	InsertVerbName    string
-	UpdateVerbName    string
-	DeleteVerbName    string
-	AggregateVerbName string
+	InsertVerbName    string `json:"insert_verb,omitempty"`
+	UpdateVerbName    string `json:"update_verb,omitempty"`
+	DeleteVerbName    string `json:"delete_verb,omitempty"`
+	AggregateVerbName string `json:"aggregate_verb,omitempty"`
+}
+
+var DefaultConfig = Config{
+	InsertVerbName:    insertVerbName,
+	UpdateVerbName:    updateVerbName,
+	DeleteVerbName:    deleteVerbName,
+	AggregateVerbName: aggregateVerbName,
+}
+
+// withDefaults fills the empty verbs with the default ones.
+func (c Config) withDefaults() Config {
+	if c.InsertVerbName == "" {
+		c.InsertVerbName = DefaultConfig.InsertVerbName
+	}
+
+	if c.UpdateVerbName == "" {
+		c.UpdateVerbName = DefaultConfig.UpdateVerbName
+	}
+
+	if c.DeleteVerbName == "" {
+		c.DeleteVerbName = DefaultConfig.DeleteVerbName
+	}
+
+	if c.AggregateVerbName == "" {
+		c.AggregateVerbName = DefaultConfig.AggregateVerbName
+	}
+
+	return c
 }
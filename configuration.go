@@ -1,117 +1,191 @@
 package enthasura
 
-// func enhanceHasuraTable(source *metadata.Source, table *metadata.TableDefinition) {
-// 	for i, iTable := range source.Tables {
-// 		qName, _ := iTable.Table.(metadata.QualifiedTableName)
-
-// 		if qName.Schema != qName.Schema || qName.Name != qName.Name {
-// 			continue
-// 		}
-
-// 		if source.Tables[i].Configuration == nil {
-// 			source.Tables[i].Configuration = &metadata.TableConfiguration{}
-// 		}
-
-// 		if source.Tables[i].Configuration.CustomName == "" {
-// 			source.Tables[i].Configuration.CustomName = table.Configuration.CustomName
-// 		}
-
-// 		if source.Tables[i].Configuration.CustomRootFields == nil {
-// 			source.Tables[i].Configuration.CustomRootFields = &metadata.CustomRootFields{}
-// 		}
-
-// 		if source.Tables[i].Configuration.CustomRootFields.Insert == "" {
-// 			source.Tables[i].Configuration.CustomRootFields.Insert = table.Configuration.CustomRootFields.Insert
-// 		}
-
-// 		if source.Tables[i].Configuration.CustomRootFields.InsertOne == "" {
-// 			source.Tables[i].Configuration.CustomRootFields.InsertOne = table.Configuration.CustomRootFields.InsertOne
-// 		}
-
-// 		if source.Tables[i].Configuration.CustomRootFields.Update == "" {
-// 			source.Tables[i].Configuration.CustomRootFields.Update = table.Configuration.CustomRootFields.Update
-// 		}
-
-// 		if source.Tables[i].Configuration.CustomRootFields.UpdateByPk == "" {
-// 			source.Tables[i].Configuration.CustomRootFields.UpdateByPk = table.Configuration.CustomRootFields.UpdateByPk
-// 		}
-
-// 		if source.Tables[i].Configuration.CustomRootFields.Select == "" {
-// 			source.Tables[i].Configuration.CustomRootFields.Select = table.Configuration.CustomRootFields.Select
-// 		}
-
-// 		if source.Tables[i].Configuration.CustomRootFields.Delete == "" {
-// 			source.Tables[i].Configuration.CustomRootFields.Delete = table.Configuration.CustomRootFields.Delete
-// 		}
-
-// 		if source.Tables[i].Configuration.CustomRootFields.DeleteByPk == "" {
-// 			source.Tables[i].Configuration.CustomRootFields.DeleteByPk = table.Configuration.CustomRootFields.DeleteByPk
-// 		}
-
-// 		if source.Tables[i].Configuration.CustomRootFields.SelectAggregate == "" {
-// 			source.Tables[i].Configuration.CustomRootFields.SelectAggregate = table.Configuration.CustomRootFields.SelectAggregate
-// 		}
-
-// 		if source.Tables[i].Configuration.CustomRootFields.SelectByPk == "" {
-// 			source.Tables[i].Configuration.CustomRootFields.SelectByPk = table.Configuration.CustomRootFields.SelectByPk
-// 		}
-
-// 		source.Tables[i].Configuration.CustomColumnNames = table.Configuration.CustomColumnNames
-
-// 		source.Tables[i].ObjectRelationships = table.ObjectRelationships
-// 		source.Tables[i].ArrayRelationships = table.ArrayRelationships
-// 	}
-// }
-
-// func enhancedHasuraConfigurationAndRelationships(initial *HasuraMetadata, schema *gen.Graph, sourceName, schemaName string, overrideTables bool) error {
-// 	initial.ResourceVersion += 1
-
-// 	tables, err := obtainHasuraTablesFromEntSchema(schema, schemaName)
-// 	if err != nil {
-// 		return err
-// 	}
-
-// 	for _, source := range initial.Metadata.Sources {
-// 		if source.Name == sourceName {
-// 			if overrideTables {
-// 				source.Tables = tables
-// 				break
-// 			}
-
-// 			for _, table := range tables {
-// 				enhanceHasuraTable(source, table)
-// 			}
-// 		}
-// 	}
-
-// 	return nil
-// }
-
-// func GenerateHasuraConfigurationAndRelationships(schemaRoute string, outputFile, inputFile, source, schemaName string, overrideTables bool, defaultRole string) error {
-// 	graph, err := entc.LoadGraph(schemaRoute, &gen.Config{})
-// 	if err != nil {
-// 		return errors.WithStack(err)
-// 	}
-
-// 	if inputFile == "" { // If input file is not specified, use the default
-// 		return generateRawMetadata(graph, schemaName, outputFile)
-// 	}
-
-// 	initialMetadata, err := parseHasuraMetadata(inputFile)
-// 	if err != nil {
-// 		return errors.WithStack(err)
-// 	}
-
-// 	if defaultRole != "" {
-// 		err := enhancedHasuraPermissions(initialMetadata, graph, source, defaultRole, schemaName)
-// 		if err != nil {
-// 			return errors.WithStack(err)
-// 		}
-// 	}
-
-// 	if err := enhancedHasuraConfigurationAndRelationships(initialMetadata, graph, source, schemaName, overrideTables); err != nil {
-// 		return errors.WithStack(err)
-// 	}
-
-// 	return generateFile(*initialMetadata, outputFile)
-// }
+import (
+	"entgo.io/ent/entc"
+	"entgo.io/ent/entc/gen"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// HasuraMetadataConfig configures the offline generation of a Hasura metadata file.
+type HasuraMetadataConfig struct {
+	SchemaPath         string
+	SchemaName         string
+	Source             string
+	OutputMetadataFile string
+	MetadataInput      string
+	MetadataDirectory  string
+	DefaultRole        string
+	OverrideTables     bool
+	Naming             NamingStrategy
+	Actions            []*Action
+}
+
+var DefaultHasuraMetadataConfig = HasuraMetadataConfig{
+	SchemaPath:         "./ent/schema",
+	SchemaName:         "public",
+	Source:             "default",
+	OutputMetadataFile: "hasura/metadata.json",
+}
+
+// CreateDefaultMetadataFromSchema loads the ent schema and writes the complete Hasura metadata
+// (tables, customizations, relationships and permissions) without contacting a Hasura server.
+func CreateDefaultMetadataFromSchema(config *HasuraMetadataConfig) error {
+	graph, err := entc.LoadGraph(config.SchemaPath, &gen.Config{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return createMetadataFromGraph(graph, config)
+}
+
+// createMetadataFromGraph writes the metadata file and directory of the config from a loaded graph.
+func createMetadataFromGraph(graph *gen.Graph, config *HasuraMetadataConfig) error {
+	generated, err := hasuraMetadataFromEntSchema(graph, config.Source, config.SchemaName, config.DefaultRole, config.Naming)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := addActionsMetadata(generated, config.Actions); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if config.MetadataDirectory != "" {
+		if err := ExportMetadataDirectory(generated, config.MetadataDirectory); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if config.OutputMetadataFile == "" {
+		return nil
+	}
+
+	if config.MetadataInput == "" { // If input file is not specified, use the default
+		return generateFile(generated, config.OutputMetadataFile)
+	}
+
+	initialMetadata, err := parseHasuraMetadata(config.MetadataInput)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	enhanceHasuraMetadata(initialMetadata.Metadata, generated, config.OverrideTables)
+
+	return generateFile(initialMetadata.Metadata, config.OutputMetadataFile)
+}
+
+func hasuraMetadataFromEntSchema(graph *gen.Graph, sourceName, schemaName, defaultRole string, naming NamingStrategy) (*Metadata, error) {
+	tables, err := obtainHasuraTablesFromEntSchema(graph, schemaName, naming)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	source := newSource(sourceName)
+	source.Tables = append(source.Tables, tables...)
+
+	permissions, err := permissionsQueries(graph, sourceName, schemaName, defaultRole, naming)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, bulk := range [][]metadata.MetadataQuery{permissions.inserts, permissions.selects, permissions.updates, permissions.deletes} {
+		for _, query := range bulk {
+			if err := applyPermissionQuery(source, query); err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+	}
+
+	triggers, err := eventTriggersQueries(graph, sourceName, schemaName)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, query := range triggers {
+		if err := applyEventTriggerQuery(source, query); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return &Metadata{
+		Version: metadataVersion,
+		Sources: []*Source{source},
+	}, nil
+}
+
+// enhanceHasuraMetadata merges the generated sources into the initial metadata. Tables owned by ent
+// are replaced (keeping permissions of roles not declared in the ent schema), other tables are kept
+// untouched unless overrideTables is set.
+func enhanceHasuraMetadata(initial, generated *Metadata, overrideTables bool) {
+	if initial.Version == 0 {
+		initial.Version = metadataVersion
+	}
+
+	if generated.CustomTypes != nil {
+		initial.CustomTypes = mergeCustomTypes(initial.CustomTypes, generated.CustomTypes)
+	}
+
+	for _, action := range generated.Actions {
+		if action, isOk := action.(*ActionMetadata); isOk {
+			initial.Actions = setAction(initial.Actions, action)
+		}
+	}
+
+	for _, genSource := range generated.Sources {
+		source := initial.source(genSource.Name)
+		if source == nil {
+			initial.Sources = append(initial.Sources, genSource)
+			continue
+		}
+
+		if overrideTables {
+			source.Tables = genSource.Tables
+			continue
+		}
+
+		for _, table := range genSource.Tables {
+			enhanceHasuraTable(source, table)
+		}
+	}
+}
+
+func enhanceHasuraTable(source *Source, table *Table) {
+	current := source.table(table.Table.Schema, table.Table.Name)
+	if current == nil {
+		logrus.Debugf("adding table %s.%s to source %s", table.Table.Schema, table.Table.Name, source.Name)
+		source.Tables = append(source.Tables, table)
+		return
+	}
+
+	// the fields of the configuration not generated from the schema, e.g. its comment, are kept
+	if current.Configuration != nil && table.Configuration != nil && table.Configuration.Extra == nil {
+		table.Configuration.Extra = current.Configuration.Extra
+	}
+
+	current.Configuration = table.Configuration
+	current.ObjectRelationships = table.ObjectRelationships
+	current.ArrayRelationships = table.ArrayRelationships
+
+	for _, perm := range table.InsertPermissions {
+		current.InsertPermissions = setRolePermission(current.InsertPermissions, perm)
+	}
+
+	for _, perm := range table.SelectPermissions {
+		current.SelectPermissions = setRolePermission(current.SelectPermissions, perm)
+	}
+
+	for _, perm := range table.UpdatePermissions {
+		current.UpdatePermissions = setRolePermission(current.UpdatePermissions, perm)
+	}
+
+	for _, perm := range table.DeletePermissions {
+		current.DeletePermissions = setRolePermission(current.DeletePermissions, perm)
+	}
+
+	for _, trigger := range table.EventTriggers {
+		if trigger, isOk := trigger.(*EventTrigger); isOk {
+			current.EventTriggers = setEventTrigger(current.EventTriggers, trigger)
+		}
+	}
+}
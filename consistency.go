@@ -0,0 +1,233 @@
+package enthasura
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"entgo.io/ent/entc/gen"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// InconsistencyPolicy decides what a transform does when Hasura reports inconsistent objects
+// produced by the ent schema once every phase is applied.
+type InconsistencyPolicy string
+
+const (
+	// InconsistencyFail fails the transform and keeps the applied metadata, the default.
+	InconsistencyFail InconsistencyPolicy = "fail"
+	// InconsistencyRollback replaces the metadata with the exact document exported before the
+	// transform and fails it. Without that document, e.g. from a MetadataClient that does not set
+	// HasuraMetadata.Raw, the transform fails without rolling back.
+	InconsistencyRollback InconsistencyPolicy = "rollback"
+	// InconsistencyAllow only logs the inconsistent objects.
+	InconsistencyAllow InconsistencyPolicy = "allow"
+)
+
+// InconsistentMetadata is the response of get_inconsistent_metadata.
+type InconsistentMetadata struct {
+	IsConsistent        bool                  `json:"is_consistent"`
+	InconsistentObjects []*InconsistentObject `json:"inconsistent_objects"`
+}
+
+// InconsistentObject is a metadata object Hasura could not load, e.g. a relationship on a column
+// that does not exist. Origin is the ent node, edge or permission it was generated from.
+type InconsistentObject struct {
+	Type       string          `json:"type"`
+	Name       string          `json:"name,omitempty"`
+	Reason     string          `json:"reason"`
+	Definition json.RawMessage `json:"definition,omitempty"`
+	Origin     *QueryOrigin    `json:"-"`
+}
+
+func (o *InconsistentObject) String() string {
+	// the name given by Hasura already starts with the type, e.g. "object_relation author in table posts"
+	msg := o.Type
+	if o.Name != "" {
+		msg = o.Name
+	}
+
+	msg += ": " + o.Reason
+
+	if o.Origin != nil {
+		msg += " from " + o.Origin.String()
+	}
+
+	return msg
+}
+
+var inconsistentObjectOperations = map[string]string{
+	"table":             queryOperations[metadata.PgTrackTable],
+	"object_relation":   queryOperations[metadata.PgCreateObjectRelationship],
+	"array_relation":    queryOperations[metadata.PgCreateArrayRelationship],
+	"insert_permission": queryOperations[metadata.PgCreateInsertPermission],
+	"select_permission": queryOperations[metadata.PgCreateSelectPermission],
+	"update_permission": queryOperations[metadata.PgCreateUpdatePermission],
+	"delete_permission": queryOperations[metadata.PgCreateDeletePermission],
+	"event_trigger":     queryOperations[metadata.PgCreateEventTrigger],
+	"action":            queryOperations[metadata.CreateAction],
+	"custom_types":      queryOperations[metadata.SetCustomTypes],
+}
+
+// inconsistentDefinition holds the fields of the definitions of inconsistent objects used to find
+// their origin.
+type inconsistentDefinition struct {
+	Table         json.RawMessage `json:"table"`
+	Name          json.RawMessage `json:"name"`
+	Role          string          `json:"role"`
+	Configuration struct {
+		Name string `json:"name"`
+	} `json:"configuration"`
+}
+
+// inconsistentObjectOrigin finds the ent node, edge, role or action an inconsistent object was
+// generated from. The origin has no node nor action when the object is not from the ent schema.
+func inconsistentObjectOrigin(graph *gen.Graph, schemaName string, naming NamingStrategy, obj *InconsistentObject) *QueryOrigin {
+	naming = namingOrDefault(naming)
+	origin := &QueryOrigin{Operation: inconsistentObjectOperations[obj.Type]}
+
+	def := inconsistentDefinition{}
+	if err := json.Unmarshal(obj.Definition, &def); err != nil {
+		logrus.Debugf("decoding definition of inconsistent %s: %s", obj.Type, err)
+	}
+
+	var name string
+	_ = json.Unmarshal(def.Name, &name)
+
+	if obj.Type == "action" {
+		origin.Action = name
+		return origin
+	}
+
+	if graph == nil {
+		return origin
+	}
+
+	table := tableNameFromJSON(def.Table)
+
+	switch {
+	case obj.Type == "table":
+		// the definition of a table is its name, alone or with the source
+		table = tableNameFromJSON(obj.Definition)
+		if table.Name == "" {
+			table = tableNameFromJSON(def.Name)
+		}
+		name = ""
+	case obj.Type == "event_trigger":
+		name = def.Configuration.Name
+	case strings.HasSuffix(obj.Type, "_permission"):
+		origin.Role, name = def.Role, ""
+	}
+
+	if table.Name == "" {
+		return origin
+	}
+
+	return tableOrigin(graph, newTableSchemas(graph, schemaName), naming, origin, table, name)
+}
+
+// tableNameFromJSON returns a table given as a plain or a schema qualified name, in the public
+// schema when it is given by name.
+func tableNameFromJSON(data json.RawMessage) metadata.QualifiedTableName {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		return qualifiedTableName(metadata.TableName(name))
+	}
+
+	table := struct {
+		Schema interface{} `json:"schema"`
+		Name   interface{} `json:"name"`
+	}{}
+
+	if err := json.Unmarshal(data, &table); err != nil {
+		return metadata.QualifiedTableName{}
+	}
+
+	qualified := metadata.QualifiedTableName{}
+	qualified.Schema, _ = table.Schema.(string)
+	qualified.Name, _ = table.Name.(string)
+
+	return qualifiedTableName(qualified)
+}
+
+// metadataBeforeApply exports the raw metadata document a rollback would restore, nil unless the
+// policy is InconsistencyRollback.
+func (r *Runtime) metadataBeforeApply() (json.RawMessage, error) {
+	if r.inconsistency != InconsistencyRollback {
+		return nil, nil
+	}
+
+	before, err := r.hasura.ExportMetadata()
+	if err != nil {
+		return nil, errors.WithMessage(errors.WithStack(err), "error exporting metadata before apply")
+	}
+
+	return before.Raw, nil
+}
+
+// checkConsistency reports the objects Hasura marks inconsistent after an apply. Objects produced
+// by the ent schema fail the transform unless the policy allows them, and with InconsistencyRollback
+// the raw document exported before the transform is restored as is.
+func (r *Runtime) checkConsistency(graph *gen.Graph, schemaName string, before json.RawMessage) error {
+	inconsistent, err := r.hasura.GetInconsistentMetadata()
+	if err != nil {
+		return errors.WithMessage(err, "error getting inconsistent metadata")
+	}
+
+	if inconsistent.IsConsistent || len(inconsistent.InconsistentObjects) == 0 {
+		return nil
+	}
+
+	objects := []*InconsistentObject{}
+
+	for _, obj := range inconsistent.InconsistentObjects {
+		obj.Origin = inconsistentObjectOrigin(graph, schemaName, r.naming, obj)
+
+		if obj.Origin.Action != "" && !r.hasAction(obj.Origin.Action) {
+			obj.Origin.Action = ""
+		}
+
+		if obj.Origin.Node == "" && obj.Origin.Action == "" {
+			logrus.Warnf("inconsistent object not produced by the ent schema: %s", obj)
+			continue
+		}
+
+		logrus.Warnf("inconsistent object: %s", obj)
+		objects = append(objects, obj)
+	}
+
+	if len(objects) == 0 || r.inconsistency == InconsistencyAllow {
+		return nil
+	}
+
+	inconsistentErr := &InconsistentMetadataError{Objects: objects}
+
+	if r.inconsistency != InconsistencyRollback {
+		return inconsistentErr
+	}
+
+	if len(before) == 0 {
+		logrus.Warn("the metadata exported before the transform is not available, it is not rolled back")
+		return inconsistentErr
+	}
+
+	if err := r.replaceRawMetadata(before); err != nil {
+		return errors.WithMessage(err, fmt.Sprintf("error rolling back after %s", inconsistentErr))
+	}
+
+	inconsistentErr.RolledBack = true
+
+	return inconsistentErr
+}
+
+func (r *Runtime) hasAction(name string) bool {
+	for _, action := range r.actions {
+		if action.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
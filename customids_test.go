@@ -0,0 +1,112 @@
+package enthasura_test
+
+import (
+	"testing"
+
+	enthasura "github.com/minskylab/ent-hasura"
+	"github.com/minskylab/ent-hasura/testdata/fixtures/customids"
+)
+
+func customIDsMetadata(t *testing.T, opts ...enthasura.Option) *enthasura.Source {
+	t.Helper()
+
+	m, err := enthasura.BuildMetadata(loadGraph(t, customids.Schemas...), opts...)
+	if err != nil {
+		t.Fatalf("building metadata: %+v", err)
+	}
+
+	return m.Sources[0]
+}
+
+func TestCustomIDsByPkRootFields(t *testing.T) {
+	tests := []struct {
+		naming enthasura.NamingStrategy
+		table  string
+		byPk   [3]string
+	}{
+		{naming: enthasura.NewDefaultNaming(enthasura.DefaultConfig), table: "orgs", byPk: [3]string{"org", "updateOrg", "deleteOrg"}},
+		{naming: enthasura.NewDefaultNaming(enthasura.DefaultConfig), table: "members", byPk: [3]string{"member", "updateMember", "deleteMember"}},
+		{naming: enthasura.NewDefaultNaming(enthasura.DefaultConfig), table: "sessions", byPk: [3]string{"session", "updateSession", "deleteSession"}},
+		{naming: enthasura.NewDefaultNaming(enthasura.DefaultConfig), table: "org_members", byPk: [3]string{"orgMember", "updateOrgMember", "deleteOrgMember"}},
+		{naming: enthasura.NewGraphQLDefaultNaming(enthasura.DefaultConfig), table: "sessions", byPk: [3]string{"sessionsByPk", "updateSessionsByPk", "deleteSessionsByPk"}},
+		{naming: enthasura.NewGraphQLDefaultNaming(enthasura.DefaultConfig), table: "org_members", byPk: [3]string{"orgMembersByPk", "updateOrgMembersByPk", "deleteOrgMembersByPk"}},
+		{naming: enthasura.NewSnakeCaseNaming(enthasura.DefaultConfig), table: "orgs", byPk: [3]string{"orgs_by_pk", "update_orgs_by_pk", "delete_orgs_by_pk"}},
+		{naming: enthasura.NewSnakeCaseNaming(enthasura.DefaultConfig), table: "org_members", byPk: [3]string{"org_members_by_pk", "update_org_members_by_pk", "delete_org_members_by_pk"}},
+	}
+
+	for _, test := range tests {
+		source := customIDsMetadata(t, enthasura.WithNaming(test.naming))
+		fields := findTable(t, source, test.table).Configuration.CustomRootFields
+
+		if got := [3]string{fields.SelectByPk, fields.UpdateByPk, fields.DeleteByPk}; got != test.byPk {
+			t.Errorf("%T %s: by_pk root fields: got %v, want %v", test.naming, test.table, got, test.byPk)
+		}
+	}
+}
+
+func TestCustomIDsPermissionColumns(t *testing.T) {
+	source := customIDsMetadata(t)
+
+	tests := []struct {
+		name        string
+		permissions []*enthasura.RolePermission
+		columns     string
+	}{
+		{name: "uuid id", permissions: findTable(t, source, "orgs").SelectPermissions, columns: `["id","name"]`},
+		{name: "string id", permissions: findTable(t, source, "members").SelectPermissions, columns: `["id","email"]`},
+		{name: "immutable string id", permissions: findTable(t, source, "members").UpdatePermissions, columns: `["email"]`},
+		{name: "prefixed id", permissions: findTable(t, source, "sessions").InsertPermissions, columns: `["id","expires_at","member_sessions"]`},
+		{name: "join table", permissions: findTable(t, source, "org_members").SelectPermissions, columns: `["org_id","member_id"]`},
+	}
+
+	for _, test := range tests {
+		if len(test.permissions) != 1 {
+			t.Fatalf("%s: got %d permissions, want 1", test.name, len(test.permissions))
+		}
+
+		if got := jsonString(t, test.permissions[0].Permission["columns"]); got != test.columns {
+			t.Errorf("%s: columns: got %s, want %s", test.name, got, test.columns)
+		}
+	}
+}
+
+func TestCustomIDsRelationshipColumns(t *testing.T) {
+	source := customIDsMetadata(t)
+
+	tests := []struct {
+		name  string
+		rel   *enthasura.Relationship
+		using string
+	}{
+		{
+			name:  "string foreign key",
+			rel:   relationship(t, findTable(t, source, "sessions").ObjectRelationships, "member"),
+			using: `{"foreign_key_constraint_on":"member_sessions"}`,
+		},
+		{
+			name:  "string id referenced",
+			rel:   relationship(t, findTable(t, source, "members").ArrayRelationships, "sessions"),
+			using: `{"foreign_key_constraint_on":{"table":{"schema":"public","name":"sessions"},"column":"member_sessions"}}`,
+		},
+		{
+			name:  "uuid column of the join table",
+			rel:   relationship(t, findTable(t, source, "org_members").ObjectRelationships, "org"),
+			using: `{"foreign_key_constraint_on":"org_id"}`,
+		},
+		{
+			name:  "string column of the join table",
+			rel:   relationship(t, findTable(t, source, "org_members").ObjectRelationships, "member"),
+			using: `{"foreign_key_constraint_on":"member_id"}`,
+		},
+	}
+
+	for _, test := range tests {
+		if got := jsonString(t, test.rel.Using); got != test.using {
+			t.Errorf("%s: using: got %s, want %s", test.name, got, test.using)
+		}
+	}
+
+	if names := findTable(t, source, "sessions").Configuration.CustomColumnNames; names["member_sessions"] != "memberID" || names["expires_at"] != "expiresAt" {
+		t.Errorf("custom column names of sessions: %v", names)
+	}
+}
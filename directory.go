@@ -0,0 +1,185 @@
+package enthasura
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+)
+
+const includeDirective = "!include "
+
+// ExportMetadataDirectory writes the metadata using the Hasura CLI v3 directory layout, ready to be
+// consumed by `hasura metadata apply`. If the directory already exists the generated tables are
+// merged into it, tables not owned by ent are left untouched.
+func ExportMetadataDirectory(m *Metadata, metadataDir string) error {
+	if err := writeYAML(filepath.Join(metadataDir, "version.yaml"), map[string]interface{}{"version": metadataVersion}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	databasesDir := filepath.Join(metadataDir, "databases")
+
+	databases, err := readDatabases(databasesDir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if len(m.Actions) > 0 {
+		logrus.Warn("actions are not exported to the metadata directory, use the metadata file instead")
+	}
+
+	for _, source := range m.Sources {
+		if err := exportSourceTables(databasesDir, source); err != nil {
+			return errors.WithStack(err)
+		}
+
+		databases = mergeDatabase(databases, source)
+	}
+
+	return writeYAML(filepath.Join(databasesDir, "databases.yaml"), databases)
+}
+
+func readDatabases(databasesDir string) ([]interface{}, error) {
+	databases := []interface{}{}
+
+	if err := readYAML(filepath.Join(databasesDir, "databases.yaml"), &databases); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return databases, nil
+}
+
+func mergeDatabase(databases []interface{}, source *Source) []interface{} {
+	tablesInclude := includeDirective + filepath.ToSlash(filepath.Join(source.Name, "tables", "tables.yaml"))
+
+	for _, database := range databases {
+		db, isOk := database.(map[string]interface{})
+		if !isOk || db["name"] != source.Name {
+			continue
+		}
+
+		db["tables"] = tablesInclude
+		return databases
+	}
+
+	return append(databases, map[string]interface{}{
+		"name":          source.Name,
+		"kind":          source.Kind,
+		"configuration": source.Configuration,
+		"tables":        tablesInclude,
+	})
+}
+
+func exportSourceTables(databasesDir string, source *Source) error {
+	tablesDir := filepath.Join(databasesDir, source.Name, "tables")
+	tablesFile := filepath.Join(tablesDir, "tables.yaml")
+
+	includes := []string{}
+	if err := readYAML(tablesFile, &includes); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, table := range source.Tables {
+		filename := fmt.Sprintf("%s_%s.yaml", table.Table.Schema, table.Table.Name)
+		tableFile := filepath.Join(tablesDir, filename)
+
+		current := &Table{}
+		if err := readYAML(tableFile, current); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if current.Table.Name != "" {
+			logrus.Debugf("merging table %s.%s into %s", table.Table.Schema, table.Table.Name, tableFile)
+			enhanceHasuraTable(&Source{Tables: []*Table{current}}, table)
+			table = current
+		}
+
+		if err := writeYAML(tableFile, table); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if include := includeDirective + filename; !elementInArray(includes, include) {
+			includes = append(includes, include)
+		}
+	}
+
+	return writeYAML(tablesFile, includes)
+}
+
+// readYAML decodes a YAML file into out through its JSON representation, so the json tags of the
+// metadata types are honored. A missing file leaves out unchanged.
+func readYAML(filename string, out interface{}) error {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var raw interface{}
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return errors.Wrapf(err, "parsing %s", filename)
+	}
+
+	if raw == nil {
+		return nil
+	}
+
+	jsonData, err := json.Marshal(jsonCompatible(raw))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return errors.Wrapf(json.Unmarshal(jsonData, out), "decoding %s", filename)
+}
+
+// writeYAML encodes in through its JSON representation, so the json tags of the metadata types are honored.
+func writeYAML(filename string, in interface{}) error {
+	jsonData, err := json.Marshal(in)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var raw interface{}
+	if err := json.Unmarshal(jsonData, &raw); err != nil {
+		return errors.WithStack(err)
+	}
+
+	data, err := yaml.Marshal(raw)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return ioutil.WriteFile(filename, data, 0644)
+}
+
+// jsonCompatible converts the map[interface{}]interface{} values produced by yaml.v2 into
+// map[string]interface{} so they can be encoded as JSON.
+func jsonCompatible(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, val := range v {
+			m[fmt.Sprint(key)] = jsonCompatible(val)
+		}
+		return m
+	case []interface{}:
+		for i, val := range v {
+			v[i] = jsonCompatible(val)
+		}
+		return v
+	}
+
+	return value
+}
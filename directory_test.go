@@ -0,0 +1,96 @@
+package enthasura
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/minskylab/hasura-api/metadata"
+)
+
+func TestExportMetadataDirectoryKeepsUnknownFields(t *testing.T) {
+	dir, err := ioutil.TempDir("", "metadata")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"databases/databases.yaml": `- name: default
+  kind: postgres
+  configuration:
+    connection_info:
+      database_url:
+        from_env: HASURA_GRAPHQL_DATABASE_URL
+  customization:
+    root_fields:
+      namespace: db
+  tables: "!include default/tables/tables.yaml"
+`,
+		"databases/default/tables/tables.yaml": `- "!include public_notes.yaml"
+`,
+		"databases/default/tables/public_notes.yaml": `table:
+  schema: public
+  name: notes
+configuration:
+  comment: notes of the users
+  custom_name: Note
+apollo_federation_config:
+  enable: v1
+select_permissions:
+- role: auditor
+  permission:
+    columns: []
+    filter: {}
+`,
+	}
+
+	for name, content := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), os.ModePerm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	source := newSource("default")
+	source.Tables = []*Table{{
+		Table:         metadata.QualifiedTableName{Schema: "public", Name: "notes"},
+		Configuration: &TableConfiguration{TableConfiguration: metadata.TableConfiguration{CustomName: "Note"}},
+		SelectPermissions: []*RolePermission{
+			{Role: "user", Permission: map[string]interface{}{"columns": []string{"id"}, "filter": map[string]interface{}{}}},
+		},
+	}}
+
+	if err := ExportMetadataDirectory(&Metadata{Version: metadataVersion, Sources: []*Source{source}}, dir); err != nil {
+		t.Fatalf("exporting directory: %+v", err)
+	}
+
+	databases := readFile(t, filepath.Join(dir, "databases", "databases.yaml"))
+	if !strings.Contains(databases, "namespace: db") {
+		t.Errorf("source customization dropped from databases.yaml:\n%s", databases)
+	}
+
+	notes := readFile(t, filepath.Join(dir, "databases", "default", "tables", "public_notes.yaml"))
+	for _, want := range []string{"apollo_federation_config", "comment: notes of the users", "role: auditor", "role: user"} {
+		if !strings.Contains(notes, want) {
+			t.Errorf("%q missing from the merged table:\n%s", want, notes)
+		}
+	}
+}
+
+func readFile(t *testing.T, filename string) string {
+	t.Helper()
+
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(data)
+}
@@ -0,0 +1,208 @@
+package enthasura
+
+import (
+	"encoding/json"
+
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/schema"
+	"github.com/sirupsen/logrus"
+)
+
+const hasuraRelationshipAnnotationName = "hasura-relationship"
+
+// RelationshipAnnotation customizes the relationship of an ent edge. JoinSourceName and JoinTargetName
+// name the relationships of the join table of a M2M edge: the one to the node declaring the edge
+// and the one to the type of the edge. Manual uses a manual_configuration instead of the foreign
+// key, for edges whose columns are not backed by a foreign key constraint.
+type RelationshipAnnotation struct {
+	RelationshipName string `json:"name,omitempty"`
+	Skip             bool   `json:"skip,omitempty"`
+	JoinSourceName   string `json:"join_source_name,omitempty"`
+	JoinTargetName   string `json:"join_target_name,omitempty"`
+	Manual           bool   `json:"manual,omitempty"`
+}
+
+func (RelationshipAnnotation) Name() string {
+	return hasuraRelationshipAnnotationName
+}
+
+// Merge implements the schema.Merger interface, the values set in other win.
+func (a RelationshipAnnotation) Merge(other schema.Annotation) schema.Annotation {
+	var ann RelationshipAnnotation
+
+	switch other := other.(type) {
+	case RelationshipAnnotation:
+		ann = other
+	case *RelationshipAnnotation:
+		if other == nil {
+			return a
+		}
+		ann = *other
+	default:
+		return a
+	}
+
+	if ann.RelationshipName != "" {
+		a.RelationshipName = ann.RelationshipName
+	}
+
+	if ann.JoinSourceName != "" {
+		a.JoinSourceName = ann.JoinSourceName
+	}
+
+	if ann.JoinTargetName != "" {
+		a.JoinTargetName = ann.JoinTargetName
+	}
+
+	a.Skip = a.Skip || ann.Skip
+	a.Manual = a.Manual || ann.Manual
+
+	return a
+}
+
+var (
+	_ schema.Annotation = (*RelationshipAnnotation)(nil)
+	_ schema.Merger     = (*RelationshipAnnotation)(nil)
+)
+
+// RelationshipName renames the relationship of the edge.
+func RelationshipName(name string) RelationshipAnnotation {
+	return RelationshipAnnotation{RelationshipName: name}
+}
+
+// SkipRelationship does not create a relationship for the edge.
+func SkipRelationship() RelationshipAnnotation {
+	return RelationshipAnnotation{Skip: true}
+}
+
+// JoinNames names the relationships of the join table of a M2M edge, source points to the node
+// declaring the edge and target to the type of the edge.
+func JoinNames(source, target string) RelationshipAnnotation {
+	return RelationshipAnnotation{JoinSourceName: source, JoinTargetName: target}
+}
+
+// ManualRelationship maps the columns of the edge with a manual_configuration.
+func ManualRelationship() RelationshipAnnotation {
+	return RelationshipAnnotation{Manual: true}
+}
+
+func relationshipAnnotationFromEdge(edge *gen.Edge) *RelationshipAnnotation {
+	raw, isOk := edge.Annotations[hasuraRelationshipAnnotationName]
+	if !isOk || raw == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		logrus.Warn(err)
+		return nil
+	}
+
+	ann := &RelationshipAnnotation{}
+	if err := json.Unmarshal(data, ann); err != nil {
+		logrus.Warnf("decoding relationship annotation of %s: %s", edge.Name, err)
+		return nil
+	}
+
+	return ann
+}
+
+// relationshipName returns the name of the relationship of the edge.
+func relationshipName(naming NamingStrategy, edge *gen.Edge) string {
+	if ann := relationshipAnnotationFromEdge(edge); ann != nil && ann.RelationshipName != "" {
+		return ann.RelationshipName
+	}
+
+	return naming.RelationshipName(edge.Name)
+}
+
+func skipRelationship(edge *gen.Edge) bool {
+	ann := relationshipAnnotationFromEdge(edge)
+
+	return ann != nil && ann.Skip
+}
+
+func manualRelationship(edge *gen.Edge) bool {
+	ann := relationshipAnnotationFromEdge(edge)
+
+	return ann != nil && ann.Manual
+}
+
+// joinColumns returns the columns of the join table of a M2M edge pointing to the node declaring
+// the edge and to the type of the edge.
+func joinColumns(edge *gen.Edge) (string, string) {
+	if len(edge.Rel.Columns) < 2 {
+		return "", ""
+	}
+
+	if edge.IsInverse() {
+		return edge.Rel.Columns[1], edge.Rel.Columns[0]
+	}
+
+	return edge.Rel.Columns[0], edge.Rel.Columns[1]
+}
+
+// joinEdge is a M2M edge with the node declaring it.
+type joinEdge struct {
+	node *gen.Type
+	edge *gen.Edge
+}
+
+// joinColumnRelationshipName returns the name of the relationship of a join table column, as
+// declared in the M2M edges of the join table or derived from the column.
+func joinColumnRelationshipName(naming NamingStrategy, edges []joinEdge, column string) string {
+	for _, je := range edges {
+		ann := relationshipAnnotationFromEdge(je.edge)
+		if ann == nil {
+			continue
+		}
+
+		source, target := joinColumns(je.edge)
+
+		if column == source && ann.JoinSourceName != "" {
+			return ann.JoinSourceName
+		}
+
+		if column == target && ann.JoinTargetName != "" {
+			return ann.JoinTargetName
+		}
+	}
+
+	return joinRelationshipName(naming, column)
+}
+
+// manualJoinColumnTarget returns the node referenced by a join table column when one of the M2M
+// edges of the join table is a manual relationship.
+func manualJoinColumnTarget(edges []joinEdge, column string) *gen.Type {
+	for _, je := range edges {
+		if !manualRelationship(je.edge) {
+			continue
+		}
+
+		source, target := joinColumns(je.edge)
+
+		switch column {
+		case source:
+			return je.node
+		case target:
+			return je.edge.Type
+		}
+	}
+
+	return nil
+}
+
+// joinEdges returns the M2M edges of the graph by join table, with their inverse edges.
+func joinEdges(graph *gen.Graph) map[string][]joinEdge {
+	edges := map[string][]joinEdge{}
+
+	for _, node := range graph.Nodes {
+		for _, edge := range node.Edges {
+			if edge.M2M() {
+				edges[edge.Rel.Table] = append(edges[edge.Rel.Table], joinEdge{node: node, edge: edge})
+			}
+		}
+	}
+
+	return edges
+}
@@ -0,0 +1,104 @@
+package enthasura_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	enthasura "github.com/minskylab/ent-hasura"
+	"github.com/minskylab/ent-hasura/hasuratest"
+	"github.com/minskylab/ent-hasura/testdata/fixtures/edgeannotations"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+)
+
+func TestEdgeAnnotations(t *testing.T) {
+	m, err := enthasura.BuildMetadata(loadGraph(t, edgeannotations.Schemas...))
+	if err != nil {
+		t.Fatalf("building metadata: %+v", err)
+	}
+
+	source := m.Sources[0]
+	players := findTable(t, source, "players")
+
+	relationship(t, players.ArrayRelationships, "results")
+
+	for _, rel := range players.ArrayRelationships {
+		if rel.Name == "scores" || rel.Name == "audits" {
+			t.Errorf("players has the relationship %s", rel.Name)
+		}
+	}
+
+	tests := []struct {
+		name  string
+		rel   *enthasura.Relationship
+		using string
+	}{
+		{
+			name:  "renamed",
+			rel:   relationship(t, players.ArrayRelationships, "results"),
+			using: `{"foreign_key_constraint_on":{"table":{"schema":"public","name":"scores"},"column":"player_scores"}}`,
+		},
+		{
+			name:  "join source",
+			rel:   relationship(t, findTable(t, source, "team_players").ObjectRelationships, "squad"),
+			using: `{"foreign_key_constraint_on":"team_id"}`,
+		},
+		{
+			name:  "join target",
+			rel:   relationship(t, findTable(t, source, "team_players").ObjectRelationships, "member"),
+			using: `{"foreign_key_constraint_on":"player_id"}`,
+		},
+		{
+			name:  "manual",
+			rel:   relationship(t, findTable(t, source, "scores").ObjectRelationships, "player"),
+			using: `{"manual_configuration":{"remote_table":{"schema":"public","name":"players"},"column_mapping":{"player_scores":"id"}}}`,
+		},
+	}
+
+	for _, test := range tests {
+		if got := jsonString(t, test.rel.Using); got != test.using {
+			t.Errorf("%s: using: got %s, want %s", test.name, got, test.using)
+		}
+	}
+}
+
+func TestRenamedRelationshipOrigin(t *testing.T) {
+	graph := loadGraph(t, edgeannotations.Schemas...)
+
+	plan, err := enthasura.PlanFullGraphTransform(graph, "default", "public", nil)
+	if err != nil {
+		t.Fatalf("planning: %+v", err)
+	}
+
+	var origin *enthasura.QueryOrigin
+
+	for _, phase := range plan.Phases {
+		for i, query := range phase.Queries {
+			if args, isOk := query.Args.(*metadata.PgCreateArrayRelationshipArgs); isOk && args.Name == "results" {
+				origin = phase.Origins[i]
+			}
+		}
+	}
+
+	if origin == nil || origin.Node != "Player" || origin.Edge != "scores" {
+		t.Errorf("origin of results: got %s, want node Player and edge scores", origin)
+	}
+
+	client := hasuratest.NewMetadataClient()
+	client.SetInconsistentObjects(&enthasura.InconsistentObject{
+		Type:       "array_relation",
+		Reason:     "no foreign key constraint",
+		Definition: json.RawMessage(`{"table": {"schema": "public", "name": "players"}, "name": "results"}`),
+	})
+
+	err = enthasura.NewRuntimeWithClient(client).PerformFullGraphTransform(graph, "default", "public")
+
+	inconsistentErr := &enthasura.InconsistentMetadataError{}
+	if !errors.As(err, &inconsistentErr) {
+		t.Fatalf("expected an inconsistent metadata error, got %+v", err)
+	}
+
+	if origin := inconsistentErr.Objects[0].Origin; origin == nil || origin.Node != "Player" || origin.Edge != "scores" {
+		t.Errorf("origin of the inconsistent results: got %s, want node Player and edge scores", origin)
+	}
+}
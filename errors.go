@@ -0,0 +1,176 @@
+package enthasura
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/minskylab/hasura-api/metadata"
+)
+
+// MetadataError is a metadata API error response, mapped back to the query that produced it.
+type MetadataError struct {
+	StatusCode int
+	Code       string
+	Path       string
+	Message    string
+	Phase      string
+	Query      *metadata.MetadataQuery
+	Origin     *QueryOrigin
+}
+
+func (e *MetadataError) Error() string {
+	msg := fmt.Sprintf("hasura metadata error (%d", e.StatusCode)
+
+	if e.Code != "" {
+		msg += " " + e.Code
+	}
+
+	msg += "): " + e.Message
+
+	if e.Phase != "" {
+		msg += " at " + e.Phase
+	}
+
+	if e.Query != nil {
+		msg += " [" + describeQuery(*e.Query) + "]"
+	}
+
+	if e.Origin != nil {
+		msg += " from " + e.Origin.String()
+	}
+
+	return msg
+}
+
+// BadRequestError is returned when Hasura rejects a metadata query (HTTP 400),
+// e.g. a permission with an invalid filter.
+type BadRequestError struct {
+	*MetadataError
+}
+
+// UnauthorizedError is returned when the admin secret is missing or wrong (HTTP 401).
+type UnauthorizedError struct {
+	*MetadataError
+}
+
+// InternalServerError is returned when Hasura fails to process the request (HTTP 500).
+type InternalServerError struct {
+	*MetadataError
+}
+
+// InconsistentMetadataError is returned when objects produced by the ent schema are inconsistent
+// after a transform, RolledBack tells whether the previous metadata was restored.
+type InconsistentMetadataError struct {
+	Objects    []*InconsistentObject
+	RolledBack bool
+}
+
+func (e *InconsistentMetadataError) Error() string {
+	objects := make([]string, 0, len(e.Objects))
+	for _, obj := range e.Objects {
+		objects = append(objects, obj.String())
+	}
+
+	msg := fmt.Sprintf("%d inconsistent metadata objects: %s", len(e.Objects), strings.Join(objects, "; "))
+
+	if e.RolledBack {
+		msg += " (metadata rolled back)"
+	}
+
+	return msg
+}
+
+type hasuraErrorBody struct {
+	Path  string `json:"path"`
+	Error string `json:"error"`
+	Code  string `json:"code"`
+}
+
+// ErrorResponse is the error response of a MetadataClient which does not talk to an engine over
+// HTTP, like hasuratest.MetadataClient. Path, Error and Code are those of a Hasura error body.
+type ErrorResponse struct {
+	StatusCode int    `json:"-"`
+	Path       string `json:"path"`
+	Error      string `json:"error"`
+	Code       string `json:"code"`
+}
+
+func (r ErrorResponse) GetResponse() interface{} {
+	return r
+}
+
+var bulkPathRegexp = regexp.MustCompile(`^\$\.args\[(\d+)\]`)
+
+// metadataResponseError returns a typed error for an error response of a bulk of queries, or nil if
+// the request succeeded. The failing query is found from the path of the error.
+func metadataResponseError(res metadata.MetadataResponse, phase *PlanPhase) error {
+	statusCode, body, isError := errorResponse(res)
+	if !isError {
+		return nil
+	}
+
+	metadataErr := &MetadataError{
+		StatusCode: statusCode,
+		Code:       body.Code,
+		Path:       body.Path,
+		Message:    body.Error,
+	}
+
+	if phase != nil {
+		metadataErr.Phase = phase.Name
+
+		if match := bulkPathRegexp.FindStringSubmatch(body.Path); match != nil {
+			index, _ := strconv.Atoi(match[1])
+
+			if index < len(phase.Queries) {
+				metadataErr.Query = &phase.Queries[index]
+			}
+
+			if index < len(phase.Origins) {
+				metadataErr.Origin = phase.Origins[index]
+			}
+		}
+	}
+
+	switch metadataErr.StatusCode {
+	case http.StatusBadRequest:
+		return &BadRequestError{metadataErr}
+	case http.StatusUnauthorized:
+		return &UnauthorizedError{metadataErr}
+	case http.StatusInternalServerError:
+		return &InternalServerError{metadataErr}
+	}
+
+	return metadataErr
+}
+
+// errorResponse returns the status code and the error body of a response, if it is an error.
+func errorResponse(res metadata.MetadataResponse) (int, hasuraErrorBody, bool) {
+	switch response := res.(type) {
+	case metadata.RestyResponse:
+		if response.Response == nil || !response.IsError() {
+			return 0, hasuraErrorBody{}, false
+		}
+
+		body := hasuraErrorBody{}
+		if err := json.Unmarshal(response.Body(), &body); err != nil || body.Error == "" {
+			body.Error = strings.TrimSpace(string(response.Body()))
+		}
+
+		return response.StatusCode(), body, true
+	case ErrorResponse:
+		return response.StatusCode, hasuraErrorBody{Path: response.Path, Error: response.Error, Code: response.Code}, true
+	case *ErrorResponse:
+		if response == nil {
+			return 0, hasuraErrorBody{}, false
+		}
+
+		return response.StatusCode, hasuraErrorBody{Path: response.Path, Error: response.Error, Code: response.Code}, true
+	}
+
+	return 0, hasuraErrorBody{}, false
+}
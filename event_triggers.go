@@ -0,0 +1,396 @@
+package enthasura
+
+import (
+	"encoding/json"
+
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/schema"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+const hasuraEventTriggersAnnotationName = "hasura-event-triggers"
+
+// Default retry configuration of Hasura, used so the generated triggers match the exported ones.
+const (
+	defaultRetryIntervalSec = 10
+	defaultRetryTimeoutSec  = 60
+)
+
+// EventTriggerAnnotation declares a Hasura event trigger on the table of the node, Trigger is its name.
+type EventTriggerAnnotation struct {
+	Trigger        string                 `json:"name"`
+	Insert         *EventTriggerOperation `json:"insert,omitempty"`
+	Update         *EventTriggerOperation `json:"update,omitempty"`
+	Delete         *EventTriggerOperation `json:"delete,omitempty"`
+	EnableManual   bool                   `json:"enable_manual,omitempty"`
+	Webhook        string                 `json:"webhook,omitempty"`
+	WebhookFromEnv string                 `json:"webhook_from_env,omitempty"`
+	RetryConf      *RetryConf             `json:"retry_conf,omitempty"`
+	Headers        []EventTriggerHeader   `json:"headers,omitempty"`
+}
+
+// EventTriggersAnnotation holds several event triggers of the same node.
+type EventTriggersAnnotation struct {
+	Triggers []EventTriggerAnnotation `json:"triggers"`
+}
+
+// EventTriggers declares every given event trigger on the node.
+func EventTriggers(triggers ...EventTriggerAnnotation) EventTriggersAnnotation {
+	return EventTriggersAnnotation{Triggers: triggers}
+}
+
+type EventTriggerOperation struct {
+	Columns metadata.PermissionColumns `json:"columns"`
+}
+
+// UnmarshalJSON decodes the columns of the operation, either "*" or a list of columns.
+func (o *EventTriggerOperation) UnmarshalJSON(data []byte) error {
+	raw := struct {
+		Columns interface{} `json:"columns"`
+	}{}
+
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return errors.WithStack(err)
+	}
+
+	switch columns := raw.Columns.(type) {
+	case string:
+		o.Columns = AllColumnsType(columns)
+	case []interface{}:
+		cols := metadata.PGColumns{}
+		for _, column := range columns {
+			if name, isOk := column.(string); isOk {
+				cols = append(cols, name)
+			}
+		}
+		o.Columns = cols
+	}
+
+	return nil
+}
+
+// OnInsert fires the trigger on every insert.
+func OnInsert() *EventTriggerOperation {
+	return &EventTriggerOperation{Columns: AllColumns}
+}
+
+// OnUpdate fires the trigger when one of the columns is updated, or any column if none is given.
+func OnUpdate(columns ...string) *EventTriggerOperation {
+	if len(columns) == 0 {
+		return &EventTriggerOperation{Columns: AllColumns}
+	}
+
+	return &EventTriggerOperation{Columns: Columns(columns...)}
+}
+
+// OnDelete fires the trigger on every delete.
+func OnDelete() *EventTriggerOperation {
+	return &EventTriggerOperation{Columns: AllColumns}
+}
+
+type RetryConf struct {
+	NumRetries  int `json:"num_retries"`
+	IntervalSec int `json:"interval_sec"`
+	TimeoutSec  int `json:"timeout_sec"`
+}
+
+type EventTriggerHeader struct {
+	Name         string `json:"name"`
+	Value        string `json:"value,omitempty"`
+	ValueFromEnv string `json:"value_from_env,omitempty"`
+}
+
+// Header is a header sent to the webhook with a fixed value.
+func Header(name, value string) EventTriggerHeader {
+	return EventTriggerHeader{Name: name, Value: value}
+}
+
+// HeaderFromEnv is a header sent to the webhook with the value of an environment variable of Hasura.
+func HeaderFromEnv(name, env string) EventTriggerHeader {
+	return EventTriggerHeader{Name: name, ValueFromEnv: env}
+}
+
+func (EventTriggerAnnotation) Name() string {
+	return hasuraEventTriggersAnnotationName
+}
+
+// Merge implements the schema.Merger interface, so a node can declare several triggers.
+func (a EventTriggerAnnotation) Merge(other schema.Annotation) schema.Annotation {
+	return EventTriggers(a).Merge(other)
+}
+
+func (EventTriggersAnnotation) Name() string {
+	return hasuraEventTriggersAnnotationName
+}
+
+// Merge implements the schema.Merger interface, triggers of both annotations are kept.
+func (a EventTriggersAnnotation) Merge(other schema.Annotation) schema.Annotation {
+	triggers := append([]EventTriggerAnnotation{}, a.Triggers...)
+
+	switch other := other.(type) {
+	case EventTriggersAnnotation:
+		triggers = append(triggers, other.Triggers...)
+	case *EventTriggersAnnotation:
+		if other != nil {
+			triggers = append(triggers, other.Triggers...)
+		}
+	case EventTriggerAnnotation:
+		triggers = append(triggers, other)
+	case *EventTriggerAnnotation:
+		if other != nil {
+			triggers = append(triggers, *other)
+		}
+	}
+
+	return EventTriggersAnnotation{Triggers: triggers}
+}
+
+var (
+	_ schema.Annotation = (*EventTriggerAnnotation)(nil)
+	_ schema.Merger     = (*EventTriggerAnnotation)(nil)
+	_ schema.Annotation = (*EventTriggersAnnotation)(nil)
+	_ schema.Merger     = (*EventTriggersAnnotation)(nil)
+)
+
+// PgCreateEventTriggerArgs are the arguments of pg_create_event_trigger, the type of hasura-api is empty.
+type PgCreateEventTriggerArgs struct {
+	Name           string                      `json:"name"`
+	Table          metadata.QualifiedTableName `json:"table"`
+	Source         string                      `json:"source,omitempty"`
+	Webhook        string                      `json:"webhook,omitempty"`
+	WebhookFromEnv string                      `json:"webhook_from_env,omitempty"`
+	Insert         *EventTriggerOperation      `json:"insert,omitempty"`
+	Update         *EventTriggerOperation      `json:"update,omitempty"`
+	Delete         *EventTriggerOperation      `json:"delete,omitempty"`
+	EnableManual   bool                        `json:"enable_manual"`
+	RetryConf      *RetryConf                  `json:"retry_conf,omitempty"`
+	Headers        []EventTriggerHeader        `json:"headers,omitempty"`
+	Replace        bool                        `json:"replace"`
+}
+
+func pgCreateEventTriggerQuery(args *PgCreateEventTriggerArgs) metadata.MetadataQuery {
+	return metadata.MetadataQuery{
+		Type: metadata.PgCreateEventTrigger,
+		Args: args,
+	}
+}
+
+// PgDeleteEventTriggerArgs are the arguments of pg_delete_event_trigger, the type of hasura-api is
+// empty. Table is not sent, it is kept for the plan and the origin of the query.
+type PgDeleteEventTriggerArgs struct {
+	Name   string                      `json:"name"`
+	Source string                      `json:"source,omitempty"`
+	Table  metadata.QualifiedTableName `json:"-"`
+}
+
+func pgDeleteEventTriggerQuery(args *PgDeleteEventTriggerArgs) metadata.MetadataQuery {
+	return metadata.MetadataQuery{
+		Type: metadata.PgDeleteEventTrigger,
+		Args: args,
+	}
+}
+
+// EventTrigger is an event trigger as stored in the metadata of a table.
+type EventTrigger struct {
+	Name           string                  `json:"name"`
+	Definition     *EventTriggerDefinition `json:"definition"`
+	RetryConf      *RetryConf              `json:"retry_conf,omitempty"`
+	Webhook        string                  `json:"webhook,omitempty"`
+	WebhookFromEnv string                  `json:"webhook_from_env,omitempty"`
+	Headers        []EventTriggerHeader    `json:"headers,omitempty"`
+}
+
+type EventTriggerDefinition struct {
+	EnableManual bool                   `json:"enable_manual"`
+	Insert       *EventTriggerOperation `json:"insert,omitempty"`
+	Update       *EventTriggerOperation `json:"update,omitempty"`
+	Delete       *EventTriggerOperation `json:"delete,omitempty"`
+}
+
+// eventTriggersFromNode returns the event triggers declared on the node.
+func eventTriggersFromNode(node *gen.Type) ([]EventTriggerAnnotation, error) {
+	raw, isOk := node.Annotations[hasuraEventTriggersAnnotationName]
+	if !isOk || raw == nil {
+		return nil, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if ann, isOk := raw.(map[string]interface{}); isOk && ann["triggers"] != nil {
+		triggers := EventTriggersAnnotation{}
+		if err := json.Unmarshal(data, &triggers); err != nil {
+			return nil, errors.Wrapf(err, "decoding event triggers of %s", node.Name)
+		}
+
+		return triggers.Triggers, nil
+	}
+
+	trigger := EventTriggerAnnotation{}
+	if err := json.Unmarshal(data, &trigger); err != nil {
+		return nil, errors.Wrapf(err, "decoding event trigger of %s", node.Name)
+	}
+
+	return []EventTriggerAnnotation{trigger}, nil
+}
+
+// eventTriggersQueries builds the pg_create_event_trigger queries declared with EventTriggerAnnotation.
+func eventTriggersQueries(graph *gen.Graph, sourceName, schemaName string) ([]metadata.MetadataQuery, error) {
+	queries := []metadata.MetadataQuery{}
+	schemas := newTableSchemas(graph, schemaName)
+
+	for _, node := range graph.Nodes {
+		triggers, err := eventTriggersFromNode(node)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if len(triggers) > 0 && schemas.skip(node.Table()) {
+			logrus.Warnf("skipping event triggers of %s as its table is not tracked", node.Name)
+			continue
+		}
+
+		for _, trigger := range triggers {
+			if trigger.Trigger == "" {
+				return nil, errors.Errorf("event trigger of %s without name", node.Name)
+			}
+
+			if trigger.Webhook == "" && trigger.WebhookFromEnv == "" {
+				return nil, errors.Errorf("event trigger %s of %s without webhook", trigger.Trigger, node.Name)
+			}
+
+			queries = append(queries, pgCreateEventTriggerQuery(&PgCreateEventTriggerArgs{
+				Name:           trigger.Trigger,
+				Table:          metadata.QualifiedTableName{Name: node.Table(), Schema: schemas.schema(node.Table())},
+				Source:         sourceName,
+				Webhook:        trigger.Webhook,
+				WebhookFromEnv: trigger.WebhookFromEnv,
+				Insert:         trigger.Insert,
+				Update:         trigger.Update,
+				Delete:         trigger.Delete,
+				EnableManual:   trigger.EnableManual,
+				RetryConf:      retryConfWithDefaults(trigger.RetryConf),
+				Headers:        trigger.Headers,
+			}))
+		}
+	}
+
+	return queries, nil
+}
+
+// retryConfWithDefaults returns the retry configuration with the defaults of Hasura for the
+// interval and timeout left unset.
+func retryConfWithDefaults(conf *RetryConf) *RetryConf {
+	withDefaults := &RetryConf{IntervalSec: defaultRetryIntervalSec, TimeoutSec: defaultRetryTimeoutSec}
+	if conf == nil {
+		return withDefaults
+	}
+
+	withDefaults.NumRetries = conf.NumRetries
+
+	if conf.IntervalSec != 0 {
+		withDefaults.IntervalSec = conf.IntervalSec
+	}
+
+	if conf.TimeoutSec != 0 {
+		withDefaults.TimeoutSec = conf.TimeoutSec
+	}
+
+	return withDefaults
+}
+
+// eventTriggerFromArgs returns the metadata form of a pg_create_event_trigger query.
+func eventTriggerFromArgs(args *PgCreateEventTriggerArgs) *EventTrigger {
+	return &EventTrigger{
+		Name: args.Name,
+		Definition: &EventTriggerDefinition{
+			EnableManual: args.EnableManual,
+			Insert:       args.Insert,
+			Update:       args.Update,
+			Delete:       args.Delete,
+		},
+		RetryConf:      args.RetryConf,
+		Webhook:        args.Webhook,
+		WebhookFromEnv: args.WebhookFromEnv,
+		Headers:        args.Headers,
+	}
+}
+
+// eventTriggerArgs returns the pg_create_event_trigger arguments of a trigger of the metadata.
+func eventTriggerArgs(table metadata.QualifiedTableName, sourceName string, trigger *EventTrigger, replace bool) *PgCreateEventTriggerArgs {
+	args := &PgCreateEventTriggerArgs{
+		Name:           trigger.Name,
+		Table:          table,
+		Source:         sourceName,
+		Webhook:        trigger.Webhook,
+		WebhookFromEnv: trigger.WebhookFromEnv,
+		RetryConf:      trigger.RetryConf,
+		Headers:        trigger.Headers,
+		Replace:        replace,
+	}
+
+	if trigger.Definition != nil {
+		args.EnableManual = trigger.Definition.EnableManual
+		args.Insert = trigger.Definition.Insert
+		args.Update = trigger.Definition.Update
+		args.Delete = trigger.Definition.Delete
+	}
+
+	return args
+}
+
+// applyEventTriggerQuery stores a pg_create_event_trigger query inside the matching table of the source.
+func applyEventTriggerQuery(source *Source, query metadata.MetadataQuery) error {
+	args, isOk := query.Args.(*PgCreateEventTriggerArgs)
+	if !isOk {
+		return errors.Errorf("unexpected event trigger query: %s", query.Type)
+	}
+
+	target := source.table(args.Table.Schema, args.Table.Name)
+	if target == nil {
+		return errors.Errorf("event trigger for untracked table %s.%s", args.Table.Schema, args.Table.Name)
+	}
+
+	target.EventTriggers = setEventTrigger(target.EventTriggers, eventTriggerFromArgs(args))
+
+	return nil
+}
+
+// setEventTrigger replaces the trigger with the same name or appends it. Triggers are kept as
+// interface{} values so unknown fields of hand-made triggers survive a round trip.
+func setEventTrigger(triggers []interface{}, trigger *EventTrigger) []interface{} {
+	for i, t := range triggers {
+		if eventTriggerName(t) == trigger.Name {
+			triggers[i] = trigger
+			return triggers
+		}
+	}
+
+	return append(triggers, trigger)
+}
+
+func eventTriggerName(trigger interface{}) string {
+	switch t := trigger.(type) {
+	case *EventTrigger:
+		return t.Name
+	case map[string]interface{}:
+		name, _ := t["name"].(string)
+		return name
+	}
+
+	return ""
+}
+
+func findEventTrigger(triggers []interface{}, name string) interface{} {
+	for _, t := range triggers {
+		if eventTriggerName(t) == name {
+			return t
+		}
+	}
+
+	return nil
+}
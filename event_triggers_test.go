@@ -0,0 +1,176 @@
+package enthasura_test
+
+import (
+	"testing"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/field"
+	enthasura "github.com/minskylab/ent-hasura"
+	"github.com/minskylab/hasura-api/metadata"
+)
+
+// Order is the schema of the event trigger tests, its triggers are set per test.
+type Order struct {
+	ent.Schema
+	triggers []enthasura.EventTriggerAnnotation
+}
+
+func (Order) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("status"),
+		field.Float("total"),
+	}
+}
+
+func (o Order) Annotations() []schema.Annotation {
+	if len(o.triggers) == 0 {
+		return nil
+	}
+
+	return []schema.Annotation{enthasura.EventTriggers(o.triggers...)}
+}
+
+var (
+	orderCreated = enthasura.EventTriggerAnnotation{
+		Trigger:   "order_created",
+		Insert:    enthasura.OnInsert(),
+		Webhook:   "http://orders:8080/created",
+		RetryConf: &enthasura.RetryConf{NumRetries: 3},
+	}
+
+	orderShipped = enthasura.EventTriggerAnnotation{
+		Trigger:        "order_shipped",
+		Update:         enthasura.OnUpdate("status"),
+		Delete:         enthasura.OnDelete(),
+		EnableManual:   true,
+		WebhookFromEnv: "ORDERS_WEBHOOK",
+		RetryConf:      &enthasura.RetryConf{NumRetries: 5, IntervalSec: 30, TimeoutSec: 120},
+		Headers:        []enthasura.EventTriggerHeader{enthasura.HeaderFromEnv("Authorization", "ORDERS_TOKEN")},
+	}
+)
+
+func TestEventTriggerQueries(t *testing.T) {
+	queries, err := enthasura.BuildQueries(loadGraph(t, Order{triggers: []enthasura.EventTriggerAnnotation{orderCreated, orderShipped}}))
+	if err != nil {
+		t.Fatalf("building queries: %+v", err)
+	}
+
+	triggers := []metadata.MetadataQuery{}
+	for _, query := range queries {
+		if query.Type == metadata.PgCreateEventTrigger {
+			triggers = append(triggers, query)
+		}
+	}
+
+	assertSameJSON(t, triggers, []map[string]interface{}{
+		{
+			"type": "pg_create_event_trigger",
+			"args": map[string]interface{}{
+				"name":          "order_created",
+				"table":         map[string]interface{}{"schema": "public", "name": "orders"},
+				"source":        "default",
+				"webhook":       "http://orders:8080/created",
+				"insert":        map[string]interface{}{"columns": "*"},
+				"enable_manual": false,
+				"retry_conf":    map[string]interface{}{"num_retries": 3, "interval_sec": 10, "timeout_sec": 60},
+				"replace":       false,
+			},
+		},
+		{
+			"type": "pg_create_event_trigger",
+			"args": map[string]interface{}{
+				"name":             "order_shipped",
+				"table":            map[string]interface{}{"schema": "public", "name": "orders"},
+				"source":           "default",
+				"webhook_from_env": "ORDERS_WEBHOOK",
+				"update":           map[string]interface{}{"columns": []interface{}{"status"}},
+				"delete":           map[string]interface{}{"columns": "*"},
+				"enable_manual":    true,
+				"retry_conf":       map[string]interface{}{"num_retries": 5, "interval_sec": 30, "timeout_sec": 120},
+				"headers":          []interface{}{map[string]interface{}{"name": "Authorization", "value_from_env": "ORDERS_TOKEN"}},
+				"replace":          false,
+			},
+		},
+	})
+}
+
+func TestEventTriggerMetadata(t *testing.T) {
+	m, err := enthasura.BuildMetadata(loadGraph(t, Order{triggers: []enthasura.EventTriggerAnnotation{orderCreated}}))
+	if err != nil {
+		t.Fatalf("building metadata: %+v", err)
+	}
+
+	assertSameJSON(t, findTable(t, m.Sources[0], "orders").EventTriggers, []interface{}{
+		map[string]interface{}{
+			"name": "order_created",
+			"definition": map[string]interface{}{
+				"enable_manual": false,
+				"insert":        map[string]interface{}{"columns": "*"},
+			},
+			"retry_conf": map[string]interface{}{"num_retries": 3, "interval_sec": 10, "timeout_sec": 60},
+			"webhook":    "http://orders:8080/created",
+		},
+	})
+}
+
+func TestEventTriggerWithoutWebhook(t *testing.T) {
+	graph := loadGraph(t, Order{triggers: []enthasura.EventTriggerAnnotation{{Trigger: "order_created", Insert: enthasura.OnInsert()}}})
+
+	if _, err := enthasura.BuildQueries(graph); err == nil {
+		t.Error("expected an error building a trigger without webhook")
+	}
+}
+
+func TestIncrementalTransformEventTriggers(t *testing.T) {
+	graph := loadGraph(t, Order{triggers: []enthasura.EventTriggerAnnotation{orderCreated, orderShipped}})
+	run, client := appliedRuntime(t, graph)
+
+	orders := client.Table("default", "public", "orders")
+	if orders == nil || len(orders.EventTriggers) != 2 {
+		t.Fatalf("got the triggers %+v, want order_created and order_shipped", orders)
+	}
+
+	if queries := planQueries(t, run, graph, true); len(queries) != 0 {
+		t.Fatalf("plan not empty once the triggers are created: %v", describeQueries(t, queries))
+	}
+
+	// the webhook of order_created changes and order_shipped is removed from the schema
+	changed := orderCreated
+	changed.Webhook = "http://orders:9090/created"
+
+	graph = loadGraph(t, Order{triggers: []enthasura.EventTriggerAnnotation{changed}})
+
+	got := describeQueries(t, planQueries(t, run, graph, false))
+	assertSameJSON(t, got, []string{`pg_create_event_trigger public.orders order_created`})
+
+	got = describeQueries(t, planQueries(t, run, graph, true))
+	assertSameJSON(t, got, []string{
+		`pg_delete_event_trigger . order_shipped`,
+		`pg_create_event_trigger public.orders order_created`,
+	})
+
+	if err := run.PerformIncrementalGraphTransform(graph, "default", "public", true); err != nil {
+		t.Fatalf("applying the changed triggers: %+v", err)
+	}
+
+	orders = client.Table("default", "public", "orders")
+	assertSameJSON(t, orders.EventTriggers, []interface{}{map[string]interface{}{
+		"name": "order_created",
+		"definition": map[string]interface{}{
+			"enable_manual": false,
+			"insert":        map[string]interface{}{"columns": "*"},
+		},
+		"retry_conf": map[string]interface{}{"num_retries": 3, "interval_sec": 10, "timeout_sec": 60},
+		"webhook":    "http://orders:9090/created",
+	}})
+
+	queries := client.Queries()
+	if replace := queries[len(queries)-1]; replace.Type != metadata.PgCreateEventTrigger || !replace.Args.(*enthasura.PgCreateEventTriggerArgs).Replace {
+		t.Errorf("the changed trigger is not replaced: %+v", replace)
+	}
+
+	if queries := planQueries(t, run, graph, true); len(queries) != 0 {
+		t.Fatalf("plan not empty once the triggers are changed: %v", describeQueries(t, queries))
+	}
+}
@@ -0,0 +1,185 @@
+package events
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+
+	enthasura "github.com/minskylab/ent-hasura"
+	"github.com/pkg/errors"
+)
+
+// Decoder decodes rows of event payloads into ent entity structs. Rows may use the Postgres column
+// names or the custom column names of the table in the metadata, both are mapped back to the json
+// names of the entity fields.
+type Decoder struct {
+	naming  enthasura.NamingStrategy
+	tables  map[string]map[string]string
+	columns map[string]string
+
+	mu      sync.Mutex
+	aliases map[aliasesKey]map[string]string
+}
+
+type aliasesKey struct {
+	table  string
+	entity reflect.Type
+}
+
+// NewDecoder returns a decoder for the tables of m, the metadata built by enthasura.BuildMetadata or
+// exported from the engine, nil to only rely on naming. naming is the strategy the metadata was
+// generated with, nil means the default strategy. columns maps the Postgres columns of fields with
+// a custom storage key to their field names, it is only needed when the custom name of such a
+// column is not the one naming derives from the field name, e.g. with GraphQLDefaultNaming.
+func NewDecoder(m *enthasura.Metadata, naming enthasura.NamingStrategy, columns map[string]string) *Decoder {
+	if naming == nil {
+		naming = enthasura.NewDefaultNaming(enthasura.DefaultConfig)
+	}
+
+	return &Decoder{
+		naming:  naming,
+		tables:  customColumnNames(m),
+		columns: columns,
+		aliases: map[aliasesKey]map[string]string{},
+	}
+}
+
+// customColumnNames returns the custom names of the columns of every table of m by schema
+// qualified table name, the names of the column config win over custom_column_names.
+func customColumnNames(m *enthasura.Metadata) map[string]map[string]string {
+	tables := map[string]map[string]string{}
+	if m == nil {
+		return tables
+	}
+
+	for _, source := range m.Sources {
+		for _, table := range source.Tables {
+			names := map[string]string{}
+			tables[tableKey(table.Table.Schema, table.Table.Name)] = names
+
+			if table.Configuration == nil {
+				continue
+			}
+
+			for column, name := range table.Configuration.CustomColumnNames {
+				names[column] = name
+			}
+
+			for column, config := range table.Configuration.ColumnConfig {
+				if config != nil && config.CustomName != "" {
+					names[column] = config.CustomName
+				}
+			}
+		}
+	}
+
+	return tables
+}
+
+func tableKey(schema, table string) string {
+	if schema == "" {
+		schema = "public"
+	}
+
+	return schema + "." + table
+}
+
+// Decode decodes a row of the table into out, a pointer to an entity struct. A null row leaves out
+// untouched and returns false.
+func (d *Decoder) Decode(schema, table string, row json.RawMessage, out interface{}) (bool, error) {
+	if len(row) == 0 || string(row) == "null" {
+		return false, nil
+	}
+
+	t := reflect.TypeOf(out)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Struct {
+		return false, errors.Errorf("expected a pointer to a struct, got %T", out)
+	}
+
+	values := map[string]json.RawMessage{}
+	if err := json.Unmarshal(row, &values); err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	aliases := d.aliasesOf(tableKey(schema, table), t.Elem())
+	renamed := make(map[string]json.RawMessage, len(values))
+
+	for key, value := range values {
+		if name, isOk := aliases[key]; isOk {
+			renamed[name] = value
+		}
+	}
+
+	data, err := json.Marshal(renamed)
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return true, errors.WithStack(json.Unmarshal(data, out))
+}
+
+// aliasesOf returns the names a column of the struct may have in a payload of the table, mapped to
+// its json name.
+func (d *Decoder) aliasesOf(table string, t reflect.Type) map[string]string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	key := aliasesKey{table: table, entity: t}
+	if aliases, isOk := d.aliases[key]; isOk {
+		return aliases
+	}
+
+	customNames, known := d.tables[table]
+	fields := map[string]bool{}
+	aliases := map[string]string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.PkgPath != "" {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" || name == "-" || name == "edges" {
+			continue
+		}
+
+		fields[name] = true
+		aliases[name] = name
+
+		if !known {
+			aliases[d.naming.ColumnName(name, name)] = name
+		}
+	}
+
+	for column, customName := range customNames {
+		switch {
+		case fields[column]:
+			aliases[customName] = column
+		case fields[d.columns[column]]:
+			aliases[column], aliases[customName] = d.columns[column], d.columns[column]
+		default:
+			// a column with a custom storage key, named after its field by the naming strategy
+			for name := range fields {
+				if customName == d.naming.ColumnName(name, name) {
+					aliases[column], aliases[customName] = name, name
+				}
+			}
+		}
+	}
+
+	for column, field := range d.columns {
+		if fields[field] {
+			aliases[column] = field
+
+			if !known {
+				aliases[d.naming.ColumnName(column, field)] = field
+			}
+		}
+	}
+
+	d.aliases[key] = aliases
+
+	return aliases
+}
@@ -0,0 +1,117 @@
+package events_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	enthasura "github.com/minskylab/ent-hasura"
+	"github.com/minskylab/ent-hasura/events"
+)
+
+// User is shaped like an ent entity: display_name has the storage key "name", nickname the GraphQL
+// name "alias" and login both the storage key "handle" and the GraphQL name "username".
+type User struct {
+	ID          int       `json:"id,omitempty"`
+	DisplayName string    `json:"display_name,omitempty"`
+	Nickname    string    `json:"nickname,omitempty"`
+	Login       string    `json:"login,omitempty"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+	Edges       struct{}  `json:"edges"`
+}
+
+const usersMetadata = `{
+	"version": 3,
+	"sources": [{
+		"name": "default",
+		"kind": "postgres",
+		"tables": [{
+			"table": {"schema": "public", "name": "users"},
+			"configuration": {
+				"custom_column_names": {
+					"name": "displayName",
+					"nickname": "alias",
+					"handle": "username",
+					"created_at": "createdAt"
+				}
+			}
+		}],
+		"configuration": {}
+	}]
+}`
+
+func usersDecoder(t *testing.T) *events.Decoder {
+	t.Helper()
+
+	m := &enthasura.Metadata{}
+	if err := json.Unmarshal([]byte(usersMetadata), m); err != nil {
+		t.Fatal(err)
+	}
+
+	return events.NewDecoder(m, nil, map[string]string{"handle": "login"})
+}
+
+func TestDecoderColumnNames(t *testing.T) {
+	createdAt := time.Date(2021, 8, 1, 12, 0, 0, 0, time.UTC)
+	want := User{ID: 1, DisplayName: "Ada", Nickname: "ada", Login: "ada92", CreatedAt: createdAt}
+
+	tests := []struct {
+		name string
+		row  string
+	}{
+		{
+			name: "postgres columns",
+			row:  `{"id": 1, "name": "Ada", "nickname": "ada", "handle": "ada92", "created_at": "2021-08-01T12:00:00Z"}`,
+		},
+		{
+			name: "custom column names",
+			row:  `{"id": 1, "displayName": "Ada", "alias": "ada", "username": "ada92", "createdAt": "2021-08-01T12:00:00Z"}`,
+		},
+	}
+
+	decoder := usersDecoder(t)
+
+	for _, test := range tests {
+		user := User{}
+
+		decoded, err := decoder.Decode("public", "users", json.RawMessage(test.row), &user)
+		if err != nil {
+			t.Fatalf("%s: %+v", test.name, err)
+		}
+
+		if !decoded || user != want {
+			t.Errorf("%s: got %+v (decoded %t), want %+v", test.name, user, decoded, want)
+		}
+	}
+}
+
+func TestDecoderWithoutMetadata(t *testing.T) {
+	user := User{}
+
+	decoder := events.NewDecoder(nil, nil, map[string]string{"name": "display_name"})
+
+	if _, err := decoder.Decode("public", "users", json.RawMessage(`{"id": 2, "name": "Grace", "nickname": "grace"}`), &user); err != nil {
+		t.Fatal(err)
+	}
+
+	if want := (User{ID: 2, DisplayName: "Grace", Nickname: "grace"}); user != want {
+		t.Errorf("got %+v, want %+v", user, want)
+	}
+}
+
+func TestDecoderNullRow(t *testing.T) {
+	user := User{ID: 3}
+
+	decoded, err := usersDecoder(t).Decode("public", "users", json.RawMessage("null"), &user)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if decoded || user.ID != 3 {
+		t.Errorf("a null row must leave the entity untouched, got %+v (decoded %t)", user, decoded)
+	}
+
+	if _, err := usersDecoder(t).Decode("public", "users", json.RawMessage(`{}`), user); err == nil {
+		t.Error("expected an error decoding into a struct value")
+	}
+}
@@ -0,0 +1,218 @@
+// Package events serves the webhooks of Hasura event triggers, decoding the rows of every event into
+// ent entity structs and dispatching them by trigger name and operation to typed callbacks.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+type Op string
+
+const (
+	OpInsert Op = "INSERT"
+	OpUpdate Op = "UPDATE"
+	OpDelete Op = "DELETE"
+	OpManual Op = "MANUAL"
+	// OpAny matches every operation of a trigger.
+	OpAny Op = ""
+)
+
+// Event is the payload Hasura posts to the webhook of an event trigger.
+type Event struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Trigger   struct {
+		Name string `json:"name"`
+	} `json:"trigger"`
+	Table struct {
+		Schema string `json:"schema"`
+		Name   string `json:"name"`
+	} `json:"table"`
+	DeliveryInfo struct {
+		MaxRetries   int `json:"max_retries"`
+		CurrentRetry int `json:"current_retry"`
+	} `json:"delivery_info"`
+	Event struct {
+		Op               Op                `json:"op"`
+		SessionVariables map[string]string `json:"session_variables"`
+		Data             struct {
+			Old json.RawMessage `json:"old"`
+			New json.RawMessage `json:"new"`
+		} `json:"data"`
+	} `json:"event"`
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	eventType   = reflect.TypeOf(&Event{})
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+type route struct {
+	trigger string
+	op      Op
+	fn      reflect.Value
+}
+
+// Handler is an http.Handler calling the callbacks registered for the trigger and operation of
+// every event.
+type Handler struct {
+	decoder *Decoder
+
+	mu     sync.RWMutex
+	routes []route
+}
+
+// NewHandler returns a handler decoding rows with decoder, nil means a decoder for the default
+// naming strategy without metadata.
+func NewHandler(decoder *Decoder) *Handler {
+	if decoder == nil {
+		decoder = NewDecoder(nil, nil, nil)
+	}
+
+	return &Handler{decoder: decoder}
+}
+
+// Handle registers a callback for an operation of a trigger, OpAny registers it for every
+// operation. The callback must look like
+//
+//	func(ctx context.Context, event *events.Event, old, new *ent.User) error
+//
+// old is nil on inserts and new is nil on deletes.
+func (h *Handler) Handle(trigger string, op Op, fn interface{}) error {
+	if fn == nil {
+		return errors.Errorf("trigger %s: expected a function, got nil", trigger)
+	}
+
+	value := reflect.ValueOf(fn)
+	if err := checkSignature(value.Type()); err != nil {
+		return errors.Wrapf(err, "trigger %s", trigger)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.routes = append(h.routes, route{trigger: trigger, op: op, fn: value})
+
+	return nil
+}
+
+// MustHandle is like Handle but panics if the callback has an invalid signature.
+func (h *Handler) MustHandle(trigger string, op Op, fn interface{}) *Handler {
+	if err := h.Handle(trigger, op, fn); err != nil {
+		panic(err)
+	}
+
+	return h
+}
+
+func checkSignature(t reflect.Type) error {
+	if t.Kind() != reflect.Func {
+		return errors.Errorf("expected a function, got %s", t)
+	}
+
+	if t.NumIn() != 4 || t.NumOut() != 1 {
+		return errors.Errorf("expected func(context.Context, *events.Event, old, new *Entity) error, got %s", t)
+	}
+
+	if t.In(0) != contextType || t.In(1) != eventType {
+		return errors.Errorf("the first arguments must be a context.Context and an *events.Event, got %s", t)
+	}
+
+	if t.In(2) != t.In(3) || t.In(2).Kind() != reflect.Ptr || t.In(2).Elem().Kind() != reflect.Struct {
+		return errors.Errorf("old and new must be pointers to the same entity struct, got %s and %s", t.In(2), t.In(3))
+	}
+
+	if t.Out(0) != errorType {
+		return errors.Errorf("the result must be an error, got %s", t.Out(0))
+	}
+
+	return nil
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	event := &Event{}
+	if err := json.NewDecoder(r.Body).Decode(event); err != nil {
+		writeError(w, http.StatusBadRequest, errors.Wrap(err, "invalid event payload"))
+		return
+	}
+
+	if err := h.Dispatch(r.Context(), event); err != nil {
+		logrus.WithFields(logrus.Fields{"trigger": event.Trigger.Name, "event": event.ID}).Error(err)
+		writeError(w, http.StatusInternalServerError, err) // Hasura retries the event
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write([]byte(`{"ok":true}`))
+}
+
+// Dispatch calls every callback registered for the trigger and operation of the event.
+func (h *Handler) Dispatch(ctx context.Context, event *Event) error {
+	h.mu.RLock()
+	routes := append([]route{}, h.routes...)
+	h.mu.RUnlock()
+
+	for _, rt := range routes {
+		if rt.trigger != event.Trigger.Name || (rt.op != OpAny && rt.op != event.Event.Op) {
+			continue
+		}
+
+		if err := h.call(ctx, rt.fn, event); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+func (h *Handler) call(ctx context.Context, fn reflect.Value, event *Event) error {
+	entity := fn.Type().In(2)
+
+	old, err := h.decode(event, event.Event.Data.Old, entity)
+	if err != nil {
+		return errors.Wrap(err, "decoding old row")
+	}
+
+	new, err := h.decode(event, event.Event.Data.New, entity)
+	if err != nil {
+		return errors.Wrap(err, "decoding new row")
+	}
+
+	results := fn.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(event), old, new})
+
+	if err, isOk := results[0].Interface().(error); isOk && err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// decode returns a new entity decoded from the row, or a nil pointer if the row is null.
+func (h *Handler) decode(event *Event, row json.RawMessage, entity reflect.Type) (reflect.Value, error) {
+	value := reflect.New(entity.Elem())
+
+	decoded, err := h.decoder.Decode(event.Table.Schema, event.Table.Name, row, value.Interface())
+	if err != nil || !decoded {
+		return reflect.Zero(entity), err
+	}
+
+	return value, nil
+}
+
+func writeError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	if err := json.NewEncoder(w).Encode(map[string]string{"message": err.Error()}); err != nil {
+		logrus.Error(err)
+	}
+}
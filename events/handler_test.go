@@ -0,0 +1,154 @@
+package events_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/minskylab/ent-hasura/events"
+)
+
+type call struct {
+	op       events.Op
+	old, new *User
+}
+
+func eventPayload(op, old, new string) string {
+	return `{
+		"id": "85558393-c75d-4d2f-9c15-e80591b83894",
+		"created_at": "2021-08-01T12:00:00Z",
+		"trigger": {"name": "users_changed"},
+		"table": {"schema": "public", "name": "users"},
+		"event": {
+			"op": "` + op + `",
+			"session_variables": {"x-hasura-role": "admin"},
+			"data": {"old": ` + old + `, "new": ` + new + `}
+		}
+	}`
+}
+
+func TestHandlerDispatchesOperations(t *testing.T) {
+	calls := []call{}
+
+	handler := events.NewHandler(usersDecoder(t)).
+		MustHandle("users_changed", events.OpAny, func(ctx context.Context, event *events.Event, old, new *User) error {
+			calls = append(calls, call{op: event.Event.Op, old: old, new: new})
+			return nil
+		}).
+		MustHandle("users_changed", events.OpDelete, func(ctx context.Context, event *events.Event, old, new *User) error {
+			return errors.New("deleting users is not handled")
+		}).
+		MustHandle("other", events.OpAny, func(ctx context.Context, event *events.Event, old, new *User) error {
+			t.Error("called the callback of another trigger")
+			return nil
+		})
+
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	tests := []struct {
+		op       string
+		old, new string
+		status   int
+		want     call
+	}{
+		{
+			op:     "INSERT",
+			old:    "null",
+			new:    `{"id": 1, "name": "Ada", "handle": "ada92"}`,
+			status: http.StatusOK,
+			want:   call{op: events.OpInsert, new: &User{ID: 1, DisplayName: "Ada", Login: "ada92"}},
+		},
+		{
+			op:     "UPDATE",
+			old:    `{"id": 1, "name": "Ada", "nickname": null}`,
+			new:    `{"id": 1, "name": "Ada", "nickname": "ada"}`,
+			status: http.StatusOK,
+			want:   call{op: events.OpUpdate, old: &User{ID: 1, DisplayName: "Ada"}, new: &User{ID: 1, DisplayName: "Ada", Nickname: "ada"}},
+		},
+		{
+			op:     "DELETE",
+			old:    `{"id": 1, "name": "Ada"}`,
+			new:    "null",
+			status: http.StatusInternalServerError,
+			want:   call{op: events.OpDelete, old: &User{ID: 1, DisplayName: "Ada"}},
+		},
+	}
+
+	for _, test := range tests {
+		calls = calls[:0]
+
+		res, err := http.Post(server.URL, "application/json", strings.NewReader(eventPayload(test.op, test.old, test.new)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+
+		if res.StatusCode != test.status {
+			t.Errorf("%s: status: got %d, want %d", test.op, res.StatusCode, test.status)
+		}
+
+		if len(calls) != 1 {
+			t.Fatalf("%s: got %d calls, want 1", test.op, len(calls))
+		}
+
+		assertRow(t, test.op+" old", calls[0].old, test.want.old)
+		assertRow(t, test.op+" new", calls[0].new, test.want.new)
+
+		if calls[0].op != test.want.op {
+			t.Errorf("%s: op: got %s", test.op, calls[0].op)
+		}
+	}
+}
+
+func TestHandlerInvalidPayload(t *testing.T) {
+	server := httptest.NewServer(events.NewHandler(nil))
+	defer server.Close()
+
+	res, err := http.Post(server.URL, "application/json", strings.NewReader(`{"event": `))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if res.StatusCode != http.StatusBadRequest {
+		t.Errorf("status: got %d, want %d", res.StatusCode, http.StatusBadRequest)
+	}
+}
+
+func TestHandleInvalidCallbacks(t *testing.T) {
+	handler := events.NewHandler(nil)
+
+	tests := []struct {
+		name string
+		fn   interface{}
+	}{
+		{name: "nil", fn: nil},
+		{name: "not a function", fn: "users_changed"},
+		{name: "missing event", fn: func(context.Context, *User, *User) error { return nil }},
+		{name: "different entities", fn: func(context.Context, *events.Event, *User, *call) error { return nil }},
+		{name: "entity value", fn: func(context.Context, *events.Event, User, User) error { return nil }},
+		{name: "no error", fn: func(context.Context, *events.Event, *User, *User) {}},
+	}
+
+	for _, test := range tests {
+		if err := handler.Handle("users_changed", events.OpAny, test.fn); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func assertRow(t *testing.T, name string, got, want *User) {
+	t.Helper()
+
+	switch {
+	case got == nil && want == nil:
+	case got == nil || want == nil:
+		t.Errorf("%s: got %+v, want %+v", name, got, want)
+	case *got != *want:
+		t.Errorf("%s: got %+v, want %+v", name, *got, *want)
+	}
+}
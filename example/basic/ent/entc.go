@@ -0,0 +1,22 @@
+//go:build ignore
+// +build ignore
+
+package main
+
+import (
+	"log"
+
+	"entgo.io/ent/entc"
+	"entgo.io/ent/entc/gen"
+	enthasura "github.com/minskylab/ent-hasura"
+)
+
+func main() {
+	ex := enthasura.NewExtension(enthasura.HasuraMetadataConfig{
+		OutputMetadataFile: "../hasura/metadata.json",
+	})
+
+	if err := entc.Generate("./schema", &gen.Config{}, entc.Extensions(ex)); err != nil {
+		log.Fatalf("running ent codegen: %v", err)
+	}
+}
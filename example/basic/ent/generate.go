@@ -1,4 +1,4 @@
 package ent
 
-//go:generate go run -mod=mod entgo.io/ent/cmd/ent generate ./schema
+//go:generate go run -mod=mod entc.go
 //go:generate go run github.com/minskylab/ent-hasura/cmd/ent apply -d -e ../.env ./schema
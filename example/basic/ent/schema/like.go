@@ -26,11 +26,11 @@ func (l Like) Annotations() []schema.Annotation {
 			SelectPermission: &hasura.SelectPermission{
 				Columns:        hasura.AllColumns,
 				ComputedFields: []string{},
-				Filter:         hasura.M{"creator": hasura.M{"id": hasura.Eq("X-Hasura-User-Id")}},
+				Filter:         hasura.Field("creator.id", hasura.Eq(hasura.XHasuraUserID)),
 			},
 			UpdatePermission: &hasura.UpdatePermission{
-				Check:   hasura.M{"creator": hasura.M{"id": hasura.Eq("X-Hasura-User-Id")}},
-				Filter:  hasura.M{"creator": hasura.M{"id": hasura.Eq("X-Hasura-User-Id")}},
+				Check:   hasura.Field("creator.id", hasura.Eq(hasura.XHasuraUserID)),
+				Filter:  hasura.Field("creator.id", hasura.Eq(hasura.XHasuraUserID)),
 				Columns: hasura.AllColumns,
 			},
 		},
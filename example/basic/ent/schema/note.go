@@ -35,13 +35,13 @@ func (n Note) Annotations() []schema.Annotation {
 			Role: "user",
 			SelectPermission: &hasura.SelectPermission{
 				Columns:           hasura.AllColumns,
-				Filter:            hasura.M{"authors": hasura.M{"user": hasura.M{"id": hasura.Eq("X-Hasura-User-Id")}}},
+				Filter:            hasura.Field("authors.user.id", hasura.Eq(hasura.XHasuraUserID)),
 				AllowAggregations: true,
 			},
 			UpdatePermission: &hasura.UpdatePermission{
 				Columns: hasura.AllColumns,
-				Check:   hasura.M{"authors": hasura.M{"user": hasura.M{"id": hasura.Eq("X-Hasura-User-Id")}}},
-				Filter:  hasura.M{"authors": hasura.M{"user": hasura.M{"id": hasura.Eq("X-Hasura-User-Id")}}},
+				Check:   hasura.Field("authors.user.id", hasura.Eq(hasura.XHasuraUserID)),
+				Filter:  hasura.Field("authors.user.id", hasura.Eq(hasura.XHasuraUserID)),
 			},
 		},
 	}
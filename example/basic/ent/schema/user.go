@@ -36,13 +36,13 @@ func (u User) Annotations() []schema.Annotation {
 			Role: "user",
 			SelectPermission: &hasura.SelectPermission{
 				Columns:           hasura.AllColumns,
-				Filter:            hasura.M{"id": hasura.Eq("X-Hasura-User-Id")},
+				Filter:            hasura.Field("id", hasura.Eq(hasura.XHasuraUserID)),
 				AllowAggregations: true,
 			},
 			UpdatePermission: &hasura.UpdatePermission{
 				Columns: hasura.AllColumns,
-				Check:   hasura.M{"id": hasura.Eq("X-Hasura-User-Id")},
-				Filter:  hasura.M{"id": hasura.Eq("X-Hasura-User-Id")},
+				Check:   hasura.Field("id", hasura.Eq(hasura.XHasuraUserID)),
+				Filter:  hasura.Field("id", hasura.Eq(hasura.XHasuraUserID)),
 			},
 		},
 	}
@@ -0,0 +1,55 @@
+package enthasura
+
+import (
+	"entgo.io/ent/entc"
+	"entgo.io/ent/entc/gen"
+	"github.com/pkg/errors"
+)
+
+// Extension is an entc.Extension that validates the Hasura annotations of the graph loaded by ent
+// codegen and writes its Hasura metadata, so a broken annotation fails go generate:
+//
+//	ex := enthasura.NewExtension(enthasura.HasuraMetadataConfig{
+//		OutputMetadataFile: "../hasura/metadata.json",
+//	})
+//	err := entc.Generate("./schema", &gen.Config{}, entc.Extensions(ex))
+type Extension struct {
+	entc.DefaultExtension
+	config HasuraMetadataConfig
+}
+
+// NewExtension returns an extension writing the metadata file and directory of config. The schema
+// path is ignored, empty schema and source names fall back to DefaultHasuraMetadataConfig.
+func NewExtension(config HasuraMetadataConfig) *Extension {
+	if config.SchemaName == "" {
+		config.SchemaName = DefaultHasuraMetadataConfig.SchemaName
+	}
+
+	if config.Source == "" {
+		config.Source = DefaultHasuraMetadataConfig.Source
+	}
+
+	return &Extension{config: config}
+}
+
+// Hooks returns the hook validating the graph before the code generation and writing the metadata
+// after it.
+func (e *Extension) Hooks() []gen.Hook {
+	return []gen.Hook{e.hook}
+}
+
+func (e *Extension) hook(next gen.Generator) gen.Generator {
+	return gen.GenerateFunc(func(graph *gen.Graph) error {
+		if err := validateGraph(graph, e.config.SchemaName, e.config.Naming); err != nil {
+			return err
+		}
+
+		if err := next.Generate(graph); err != nil {
+			return err
+		}
+
+		return errors.WithMessage(createMetadataFromGraph(graph, &e.config), "generating hasura metadata")
+	})
+}
+
+var _ entc.Extension = (*Extension)(nil)
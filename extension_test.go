@@ -0,0 +1,94 @@
+package enthasura_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"entgo.io/ent/entc/gen"
+	enthasura "github.com/minskylab/ent-hasura"
+)
+
+// generate runs the hook of the extension on the graph, and reports whether the code generation ran.
+func generate(t *testing.T, ex *enthasura.Extension, graph *gen.Graph) (bool, error) {
+	t.Helper()
+
+	generated := false
+	next := gen.GenerateFunc(func(*gen.Graph) error {
+		generated = true
+		return nil
+	})
+
+	hooks := ex.Hooks()
+	if len(hooks) != 1 {
+		t.Fatalf("got %d hooks, want 1", len(hooks))
+	}
+
+	return generated, hooks[0](next).Generate(graph)
+}
+
+func TestExtensionWritesMetadata(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "hasura", "metadata.json")
+
+	ex := enthasura.NewExtension(enthasura.HasuraMetadataConfig{OutputMetadataFile: output})
+
+	graph := basicGraph(t)
+
+	generated, err := generate(t, ex, graph)
+	if err != nil {
+		t.Fatalf("generating: %+v", err)
+	}
+
+	if !generated {
+		t.Error("the hook did not run the code generation")
+	}
+
+	data, err := ioutil.ReadFile(output)
+	if err != nil {
+		t.Fatalf("reading the metadata file: %s", err)
+	}
+
+	written := &enthasura.Metadata{}
+	if err := json.Unmarshal(data, written); err != nil {
+		t.Fatalf("decoding the metadata file: %s", err)
+	}
+
+	want, err := enthasura.BuildMetadata(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := renderTables(t, written), renderTables(t, want); string(got) != string(want) {
+		t.Errorf("written metadata differs from BuildMetadata\ngot:\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestExtensionRejectsInvalidAnnotations(t *testing.T) {
+	output := filepath.Join(t.TempDir(), "hasura", "metadata.json")
+
+	ex := enthasura.NewExtension(enthasura.HasuraMetadataConfig{OutputMetadataFile: output})
+
+	post := Post{permission: enthasura.PermissionsRoleAnnotation{
+		Role: "user",
+		SelectPermission: &enthasura.SelectPermission{
+			Columns: enthasura.Columns("id"),
+			Filter:  enthasura.Exists("public", "authors", enthasura.Field("email", enthasura.Eq(enthasura.XHasuraUserID))),
+		},
+	}}
+
+	generated, err := generate(t, ex, loadGraph(t, Author{}, post))
+
+	if _, isOk := err.(enthasura.ValidationErrors); !isOk {
+		t.Fatalf("got %+v, want validation errors", err)
+	}
+
+	if generated {
+		t.Error("the code generation ran with invalid annotations")
+	}
+
+	if _, err := os.Stat(filepath.Dir(output)); !os.IsNotExist(err) {
+		t.Errorf("the metadata directory is written with invalid annotations: %v", err)
+	}
+}
@@ -0,0 +1,117 @@
+package enthasura
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// decodeWithExtra decodes the JSON object into v, a pointer to a struct without json methods, and
+// returns the fields of the object v has no field for.
+func decodeWithExtra(data []byte, v interface{}) (map[string]json.RawMessage, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	fields := map[string]json.RawMessage{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(v).Elem())
+
+	for name := range fields {
+		if isJSONField(known, name) {
+			delete(fields, name)
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	return fields, nil
+}
+
+// encodeWithExtra encodes v and appends the extra fields it has no field for, sorted by name.
+func encodeWithExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, errors.WithStack(err)
+	}
+
+	known := jsonFieldNames(reflect.TypeOf(v))
+
+	names := []string{}
+	for name := range extra {
+		if !isJSONField(known, name) {
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+
+	buf := bytes.NewBuffer(data[:len(data)-1])
+
+	for _, name := range names {
+		key, err := json.Marshal(name)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(extra[name])
+	}
+
+	buf.WriteByte('}')
+
+	return buf.Bytes(), nil
+}
+
+// jsonFieldNames returns the names encoding/json uses for the fields of the struct type, including
+// the ones of embedded structs.
+func jsonFieldNames(t reflect.Type) []string {
+	names := []string{}
+
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+
+		switch {
+		case name == "-":
+			continue
+		case field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct:
+			names = append(names, jsonFieldNames(field.Type)...)
+			continue
+		case field.PkgPath != "":
+			continue
+		case name == "":
+			name = field.Name
+		}
+
+		names = append(names, name)
+	}
+
+	return names
+}
+
+// isJSONField reports if the key is decoded into one of the fields, which encoding/json matches
+// case insensitively.
+func isJSONField(fields []string, key string) bool {
+	for _, field := range fields {
+		if strings.EqualFold(field, key) {
+			return true
+		}
+	}
+
+	return false
+}
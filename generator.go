@@ -5,8 +5,6 @@ import (
 
 	"entgo.io/ent/dialect/sql/schema"
 	"entgo.io/ent/entc/gen"
-	pluralize "github.com/gertd/go-pluralize"
-	"github.com/iancoleman/strcase"
 	"github.com/minskylab/hasura-api/metadata"
 	"github.com/pkg/errors"
 	logger "github.com/sirupsen/logrus"
@@ -19,178 +17,246 @@ const (
 	aggregateVerbName = "aggregate"
 )
 
-func basicDefinition(pluralize *pluralize.Client, tableName, nodeName, schemaName string) (*metadata.TableDefinition, error) {
-	definition := &metadata.TableDefinition{}
+func basicDefinition(naming NamingStrategy, tableName, nodeName, schemaName string) (*Table, error) {
+	definition := &Table{}
 
 	definition.Table = metadata.QualifiedTableName{
 		Name:   tableName,
 		Schema: schemaName,
 	}
 
-	singularName := strcase.ToCamel(pluralize.Singular(nodeName))
-	pluralName := strcase.ToCamel(pluralize.Plural(nodeName))
-
-	aggregationSuffix := strcase.ToCamel(aggregateVerbName)
-
-	if singularName == pluralName {
-		logger.Warn("singular-plural equality found")
-		logger.Warn(singularName, " table:", tableName, " node:", nodeName, " schema:", schemaName)
-		pluralName = pluralName + "s"
-	}
-
-	definition.Configuration = &metadata.TableConfiguration{
-		CustomRootFields:  &metadata.CustomRootFields{},
-		CustomColumnNames: map[string]string{},
+	definition.Configuration = &TableConfiguration{
+		TableConfiguration: metadata.TableConfiguration{
+			CustomRootFields:  naming.RootFields(tableName, nodeName),
+			CustomColumnNames: map[string]string{},
+		},
 	}
 
-	definition.Configuration.CustomName = nodeName
-	definition.Configuration.CustomRootFields = &metadata.CustomRootFields{
-		Insert:          strcase.ToLowerCamel(insertVerbName + pluralName),
-		InsertOne:       strcase.ToLowerCamel(insertVerbName + singularName),
-		Select:          strcase.ToLowerCamel(pluralName),
-		SelectByPk:      strcase.ToLowerCamel(singularName),
-		SelectAggregate: strcase.ToLowerCamel(pluralName + aggregationSuffix),
-		Update:          strcase.ToLowerCamel(updateVerbName + pluralName),
-		UpdateByPk:      strcase.ToLowerCamel(updateVerbName + singularName),
-		Delete:          strcase.ToLowerCamel(deleteVerbName + pluralName),
-		DeleteByPk:      strcase.ToLowerCamel(deleteVerbName + singularName),
-	}
+	definition.Configuration.CustomName = naming.TypeName(tableName, nodeName)
 
 	return definition, nil
 }
 
-func hasuraTableMetadataFromNode(pluralize *pluralize.Client, node *gen.Type, schemaName string) (*metadata.TableDefinition, error) {
-	definition, err := basicDefinition(pluralize, node.Table(), node.Name, schemaName)
+func hasuraTableMetadataFromNode(naming NamingStrategy, node *gen.Type, schemas *tableSchemas) (*Table, error) {
+	definition, err := basicDefinition(naming, node.Table(), node.Name, schemas.schema(node.Table()))
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
+	// the id column keeps its name unless it has a custom storage key.
+	if node.ID != nil && node.ID.StorageKey() != "id" {
+		definition.Configuration.CustomColumnNames[node.ID.StorageKey()] = naming.ColumnName(node.ID.StorageKey(), node.ID.Name)
+	}
+
 	for _, field := range node.Fields {
-		name := strcase.ToLowerCamel(field.Name)
 		columnName := field.Column().Name
-
-		definition.Configuration.CustomColumnNames[columnName] = name
+		definition.Configuration.CustomColumnNames[columnName] = naming.ColumnName(columnName, field.Name)
 	}
 
 	for _, edge := range node.Edges {
-		if edge.M2O() || edge.O2O() {
+		if (edge.M2O() || edge.O2O()) && (edge.M2O() || edge.OwnFK()) {
 			name := edge.Rel.Column()
-			realName := strcase.ToLowerCamel(edge.Name)
+			definition.Configuration.CustomColumnNames[name] = naming.ForeignKeyName(name, edge.Name)
+		}
+	}
 
-			var foreignKey interface{} = name
+	// the GraphQL names of the column annotations win over the names of fields and foreign keys
+	for _, field := range node.Fields {
+		ann, err := columnAnnotationFromField(field)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
 
-			fieldName := realName + "ID"
+		if ann != nil && ann.GraphQLName != "" {
+			definition.Configuration.CustomColumnNames[field.Column().Name] = ann.GraphQLName
+		}
+	}
 
-			if edge.M2O() {
-				definition.Configuration.CustomColumnNames[name] = fieldName
-			}
+	definition.Configuration.ColumnConfig, err = columnConfig(node, definition.Configuration.CustomColumnNames)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
 
-			if edge.OwnFK() {
-				fieldName = strcase.ToLowerCamel(realName) + "ID"
-				definition.Configuration.CustomColumnNames[name] = fieldName
-			}
+	for _, edge := range node.Edges {
+		if skipRelationship(edge) || schemas.skip(edge.Type.Table()) || schemas.skip(edge.Rel.Table) {
+			logger.Infof("skipping relationship of edge %s of %s", edge.Name, node.Name)
+			continue
+		}
+
+		if edge.M2O() || edge.O2O() {
+			name := edge.Rel.Column()
+			realName := relationshipName(naming, edge)
+
+			using := metadata.ObjRelUsing{ForeignKeyConstraintOn: metadata.SameTable(name)}
 
 			if !edge.OwnFK() {
-				foreignKey = metadata.RemoteTable{
+				using.ForeignKeyConstraintOn = metadata.RemoteTable{
 					Column: name,
 					Table: metadata.QualifiedTableName{
-						Schema: schemaName,
+						Schema: schemas.schema(edge.Rel.Table),
 						Name:   edge.Rel.Table,
 					},
 				}
 			}
 
-			definition.ObjectRelationships = append(definition.ObjectRelationships, &metadata.ObjectRelationship{
-				Name: realName,
-				Using: metadata.Using{
-					ForeignKeyConstraintOn: foreignKey,
-				},
+			if manualRelationship(edge) {
+				using = manualObjectRelationship(node, edge, schemas)
+			}
+
+			definition.ObjectRelationships = append(definition.ObjectRelationships, &Relationship{
+				Name:  realName,
+				Using: using,
 			})
 		}
 
 		if edge.M2M() || edge.O2M() {
-			realName := strcase.ToLowerCamel(edge.Name)
+			realName := relationshipName(naming, edge)
 
-			if edge.Ref == nil || len(edge.Ref.Rel.Columns) < 1 {
-				continue
-			}
+			var columnName string
 
-			columnName := edge.Ref.Rel.Columns[0]
+			switch {
+			case edge.M2M():
+				columnName, _ = joinColumns(edge)
+			case len(edge.Rel.Columns) > 0:
+				columnName = edge.Rel.Column()
+			}
 
-			if edge.M2M() {
-				columnName = strcase.ToSnake(node.Name) + "_id"
+			if columnName == "" {
+				continue
 			}
 
 			tableName := edge.Rel.Table
 
-			definition.ArrayRelationships = append(definition.ArrayRelationships, &metadata.ArrayRelationship{
-				Name: realName,
-				Using: metadata.UsingArray{
-					ForeignKeyConstraintOn: metadata.RemoteTable{
-						Column: columnName,
-						Table: metadata.QualifiedTableName{
-							Schema: schemaName,
+			using := metadata.ArrRelUsing{
+				ForeignKeyConstraintOn: &metadata.ArrRelUsingFKeyOn{
+					Column: columnName,
+					Table: metadata.QualifiedTableName{
+						Schema: schemas.schema(tableName),
+						Name:   tableName,
+					},
+				},
+			}
+
+			if manualRelationship(edge) {
+				using = metadata.ArrRelUsing{
+					ManualConfiguration: &metadata.ArrRelUsingManualMapping{
+						RemoteTable: metadata.QualifiedTableName{
+							Schema: schemas.schema(tableName),
 							Name:   tableName,
 						},
+						ColumnMapping: map[string]string{node.ID.StorageKey(): columnName},
 					},
-				},
+				}
+			}
+
+			definition.ArrayRelationships = append(definition.ArrayRelationships, &Relationship{
+				Name:  realName,
+				Using: using,
 			})
 		}
 	}
 
+	// foreign keys of edges declared only on the other side, e.g. a unidirectional O2M edge.
+	for _, fk := range node.ForeignKeys {
+		column := fk.Field.StorageKey()
+		if _, isOk := definition.Configuration.CustomColumnNames[column]; !isOk && !fk.UserDefined {
+			definition.Configuration.CustomColumnNames[column] = naming.ColumnName(column, "")
+		}
+	}
+
 	return definition, nil
 }
 
-func hasuraTableFromRelationalTable(pluralize *pluralize.Client, table *schema.Table, schemaName string) (*metadata.TableDefinition, error) {
-	customName := strcase.ToCamel(pluralize.Singular(table.Name))
+// manualObjectRelationship maps the foreign key of a M2O or O2O edge with a manual_configuration.
+func manualObjectRelationship(node *gen.Type, edge *gen.Edge, schemas *tableSchemas) metadata.ObjRelUsing {
+	column := edge.Rel.Column()
+	mapping := map[string]string{column: edge.Type.ID.StorageKey()}
+	remote := edge.Type.Table()
 
-	definition, err := basicDefinition(pluralize, table.Name, customName, schemaName)
+	if !edge.OwnFK() {
+		mapping = map[string]string{node.ID.StorageKey(): column}
+		remote = edge.Rel.Table
+	}
+
+	return metadata.ObjRelUsing{
+		ManualConfiguration: &metadata.ObjRelUsingManualMapping{
+			RemoteTable: metadata.QualifiedTableName{
+				Schema: schemas.schema(remote),
+				Name:   remote,
+			},
+			ColumnMapping: mapping,
+		},
+	}
+}
+
+// hasuraTableFromRelationalTable returns the definition of a join table, with an object relationship
+// for each of its foreign keys.
+func hasuraTableFromRelationalTable(naming NamingStrategy, table *schema.Table, edges []joinEdge, schemas *tableSchemas) (*Table, error) {
+	definition, err := basicDefinition(naming, table.Name, "", schemas.schema(table.Name))
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
 	for _, field := range table.Columns {
-		words := strings.Split(field.Name, "_")
+		definition.Configuration.CustomColumnNames[field.Name] = naming.ColumnName(field.Name, "")
+	}
 
-		for i, word := range words {
-			if strings.ToLower(word) == "id" {
-				words[i] = "ID"
-			}
+	for _, fk := range table.ForeignKeys {
+		if len(fk.Columns) != 1 {
+			logger.Warnf("skipping foreign key %s of %s with %d columns", fk.Symbol, table.Name, len(fk.Columns))
+			continue
 		}
 
-		newFieldName := strings.Join(words, "_")
-
-		name := strcase.ToLowerCamel(newFieldName)
-		nameWithoutID := strcase.ToLowerCamel(strings.ReplaceAll(newFieldName, "ID", ""))
+		column := fk.Columns[0].Name
 
-		definition.Configuration.CustomColumnNames[field.Name] = name
+		using := metadata.ObjRelUsing{ForeignKeyConstraintOn: metadata.SameTable(column)}
 
-		var foreignKey interface{} = field.Name
+		if target := manualJoinColumnTarget(edges, column); target != nil {
+			using = metadata.ObjRelUsing{
+				ManualConfiguration: &metadata.ObjRelUsingManualMapping{
+					RemoteTable: metadata.QualifiedTableName{
+						Schema: schemas.schema(target.Table()),
+						Name:   target.Table(),
+					},
+					ColumnMapping: map[string]string{column: target.ID.StorageKey()},
+				},
+			}
+		}
 
-		definition.ObjectRelationships = append(definition.ObjectRelationships, &metadata.ObjectRelationship{
-			Name: nameWithoutID,
-			Using: metadata.Using{
-				ForeignKeyConstraintOn: foreignKey,
-			},
+		definition.ObjectRelationships = append(definition.ObjectRelationships, &Relationship{
+			Name:  joinColumnRelationshipName(naming, edges, column),
+			Using: using,
 		})
 	}
 
 	return definition, nil
 }
 
-func obtainHasuraTablesFromEntSchema(schema *gen.Graph, schemaName string) ([]*metadata.TableDefinition, error) {
-	pluralize := pluralize.NewClient()
+// joinRelationshipName returns the name of the relationship of a join table column.
+func joinRelationshipName(naming NamingStrategy, column string) string {
+	return naming.RelationshipName(strings.TrimSuffix(column, "_id"))
+}
+
+func obtainHasuraTablesFromEntSchema(schema *gen.Graph, schemaName string, naming NamingStrategy) ([]*Table, error) {
+	naming = namingOrDefault(naming)
+
+	schemas := newTableSchemas(schema, schemaName)
 
-	tables := []*metadata.TableDefinition{}
+	tables := []*Table{}
 	mappedNodes := []string{}
 
 	for _, node := range schema.Nodes {
-		definition, err := hasuraTableMetadataFromNode(pluralize, node, schemaName)
+		mappedNodes = append(mappedNodes, node.Table())
+
+		if schemas.skip(node.Table()) {
+			continue
+		}
+
+		definition, err := hasuraTableMetadataFromNode(naming, node, schemas)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
 
-		mappedNodes = append(mappedNodes, node.Table())
 		tables = append(tables, definition)
 	}
 
@@ -199,12 +265,14 @@ func obtainHasuraTablesFromEntSchema(schema *gen.Graph, schemaName string) ([]*m
 		return nil, errors.WithStack(err)
 	}
 
+	edges := joinEdges(schema)
+
 	for _, table := range schemaTables {
-		if elementInArray(mappedNodes, table.Name) {
+		if elementInArray(mappedNodes, table.Name) || schemas.skip(table.Name) {
 			continue
 		}
 
-		definition, err := hasuraTableFromRelationalTable(pluralize, table, schemaName)
+		definition, err := hasuraTableFromRelationalTable(naming, table, edges[table.Name], schemas)
 		if err != nil {
 			return nil, errors.WithStack(err)
 		}
@@ -214,43 +282,3 @@ func obtainHasuraTablesFromEntSchema(schema *gen.Graph, schemaName string) ([]*m
 
 	return tables, nil
 }
-
-// func hasuraMetadataFromEntSchema(schema *gen.Graph, schemaName string) (*Metadata, error) {
-// 	metadata := &Metadata{}
-
-// 	tables, err := obtainHasuraTablesFromEntSchema(schema, schemaName)
-// 	if err != nil {
-// 		return nil, errors.WithStack(err)
-// 	}
-
-// 	metadata.Sources = append(metadata.Sources, &Source{
-// 		Tables: tables,
-// 	})
-
-// 	return metadata, nil
-// }
-
-// func generateFile(metadata HasuraMetadata, outputFile string) error {
-// 	data, err := json.MarshalIndent(metadata, "", "  ")
-// 	if err != nil {
-// 		return errors.WithStack(err)
-// 	}
-
-// 	if err := os.MkdirAll(filepath.Dir(outputFile), os.ModePerm); err != nil {
-// 		return errors.WithStack(err)
-// 	}
-
-// 	return ioutil.WriteFile(outputFile, []byte(data), 0644)
-// }
-
-// func generateRawMetadata(graph *gen.Graph, schemaName, outputFile string) error {
-// 	hMetadata := HasuraMetadata{}
-
-// 	metadata, err := hasuraMetadataFromEntSchema(graph, schemaName)
-// 	if err != nil {
-// 		return errors.WithStack(err)
-// 	}
-
-// 	hMetadata.Metadata = metadata
-// 	return generateFile(hMetadata, outputFile)
-// }
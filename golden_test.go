@@ -0,0 +1,272 @@
+package enthasura_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"entgo.io/ent"
+	"entgo.io/ent/entc"
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/entc/load"
+	enthasura "github.com/minskylab/ent-hasura"
+	basic "github.com/minskylab/ent-hasura/example/basic/ent/schema"
+	"github.com/minskylab/ent-hasura/testdata/fixtures/customids"
+	"github.com/minskylab/ent-hasura/testdata/fixtures/edgeannotations"
+	"github.com/minskylab/ent-hasura/testdata/fixtures/roles"
+	"github.com/minskylab/ent-hasura/testdata/fixtures/selfref"
+	"github.com/minskylab/ent-hasura/testdata/fixtures/storagekeys"
+	"github.com/minskylab/ent-hasura/testdata/fixtures/tableannotations"
+	"github.com/minskylab/ent-hasura/testdata/fixtures/unidirectional"
+)
+
+var update = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// loaderProbeEnv makes the test binary only try entc.LoadGraph, see entcLoaderWorks.
+const loaderProbeEnv = "ENTHASURA_LOADER_PROBE"
+
+// fixtures are loaded from their directory, schemas are the same schemas compiled in the tests.
+var fixtures = []struct {
+	name    string
+	dir     string
+	schemas []ent.Interface
+}{
+	{name: "basic", dir: "example/basic/ent/schema", schemas: []ent.Interface{basic.User{}, basic.Note{}, basic.Like{}}},
+	{name: "selfref", dir: "testdata/fixtures/selfref", schemas: selfref.Schemas},
+	{name: "unidirectional", dir: "testdata/fixtures/unidirectional", schemas: unidirectional.Schemas},
+	{name: "roles", dir: "testdata/fixtures/roles", schemas: roles.Schemas},
+	{name: "storagekeys", dir: "testdata/fixtures/storagekeys", schemas: storagekeys.Schemas},
+	{name: "customids", dir: "testdata/fixtures/customids", schemas: customids.Schemas},
+	{name: "edgeannotations", dir: "testdata/fixtures/edgeannotations", schemas: edgeannotations.Schemas},
+	{name: "tableannotations", dir: "testdata/fixtures/tableannotations", schemas: tableannotations.Schemas},
+}
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+
+	if dir := os.Getenv(loaderProbeEnv); dir != "" {
+		if _, err := entc.LoadGraph(dir, &gen.Config{}); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+// TestGoldenMetadata compares the metadata, queries and plan of every fixture with the golden files,
+// building the graph from the compiled schemas and loading it from the fixture directory with
+// entc.LoadGraph, the way the commands load the schema of users.
+func TestGoldenMetadata(t *testing.T) {
+	for _, fixture := range fixtures {
+		fixture := fixture
+
+		t.Run(fixture.name+"/compiled", func(t *testing.T) {
+			assertGoldenGraph(t, fixture.name, loadGraph(t, fixture.schemas...))
+		})
+
+		t.Run(fixture.name+"/loader", func(t *testing.T) {
+			if works, reason := entcLoaderWorks(fixture.dir); !works {
+				t.Skipf("entc.LoadGraph can not run with this toolchain: %s", reason)
+			}
+
+			graph, err := entc.LoadGraph(fixture.dir, &gen.Config{})
+			if err != nil {
+				t.Fatalf("loading %s: %+v", fixture.dir, err)
+			}
+
+			assertGoldenGraph(t, fixture.name, graph)
+		})
+	}
+}
+
+// assertGoldenGraph compares the metadata, queries and plan of the graph with the golden files of
+// the fixture.
+func assertGoldenGraph(t *testing.T, name string, graph *gen.Graph) {
+	t.Helper()
+
+	m, err := enthasura.BuildMetadata(graph)
+	if err != nil {
+		t.Fatalf("building metadata: %+v", err)
+	}
+
+	assertGolden(t, name+".json", renderMetadata(t, m))
+
+	queries, err := enthasura.BuildQueries(graph)
+	if err != nil {
+		t.Fatalf("building queries: %+v", err)
+	}
+
+	data, err := json.MarshalIndent(queries, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, name+".queries.json", append(data, '\n'))
+
+	plan, err := enthasura.PlanFullGraphTransform(graph, "default", "public", nil)
+	if err != nil {
+		t.Fatalf("planning: %+v", err)
+	}
+
+	text := &bytes.Buffer{}
+	if err := plan.WriteText(text); err != nil {
+		t.Fatal(err)
+	}
+
+	assertGolden(t, name+".plan.txt", text.Bytes())
+}
+
+// assertGolden compares got with the golden file, or writes it when the tests run with -update.
+func assertGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+
+	golden := filepath.Join("testdata", "golden", name)
+
+	if *update {
+		if err := ioutil.WriteFile(golden, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+
+	want, err := ioutil.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("reading golden file, run the tests with -update to create it: %s", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s differs, run the tests with -update if the change is expected\ngot:\n%s", golden, got)
+	}
+}
+
+var (
+	loaderOnce  sync.Once
+	loaderError string
+)
+
+// entcLoaderWorks reports whether entc.LoadGraph can load packages with the Go toolchain of the
+// tests. The loader of old golang.org/x/tools versions exits the process with newer toolchains, so it
+// is tried once in a child process.
+func entcLoaderWorks(dir string) (bool, string) {
+	loaderOnce.Do(func() {
+		cmd := exec.Command(os.Args[0], "-test.run=^$")
+		cmd.Env = append(os.Environ(), loaderProbeEnv+"="+dir)
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			loaderError = strings.TrimSpace(string(out))
+			if loaderError == "" {
+				loaderError = err.Error()
+			}
+		}
+	})
+
+	return loaderError == "", loaderError
+}
+
+// loadGraph builds the graph of the schemas like entc.LoadGraph does once the schema package is
+// compiled, without loading the package from its directory. The schemas are sorted by name like the
+// loader does.
+func loadGraph(t *testing.T, schemas ...ent.Interface) *gen.Graph {
+	t.Helper()
+
+	loaded := []*load.Schema{}
+
+	for _, s := range schemas {
+		data, err := load.MarshalSchema(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		schema, err := load.UnmarshalSchema(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		loaded = append(loaded, schema)
+	}
+
+	sort.Slice(loaded, func(i, j int) bool { return loaded[i].Name < loaded[j].Name })
+
+	storage, err := gen.NewStorage("sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	graph, err := gen.NewGraph(&gen.Config{Package: "fixture/ent", Storage: storage}, loaded...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return graph
+}
+
+// renderMetadata renders the metadata as indented JSON, with the tables, relationships, permissions
+// and event triggers sorted so the output does not depend on the order of the schemas.
+func renderMetadata(t *testing.T, m *enthasura.Metadata) []byte {
+	t.Helper()
+
+	for _, source := range m.Sources {
+		sort.Slice(source.Tables, func(i, j int) bool {
+			a, b := source.Tables[i].Table, source.Tables[j].Table
+			if a.Schema != b.Schema {
+				return a.Schema < b.Schema
+			}
+			return a.Name < b.Name
+		})
+
+		for _, table := range source.Tables {
+			sortRelationships(table.ObjectRelationships)
+			sortRelationships(table.ArrayRelationships)
+
+			for _, perms := range [][]*enthasura.RolePermission{
+				table.InsertPermissions, table.SelectPermissions, table.UpdatePermissions, table.DeletePermissions,
+			} {
+				sort.Slice(perms, func(i, j int) bool { return perms[i].Role < perms[j].Role })
+			}
+
+			sort.Slice(table.EventTriggers, func(i, j int) bool {
+				return eventTriggerName(t, table.EventTriggers[i]) < eventTriggerName(t, table.EventTriggers[j])
+			})
+		}
+	}
+
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return append(data, '\n')
+}
+
+func sortRelationships(rels []*enthasura.Relationship) {
+	sort.Slice(rels, func(i, j int) bool { return rels[i].Name < rels[j].Name })
+}
+
+func eventTriggerName(t *testing.T, trigger interface{}) string {
+	data, err := json.Marshal(trigger)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	named := struct {
+		Name string `json:"name"`
+	}{}
+
+	if err := json.Unmarshal(data, &named); err != nil {
+		t.Fatal(err)
+	}
+
+	return named.Name
+}
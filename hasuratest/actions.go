@@ -0,0 +1,140 @@
+package hasuratest
+
+import (
+	"encoding/json"
+
+	enthasura "github.com/minskylab/ent-hasura"
+	"github.com/minskylab/hasura-api/metadata"
+)
+
+// applyActionQuery applies set_custom_types and the action queries to m.
+func applyActionQuery(m *enthasura.Metadata, query metadata.MetadataQuery) error {
+	if query.Type == metadata.SetCustomTypes {
+		types := &enthasura.CustomTypes{}
+		if err := decodeArgs(query, types); err != nil {
+			return err
+		}
+
+		m.CustomTypes = types
+
+		return nil
+	}
+
+	actions, err := decodeActions(m.Actions)
+	if err != nil {
+		return err
+	}
+
+	switch query.Type {
+	case metadata.CreateAction, metadata.UpdateAction:
+		args := &enthasura.ActionArgs{}
+		if err := decodeArgs(query, args); err != nil {
+			return err
+		}
+
+		existing := findAction(actions, args.Name)
+
+		switch {
+		case query.Type == metadata.CreateAction && existing != nil:
+			return queryErrorf("already-exists", "action %q already exists", args.Name)
+		case query.Type == metadata.UpdateAction && existing == nil:
+			return queryErrorf("not-exists", "action %q does not exist", args.Name)
+		case existing != nil:
+			existing.Definition, existing.Comment = args.Definition, args.Comment
+		default:
+			actions = append(actions, &enthasura.ActionMetadata{Name: args.Name, Definition: args.Definition, Comment: args.Comment})
+		}
+	case metadata.DropAction:
+		args := &enthasura.DropActionArgs{}
+		if err := decodeArgs(query, args); err != nil {
+			return err
+		}
+
+		kept := []*enthasura.ActionMetadata{}
+		for _, action := range actions {
+			if action.Name != args.Name {
+				kept = append(kept, action)
+			}
+		}
+
+		if len(kept) == len(actions) {
+			return queryErrorf("not-exists", "action %q does not exist", args.Name)
+		}
+
+		actions = kept
+	case metadata.CreateActionPermission, metadata.DropActionPermission:
+		args := &enthasura.ActionPermissionArgs{}
+		if err := decodeArgs(query, args); err != nil {
+			return err
+		}
+
+		action := findAction(actions, args.Action)
+		if action == nil {
+			return queryErrorf("not-exists", "action %q does not exist", args.Action)
+		}
+
+		if err := setActionPermission(action, args, query.Type == metadata.CreateActionPermission); err != nil {
+			return err
+		}
+	}
+
+	m.Actions = []interface{}{}
+	for _, action := range actions {
+		m.Actions = append(m.Actions, action)
+	}
+
+	return nil
+}
+
+// setActionPermission adds the permission of the role to the action, or removes it.
+func setActionPermission(action *enthasura.ActionMetadata, args *enthasura.ActionPermissionArgs, create bool) error {
+	for i, perm := range action.Permissions {
+		if perm.Role != args.Role {
+			continue
+		}
+
+		if create {
+			return queryErrorf("already-exists", "permission for role %q already exists on action %q", args.Role, args.Action)
+		}
+
+		action.Permissions = append(action.Permissions[:i], action.Permissions[i+1:]...)
+
+		return nil
+	}
+
+	if !create {
+		return queryErrorf("not-exists", "permission for role %q does not exist on action %q", args.Role, args.Action)
+	}
+
+	action.Permissions = append(action.Permissions, &enthasura.ActionPermission{Role: args.Role, Comment: args.Comment})
+
+	return nil
+}
+
+func decodeActions(raw []interface{}) ([]*enthasura.ActionMetadata, error) {
+	actions := []*enthasura.ActionMetadata{}
+	if len(raw) == 0 {
+		return actions, nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return nil, queryErrorf("unexpected", "encoding actions: %s", err)
+	}
+
+	if err := json.Unmarshal(data, &actions); err != nil {
+		return nil, queryErrorf("unexpected", "decoding actions: %s", err)
+	}
+
+	return actions, nil
+}
+
+func findAction(actions []*enthasura.ActionMetadata, name string) *enthasura.ActionMetadata {
+	for _, action := range actions {
+		if action.Name == name {
+			return action
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,235 @@
+// Package hasuratest provides an in-memory enthasura.MetadataClient, to assert the metadata the
+// runtime applies without a running Hasura engine.
+package hasuratest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	enthasura "github.com/minskylab/ent-hasura"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+)
+
+const (
+	defaultSource = "default"
+	defaultSchema = "public"
+)
+
+// MetadataClient keeps the metadata of a Hasura engine in memory. Bulk applies the track, untrack,
+// customize, relationship, permission, event trigger and action queries atomically like the engine:
+// when a query fails the metadata is left untouched and an enthasura.ErrorResponse with the path of
+// the query is returned.
+type MetadataClient struct {
+	mu              sync.Mutex
+	metadata        *enthasura.Metadata
+	resourceVersion int
+	queries         []metadata.MetadataQuery
+	inconsistent    []*enthasura.InconsistentObject
+}
+
+var _ enthasura.MetadataClient = (*MetadataClient)(nil)
+
+// NewMetadataClient returns a client with an empty postgres source for every name, or a "default"
+// source if none is given.
+func NewMetadataClient(sourceNames ...string) *MetadataClient {
+	if len(sourceNames) == 0 {
+		sourceNames = []string{defaultSource}
+	}
+
+	m := &enthasura.Metadata{Version: 3, Sources: []*enthasura.Source{}}
+	for _, name := range sourceNames {
+		m.Sources = append(m.Sources, newSource(name))
+	}
+
+	return &MetadataClient{metadata: m, resourceVersion: 1}
+}
+
+func newSource(name string) *enthasura.Source {
+	return &enthasura.Source{
+		Name:          name,
+		Kind:          "postgres",
+		Tables:        []*enthasura.Table{},
+		Configuration: map[string]interface{}{},
+	}
+}
+
+// Bulk applies the queries in order, all of them or none.
+func (c *MetadataClient) Bulk(queries []metadata.MetadataQuery) (metadata.MetadataResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m, err := cloneMetadata(c.metadata)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	results := metadata.ArrayResponse{}
+
+	for i, query := range queries {
+		if err := applyQuery(m, query); err != nil {
+			return errorResponse(fmt.Sprintf("$.args[%d].args", i), err), nil
+		}
+
+		results = append(results, successResponse())
+	}
+
+	c.metadata = m
+	c.resourceVersion++
+	c.queries = append(c.queries, queries...)
+
+	return results, nil
+}
+
+// ClearMetadata removes everything but the sources, which are left without tables.
+func (c *MetadataClient) ClearMetadata() (metadata.MetadataResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	m := &enthasura.Metadata{Version: 3, Sources: []*enthasura.Source{}}
+	for _, source := range c.metadata.Sources {
+		m.Sources = append(m.Sources, newSource(source.Name))
+	}
+
+	c.metadata = m
+	c.resourceVersion++
+	c.inconsistent = nil
+
+	return successResponse(), nil
+}
+
+// ExportMetadata returns a copy of the metadata, decoded from JSON like the one of an engine, along
+// with the raw document.
+func (c *MetadataClient) ExportMetadata() (*enthasura.HasuraMetadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	raw, err := json.Marshal(c.metadata)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	m := &enthasura.Metadata{}
+	if err := json.Unmarshal(raw, m); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &enthasura.HasuraMetadata{ResourceVersion: c.resourceVersion, Metadata: m, Raw: raw}, nil
+}
+
+// ReplaceMetadata replaces the whole metadata with the document.
+func (c *MetadataClient) ReplaceMetadata(m json.RawMessage) (metadata.MetadataResponse, error) {
+	if len(m) == 0 || string(m) == "null" {
+		return errorResponse("$.args", queryErrorf("parse-failed", "metadata is required")), nil
+	}
+
+	replaced := &enthasura.Metadata{}
+	if err := json.Unmarshal(m, replaced); err != nil {
+		return errorResponse("$.args", queryErrorf("parse-failed", "%s", err)), nil
+	}
+
+	if replaced.Sources == nil {
+		replaced.Sources = []*enthasura.Source{}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.metadata = replaced
+	c.resourceVersion++
+	c.inconsistent = nil
+
+	return successResponse(), nil
+}
+
+// GetInconsistentMetadata returns the objects set with SetInconsistentObjects, the metadata itself
+// is never inconsistent since the fake has no database.
+func (c *MetadataClient) GetInconsistentMetadata() (*enthasura.InconsistentMetadata, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	objects := []*enthasura.InconsistentObject{}
+	for _, obj := range c.inconsistent {
+		copied := *obj
+		objects = append(objects, &copied)
+	}
+
+	return &enthasura.InconsistentMetadata{IsConsistent: len(objects) == 0, InconsistentObjects: objects}, nil
+}
+
+// SetInconsistentObjects makes the engine report the objects as inconsistent, until the metadata is
+// cleared or replaced.
+func (c *MetadataClient) SetInconsistentObjects(objects ...*enthasura.InconsistentObject) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.inconsistent = objects
+}
+
+// Queries returns every query of the bulks applied so far, in order.
+func (c *MetadataClient) Queries() []metadata.MetadataQuery {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]metadata.MetadataQuery{}, c.queries...)
+}
+
+// Table returns a copy of a tracked table, or nil if the table is not tracked.
+func (c *MetadataClient) Table(sourceName, schemaName, tableName string) *enthasura.Table {
+	exported, err := c.ExportMetadata()
+	if err != nil {
+		return nil
+	}
+
+	source := findSource(exported.Metadata, sourceName)
+	if source == nil {
+		return nil
+	}
+
+	return findTable(source, tableRef{Schema: schemaName, Name: tableName})
+}
+
+func successResponse() metadata.ObjectResponse {
+	return metadata.ObjectResponse{"message": "success"}
+}
+
+func errorResponse(path string, err error) enthasura.ErrorResponse {
+	res := enthasura.ErrorResponse{StatusCode: http.StatusBadRequest, Path: path, Error: err.Error(), Code: "unexpected"}
+
+	if qErr, isOk := errors.Cause(err).(*queryError); isOk {
+		res.Code = qErr.code
+	}
+
+	return res
+}
+
+// queryError is a failing query, with the code the engine would answer.
+type queryError struct {
+	code    string
+	message string
+}
+
+func (e *queryError) Error() string {
+	return e.message
+}
+
+func queryErrorf(code, format string, args ...interface{}) error {
+	return &queryError{code: code, message: fmt.Sprintf(format, args...)}
+}
+
+// cloneMetadata copies the metadata through JSON, so the copy only holds decoded values.
+func cloneMetadata(m *enthasura.Metadata) (*enthasura.Metadata, error) {
+	data, err := json.Marshal(m)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	cloned := &enthasura.Metadata{}
+	if err := json.Unmarshal(data, cloned); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return cloned, nil
+}
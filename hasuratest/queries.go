@@ -0,0 +1,624 @@
+package hasuratest
+
+import (
+	"encoding/json"
+	"fmt"
+
+	enthasura "github.com/minskylab/ent-hasura"
+	"github.com/minskylab/hasura-api/metadata"
+)
+
+// tableRef is the table of a query, given as a plain name or as a schema qualified name.
+type tableRef struct {
+	Schema string `json:"schema"`
+	Name   string `json:"name"`
+}
+
+func (t *tableRef) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		t.Schema, t.Name = defaultSchema, name
+		return nil
+	}
+
+	type qualified tableRef
+
+	table := qualified{}
+	if err := json.Unmarshal(data, &table); err != nil {
+		return err
+	}
+
+	if table.Schema == "" {
+		table.Schema = defaultSchema
+	}
+
+	*t = tableRef(table)
+
+	return nil
+}
+
+func (t tableRef) qualified() metadata.QualifiedTableName {
+	return metadata.QualifiedTableName{Schema: t.Schema, Name: t.Name}
+}
+
+func (t tableRef) String() string {
+	return t.Schema + "." + t.Name
+}
+
+type tableArgs struct {
+	Table  tableRef `json:"table"`
+	Source string   `json:"source"`
+}
+
+type tableConfigurationArgs struct {
+	tableArgs
+	Configuration *enthasura.TableConfiguration `json:"configuration"`
+}
+
+type untrackTableArgs struct {
+	tableArgs
+	Cascade bool `json:"cascade"`
+}
+
+type relationshipArgs struct {
+	tableArgs
+	Name    string                 `json:"name"`
+	Using   map[string]interface{} `json:"using"`
+	Comment string                 `json:"comment"`
+}
+
+type dropRelationshipArgs struct {
+	tableArgs
+	Relationship string `json:"relationship"`
+}
+
+type permissionArgs struct {
+	tableArgs
+	Role       string                 `json:"role"`
+	Permission map[string]interface{} `json:"permission"`
+	Comment    string                 `json:"comment"`
+}
+
+type deleteEventTriggerArgs struct {
+	Name   string `json:"name"`
+	Source string `json:"source"`
+}
+
+// decodeArgs decodes the arguments of the query through JSON, so typed and decoded arguments are
+// handled the same way.
+func decodeArgs(query metadata.MetadataQuery, args interface{}) error {
+	data, err := json.Marshal(query.Args)
+	if err != nil {
+		return queryErrorf("parse-failed", "encoding %s arguments: %s", query.Type, err)
+	}
+
+	if err := json.Unmarshal(data, args); err != nil {
+		return queryErrorf("parse-failed", "decoding %s arguments: %s", query.Type, err)
+	}
+
+	return nil
+}
+
+// applyQuery applies a metadata query to m.
+func applyQuery(m *enthasura.Metadata, query metadata.MetadataQuery) error {
+	switch query.Type {
+	case metadata.BulkType:
+		queries := []struct {
+			Type metadata.MetadataRequestType `json:"type"`
+			Args json.RawMessage              `json:"args"`
+		}{}
+
+		if err := decodeArgs(query, &queries); err != nil {
+			return err
+		}
+
+		for _, q := range queries {
+			if err := applyQuery(m, metadata.MetadataQuery{Type: q.Type, Args: q.Args}); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case metadata.PgTrackTable:
+		return trackTable(m, query)
+	case metadata.PgUntrackTable:
+		return untrackTable(m, query)
+	case metadata.PgSetTableCustomization:
+		return setTableCustomization(m, query)
+	case metadata.PgCreateObjectRelationship, metadata.PgCreateArrayRelationship:
+		return createRelationship(m, query)
+	case metadata.PgDropRelationship:
+		return dropRelationship(m, query)
+	case metadata.PgCreateInsertPermission, metadata.PgCreateSelectPermission,
+		metadata.PgCreateUpdatePermission, metadata.PgCreateDeletePermission:
+		return createPermission(m, query)
+	case metadata.PgDropInsertPermission, metadata.PgDropSelectPermission,
+		metadata.PgDropUpdatePermission, metadata.PgDropDeletePermission:
+		return dropPermission(m, query)
+	case metadata.PgCreateEventTrigger:
+		return createEventTrigger(m, query)
+	case metadata.PgDeleteEventTrigger:
+		return deleteEventTrigger(m, query)
+	case metadata.SetCustomTypes, metadata.CreateAction, metadata.UpdateAction, metadata.DropAction,
+		metadata.CreateActionPermission, metadata.DropActionPermission:
+		return applyActionQuery(m, query)
+	}
+
+	return queryErrorf("not-supported", "%s is not supported by hasuratest", query.Type)
+}
+
+func findSource(m *enthasura.Metadata, sourceName string) *enthasura.Source {
+	if sourceName == "" {
+		sourceName = defaultSource
+	}
+
+	for _, source := range m.Sources {
+		if source.Name == sourceName {
+			return source
+		}
+	}
+
+	return nil
+}
+
+func findTable(source *enthasura.Source, table tableRef) *enthasura.Table {
+	for _, t := range source.Tables {
+		schemaName := t.Table.Schema
+		if schemaName == "" {
+			schemaName = defaultSchema
+		}
+
+		if schemaName == table.Schema && t.Table.Name == table.Name {
+			return t
+		}
+	}
+
+	return nil
+}
+
+// sourceAndTable returns the source of the arguments and their table, which must be tracked.
+func sourceAndTable(m *enthasura.Metadata, args tableArgs) (*enthasura.Source, *enthasura.Table, error) {
+	source := findSource(m, args.Source)
+	if source == nil {
+		return nil, nil, queryErrorf("not-exists", "source with name %q does not exist", args.Source)
+	}
+
+	table := findTable(source, args.Table)
+	if table == nil {
+		return source, nil, queryErrorf("not-exists", "table %q does not exist in source %q", args.Table, source.Name)
+	}
+
+	return source, table, nil
+}
+
+func trackTable(m *enthasura.Metadata, query metadata.MetadataQuery) error {
+	args := &tableConfigurationArgs{}
+	if err := decodeArgs(query, args); err != nil {
+		return err
+	}
+
+	source, table, _ := sourceAndTable(m, args.tableArgs)
+	if source == nil {
+		return queryErrorf("not-exists", "source with name %q does not exist", args.Source)
+	}
+
+	if table != nil {
+		return queryErrorf("already-tracked", "view/table already tracked : %q", args.Table)
+	}
+
+	source.Tables = append(source.Tables, &enthasura.Table{
+		Table:         args.Table.qualified(),
+		Configuration: args.Configuration,
+	})
+
+	return nil
+}
+
+// untrackTable untracks the table. The relationships of other tables pointing to it are dropped
+// with cascade, otherwise they fail the query.
+func untrackTable(m *enthasura.Metadata, query metadata.MetadataQuery) error {
+	args := &untrackTableArgs{}
+	if err := decodeArgs(query, args); err != nil {
+		return err
+	}
+
+	source, table, _ := sourceAndTable(m, args.tableArgs)
+	if source == nil {
+		return queryErrorf("not-exists", "source with name %q does not exist", args.Source)
+	}
+
+	if table == nil {
+		return queryErrorf("already-untracked", "view/table already untracked : %q", args.Table)
+	}
+
+	tables := []*enthasura.Table{}
+
+	for _, t := range source.Tables {
+		if t == table {
+			continue
+		}
+
+		for _, rels := range []*[]*enthasura.Relationship{&t.ObjectRelationships, &t.ArrayRelationships} {
+			kept := []*enthasura.Relationship{}
+
+			for _, rel := range *rels {
+				remote, isOk := remoteTable(rel.Using)
+				if !isOk || remote != args.Table {
+					kept = append(kept, rel)
+					continue
+				}
+
+				if !args.Cascade {
+					return queryErrorf("dependency-error", "cannot drop due to the following dependent objects : relationship %s.%s.%s",
+						t.Table.Schema, t.Table.Name, rel.Name)
+				}
+			}
+
+			*rels = kept
+		}
+
+		tables = append(tables, t)
+	}
+
+	source.Tables = tables
+
+	return nil
+}
+
+// remoteTable returns the table a relationship points to, when it is not the table of the
+// relationship itself.
+func remoteTable(using interface{}) (tableRef, bool) {
+	data, err := json.Marshal(using)
+	if err != nil {
+		return tableRef{}, false
+	}
+
+	decoded := struct {
+		ForeignKeyConstraintOn json.RawMessage `json:"foreign_key_constraint_on"`
+		ManualConfiguration    *struct {
+			RemoteTable *tableRef `json:"remote_table"`
+		} `json:"manual_configuration"`
+	}{}
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return tableRef{}, false
+	}
+
+	if decoded.ManualConfiguration != nil && decoded.ManualConfiguration.RemoteTable != nil {
+		return *decoded.ManualConfiguration.RemoteTable, true
+	}
+
+	remote := struct {
+		Table *tableRef `json:"table"`
+	}{}
+
+	if err := json.Unmarshal(decoded.ForeignKeyConstraintOn, &remote); err != nil || remote.Table == nil {
+		return tableRef{}, false
+	}
+
+	return *remote.Table, true
+}
+
+func setTableCustomization(m *enthasura.Metadata, query metadata.MetadataQuery) error {
+	args := &tableConfigurationArgs{}
+	if err := decodeArgs(query, args); err != nil {
+		return err
+	}
+
+	_, table, err := sourceAndTable(m, args.tableArgs)
+	if err != nil {
+		return err
+	}
+
+	table.Configuration = args.Configuration
+
+	return nil
+}
+
+func createRelationship(m *enthasura.Metadata, query metadata.MetadataQuery) error {
+	args := &relationshipArgs{}
+	if err := decodeArgs(query, args); err != nil {
+		return err
+	}
+
+	source, table, err := sourceAndTable(m, args.tableArgs)
+	if err != nil {
+		return err
+	}
+
+	if findRelationship(table.ObjectRelationships, args.Name) != nil || findRelationship(table.ArrayRelationships, args.Name) != nil {
+		return queryErrorf("already-exists", "relationship %q already exists on table %q", args.Name, args.Table)
+	}
+
+	if remote, isOk := remoteTable(args.Using); isOk && findTable(source, remote) == nil {
+		return queryErrorf("not-exists", "table %q is not tracked", remote)
+	}
+
+	rel := &enthasura.Relationship{Name: args.Name, Using: args.Using, Comment: args.Comment}
+
+	if query.Type == metadata.PgCreateObjectRelationship {
+		table.ObjectRelationships = append(table.ObjectRelationships, rel)
+	} else {
+		table.ArrayRelationships = append(table.ArrayRelationships, rel)
+	}
+
+	return nil
+}
+
+func dropRelationship(m *enthasura.Metadata, query metadata.MetadataQuery) error {
+	args := &dropRelationshipArgs{}
+	if err := decodeArgs(query, args); err != nil {
+		return err
+	}
+
+	source, table, err := sourceAndTable(m, args.tableArgs)
+	if err != nil {
+		return err
+	}
+
+	if dependent := relationshipDependent(source, args.Table, args.Relationship); dependent != "" {
+		return queryErrorf("dependency-error", "cannot drop due to the following dependent objects : %s", dependent)
+	}
+
+	for _, rels := range []*[]*enthasura.Relationship{&table.ObjectRelationships, &table.ArrayRelationships} {
+		for i, rel := range *rels {
+			if rel.Name == args.Relationship {
+				*rels = append((*rels)[:i], (*rels)[i+1:]...)
+				return nil
+			}
+		}
+	}
+
+	return queryErrorf("not-exists", "relationship %q does not exist on table %q", args.Relationship, args.Table)
+}
+
+var permissionKinds = []metadata.MetadataRequestType{
+	metadata.PgCreateInsertPermission,
+	metadata.PgCreateSelectPermission,
+	metadata.PgCreateUpdatePermission,
+	metadata.PgCreateDeletePermission,
+}
+
+// relationshipDependent describes the first permission of the source whose filter or check goes
+// through the relationship of the table, or returns an empty string. Like the engine, the paths are
+// followed through the relationships of other tables, except object relationships on a column of
+// their own table whose remote table is only known by the database.
+func relationshipDependent(source *enthasura.Source, table tableRef, name string) string {
+	for _, t := range source.Tables {
+		current := tableRef{Schema: t.Table.Schema, Name: t.Table.Name}
+		if current.Schema == "" {
+			current.Schema = defaultSchema
+		}
+
+		for _, kind := range permissionKinds {
+			perms, kindName := permissions(t, kind)
+
+			for _, perm := range *perms {
+				if expressionUses(source, current, perm.Permission["filter"], table, name) ||
+					expressionUses(source, current, perm.Permission["check"], table, name) {
+					return fmt.Sprintf("permission %s.%s.%s.%s", current.Schema, current.Name, perm.Role, kindName)
+				}
+			}
+		}
+	}
+
+	return ""
+}
+
+// expressionUses reports if the boolean expression, evaluated on the current table, goes through the
+// relationship of the target table.
+func expressionUses(source *enthasura.Source, current tableRef, expression interface{}, target tableRef, name string) bool {
+	switch exp := expression.(type) {
+	case []interface{}:
+		for _, value := range exp {
+			if expressionUses(source, current, value, target, name) {
+				return true
+			}
+		}
+	case map[string]interface{}:
+		for key, value := range exp {
+			switch key {
+			case "_and", "_or", "_not":
+				if expressionUses(source, current, value, target, name) {
+					return true
+				}
+			case "_exists":
+				exists := struct {
+					Table tableRef    `json:"_table"`
+					Where interface{} `json:"_where"`
+				}{}
+
+				data, err := json.Marshal(value)
+				if err == nil && json.Unmarshal(data, &exists) == nil && expressionUses(source, exists.Table, exists.Where, target, name) {
+					return true
+				}
+			default:
+				if current == target && key == name {
+					return true
+				}
+
+				table := findTable(source, current)
+				if table == nil {
+					continue
+				}
+
+				rel := findRelationship(table.ObjectRelationships, key)
+				if rel == nil {
+					rel = findRelationship(table.ArrayRelationships, key)
+				}
+
+				if rel == nil {
+					continue
+				}
+
+				if remote, isOk := remoteTable(rel.Using); isOk && expressionUses(source, remote, value, target, name) {
+					return true
+				}
+			}
+		}
+	}
+
+	return false
+}
+
+func findRelationship(rels []*enthasura.Relationship, name string) *enthasura.Relationship {
+	for _, rel := range rels {
+		if rel.Name == name {
+			return rel
+		}
+	}
+
+	return nil
+}
+
+// permissions returns the permissions of the table touched by a create or drop permission query,
+// with the name of the permission kind.
+func permissions(table *enthasura.Table, kind metadata.MetadataRequestType) (*[]*enthasura.RolePermission, string) {
+	switch kind {
+	case metadata.PgCreateInsertPermission, metadata.PgDropInsertPermission:
+		return &table.InsertPermissions, "insert"
+	case metadata.PgCreateSelectPermission, metadata.PgDropSelectPermission:
+		return &table.SelectPermissions, "select"
+	case metadata.PgCreateUpdatePermission, metadata.PgDropUpdatePermission:
+		return &table.UpdatePermissions, "update"
+	}
+
+	return &table.DeletePermissions, "delete"
+}
+
+func createPermission(m *enthasura.Metadata, query metadata.MetadataQuery) error {
+	args := &permissionArgs{}
+	if err := decodeArgs(query, args); err != nil {
+		return err
+	}
+
+	_, table, err := sourceAndTable(m, args.tableArgs)
+	if err != nil {
+		return err
+	}
+
+	perms, kind := permissions(table, query.Type)
+
+	for _, perm := range *perms {
+		if perm.Role == args.Role {
+			return queryErrorf("already-exists", "%s permission already defined on table %q with role %q", kind, args.Table, args.Role)
+		}
+	}
+
+	*perms = append(*perms, &enthasura.RolePermission{Role: args.Role, Permission: args.Permission, Comment: args.Comment})
+
+	return nil
+}
+
+func dropPermission(m *enthasura.Metadata, query metadata.MetadataQuery) error {
+	args := &permissionArgs{}
+	if err := decodeArgs(query, args); err != nil {
+		return err
+	}
+
+	_, table, err := sourceAndTable(m, args.tableArgs)
+	if err != nil {
+		return err
+	}
+
+	perms, kind := permissions(table, query.Type)
+
+	for i, perm := range *perms {
+		if perm.Role == args.Role {
+			*perms = append((*perms)[:i], (*perms)[i+1:]...)
+			return nil
+		}
+	}
+
+	return queryErrorf("not-exists", "%s permission on table %q for role %q does not exist", kind, args.Table, args.Role)
+}
+
+func createEventTrigger(m *enthasura.Metadata, query metadata.MetadataQuery) error {
+	tArgs := tableArgs{}
+	if err := decodeArgs(query, &tArgs); err != nil {
+		return err
+	}
+
+	args := &enthasura.PgCreateEventTriggerArgs{}
+	if err := decodeArgs(query, args); err != nil {
+		return err
+	}
+
+	source, table, err := sourceAndTable(m, tArgs)
+	if err != nil {
+		return err
+	}
+
+	trigger := &enthasura.EventTrigger{
+		Name: args.Name,
+		Definition: &enthasura.EventTriggerDefinition{
+			EnableManual: args.EnableManual,
+			Insert:       args.Insert,
+			Update:       args.Update,
+			Delete:       args.Delete,
+		},
+		RetryConf:      args.RetryConf,
+		Webhook:        args.Webhook,
+		WebhookFromEnv: args.WebhookFromEnv,
+		Headers:        args.Headers,
+	}
+
+	for _, t := range source.Tables {
+		for i, existing := range t.EventTriggers {
+			if eventTriggerName(existing) != args.Name {
+				continue
+			}
+
+			if !args.Replace {
+				return queryErrorf("already-exists", "event trigger %q already exists", args.Name)
+			}
+
+			t.EventTriggers = append(t.EventTriggers[:i], t.EventTriggers[i+1:]...)
+			break
+		}
+	}
+
+	table.EventTriggers = append(table.EventTriggers, trigger)
+
+	return nil
+}
+
+func deleteEventTrigger(m *enthasura.Metadata, query metadata.MetadataQuery) error {
+	args := &deleteEventTriggerArgs{}
+	if err := decodeArgs(query, args); err != nil {
+		return err
+	}
+
+	source := findSource(m, args.Source)
+	if source == nil {
+		return queryErrorf("not-exists", "source with name %q does not exist", args.Source)
+	}
+
+	for _, t := range source.Tables {
+		for i, existing := range t.EventTriggers {
+			if eventTriggerName(existing) == args.Name {
+				t.EventTriggers = append(t.EventTriggers[:i], t.EventTriggers[i+1:]...)
+				return nil
+			}
+		}
+	}
+
+	return queryErrorf("not-exists", "event trigger %q does not exist", args.Name)
+}
+
+func eventTriggerName(trigger interface{}) string {
+	data, err := json.Marshal(trigger)
+	if err != nil {
+		return ""
+	}
+
+	named := struct {
+		Name string `json:"name"`
+	}{}
+
+	if err := json.Unmarshal(data, &named); err != nil {
+		return ""
+	}
+
+	return named.Name
+}
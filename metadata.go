@@ -0,0 +1,310 @@
+package enthasura
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+)
+
+const metadataVersion = 3
+
+// HasuraMetadata is the document produced by export_metadata and accepted by replace_metadata.
+type HasuraMetadata struct {
+	ResourceVersion int       `json:"resource_version,omitempty"`
+	Metadata        *Metadata `json:"metadata"`
+	// Raw is the metadata document as exported, the one a rollback replaces the metadata with.
+	Raw json.RawMessage `json:"-"`
+}
+
+// Metadata is a Hasura metadata document. The fields it does not model, e.g. rest_endpoints or
+// network, are kept in Extra so a decoded document encodes back unchanged.
+type Metadata struct {
+	Version        int           `json:"version"`
+	Sources        []*Source     `json:"sources"`
+	RemoteSchemas  []interface{} `json:"remote_schemas,omitempty"`
+	Actions        []interface{} `json:"actions,omitempty"`
+	CustomTypes    *CustomTypes  `json:"custom_types,omitempty"`
+	CronTriggers   []interface{} `json:"cron_triggers,omitempty"`
+	Allowlist      []interface{} `json:"allowlist,omitempty"`
+	Collections    []interface{} `json:"query_collections,omitempty"`
+	InheritedRoles []interface{} `json:"inherited_roles,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type Source struct {
+	Name          string      `json:"name"`
+	Kind          string      `json:"kind"`
+	Tables        []*Table    `json:"tables"`
+	Functions     interface{} `json:"functions,omitempty"`
+	Configuration interface{} `json:"configuration"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+type Table struct {
+	Table               metadata.QualifiedTableName `json:"table"`
+	IsEnum              bool                        `json:"is_enum,omitempty"`
+	Configuration       *TableConfiguration         `json:"configuration,omitempty"`
+	ObjectRelationships []*Relationship             `json:"object_relationships,omitempty"`
+	ArrayRelationships  []*Relationship             `json:"array_relationships,omitempty"`
+	ComputedFields      []interface{}               `json:"computed_fields,omitempty"`
+	RemoteRelationships []interface{}               `json:"remote_relationships,omitempty"`
+	InsertPermissions   []*RolePermission           `json:"insert_permissions,omitempty"`
+	SelectPermissions   []*RolePermission           `json:"select_permissions,omitempty"`
+	UpdatePermissions   []*RolePermission           `json:"update_permissions,omitempty"`
+	DeletePermissions   []*RolePermission           `json:"delete_permissions,omitempty"`
+	EventTriggers       []interface{}               `json:"event_triggers,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// TableConfiguration is the configuration of a table with the column config of Hasura v2, which
+// the configuration of hasura-api does not have.
+type TableConfiguration struct {
+	metadata.TableConfiguration
+	ColumnConfig map[string]*ColumnConfig `json:"column_config,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+// the field types have the fields of the documents without their json methods
+type (
+	metadataFields           Metadata
+	sourceFields             Source
+	tableFields              Table
+	tableConfigurationFields TableConfiguration
+)
+
+func (m *Metadata) UnmarshalJSON(data []byte) (err error) {
+	m.Extra, err = decodeWithExtra(data, (*metadataFields)(m))
+	return err
+}
+
+func (m Metadata) MarshalJSON() ([]byte, error) {
+	return encodeWithExtra(metadataFields(m), m.Extra)
+}
+
+func (s *Source) UnmarshalJSON(data []byte) (err error) {
+	s.Extra, err = decodeWithExtra(data, (*sourceFields)(s))
+	return err
+}
+
+func (s Source) MarshalJSON() ([]byte, error) {
+	return encodeWithExtra(sourceFields(s), s.Extra)
+}
+
+func (t *Table) UnmarshalJSON(data []byte) (err error) {
+	t.Extra, err = decodeWithExtra(data, (*tableFields)(t))
+	return err
+}
+
+func (t Table) MarshalJSON() ([]byte, error) {
+	return encodeWithExtra(tableFields(t), t.Extra)
+}
+
+func (c *TableConfiguration) UnmarshalJSON(data []byte) (err error) {
+	c.Extra, err = decodeWithExtra(data, (*tableConfigurationFields)(c))
+	return err
+}
+
+func (c TableConfiguration) MarshalJSON() ([]byte, error) {
+	return encodeWithExtra(tableConfigurationFields(c), c.Extra)
+}
+
+type ColumnConfig struct {
+	CustomName string `json:"custom_name,omitempty"`
+	Comment    string `json:"comment,omitempty"`
+}
+
+// PgSetTableCustomizationArgs are the arguments of pg_set_table_customization with the column config.
+type PgSetTableCustomizationArgs struct {
+	Table         metadata.ITableName `json:"table"`
+	Configuration *TableConfiguration `json:"configuration"`
+	Source        string              `json:"source,omitempty"`
+}
+
+func pgSetTableCustomizationQuery(args *PgSetTableCustomizationArgs) metadata.MetadataQuery {
+	return metadata.MetadataQuery{
+		Type: metadata.PgSetTableCustomization,
+		Args: args,
+	}
+}
+
+type Relationship struct {
+	Name    string      `json:"name"`
+	Using   interface{} `json:"using"`
+	Comment string      `json:"comment,omitempty"`
+}
+
+type RolePermission struct {
+	Role       string                 `json:"role"`
+	Permission map[string]interface{} `json:"permission"`
+	Comment    string                 `json:"comment,omitempty"`
+}
+
+func defaultSourceConfiguration() interface{} {
+	return map[string]interface{}{
+		"connection_info": map[string]interface{}{
+			"database_url": map[string]interface{}{
+				"from_env": "HASURA_GRAPHQL_DATABASE_URL",
+			},
+			"isolation_level":         "read-committed",
+			"use_prepared_statements": false,
+		},
+	}
+}
+
+func newSource(sourceName string) *Source {
+	return &Source{
+		Name:          sourceName,
+		Kind:          "postgres",
+		Tables:        []*Table{},
+		Configuration: defaultSourceConfiguration(),
+	}
+}
+
+func (m *Metadata) source(sourceName string) *Source {
+	for _, source := range m.Sources {
+		if source.Name == sourceName {
+			return source
+		}
+	}
+
+	return nil
+}
+
+func (s *Source) table(schemaName, tableName string) *Table {
+	for _, table := range s.Tables {
+		if table.Table.Schema == schemaName && table.Table.Name == tableName {
+			return table
+		}
+	}
+
+	return nil
+}
+
+// setRolePermission replaces the permission of the same role or appends a new one.
+func setRolePermission(perms []*RolePermission, perm *RolePermission) []*RolePermission {
+	for i, p := range perms {
+		if p.Role == perm.Role {
+			perms[i] = perm
+			return perms
+		}
+	}
+
+	return append(perms, perm)
+}
+
+// applyPermissionQuery stores a pg_create_*_permission query inside the matching table of the source.
+func applyPermissionQuery(source *Source, query metadata.MetadataQuery) error {
+	var (
+		tableName metadata.ITableName
+		perm      *RolePermission
+		kind      = query.Type
+	)
+
+	switch args := query.Args.(type) {
+	case *metadata.PgCreateInsertPermissionArgs:
+		tableName, perm = args.Table, &RolePermission{Role: args.Role, Permission: permissionMap(args.Permission)}
+	case *metadata.PgCreateSelectPermissionArgs:
+		tableName, perm = args.Table, &RolePermission{Role: args.Role, Permission: permissionMap(args.Permission)}
+	case *metadata.PgCreateUpdatePermissionArgs:
+		tableName, perm = args.Table, &RolePermission{Role: args.Role, Permission: permissionMap(args.Permission)}
+	case *metadata.PgCreateDeletePermissionArgs:
+		tableName, perm = args.Table, &RolePermission{Role: args.Role, Permission: permissionMap(args.Permission)}
+	default:
+		return errors.Errorf("unexpected permission query: %s", query.Type)
+	}
+
+	table, isOk := tableName.(metadata.QualifiedTableName)
+	if !isOk {
+		return errors.Errorf("unexpected table of %s for role %s: %#v", query.Type, perm.Role, tableName)
+	}
+
+	target := source.table(table.Schema, table.Name)
+	if target == nil {
+		return errors.Errorf("permission for untracked table %s.%s", table.Schema, table.Name)
+	}
+
+	switch kind {
+	case metadata.PgCreateInsertPermission:
+		target.InsertPermissions = setRolePermission(target.InsertPermissions, perm)
+	case metadata.PgCreateSelectPermission:
+		target.SelectPermissions = setRolePermission(target.SelectPermissions, perm)
+	case metadata.PgCreateUpdatePermission:
+		target.UpdatePermissions = setRolePermission(target.UpdatePermissions, perm)
+	case metadata.PgCreateDeletePermission:
+		target.DeletePermissions = setRolePermission(target.DeletePermissions, perm)
+	}
+
+	return nil
+}
+
+func permissionMap(perm interface{}) map[string]interface{} {
+	switch p := perm.(type) {
+	case metadata.GenericPermission:
+		return p
+	case map[string]interface{}:
+		return p
+	}
+
+	return nil
+}
+
+func parseHasuraMetadata(inputFile string) (*HasuraMetadata, error) {
+	data, err := ioutil.ReadFile(inputFile)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return decodeHasuraMetadata(data)
+}
+
+func decodeHasuraMetadata(data []byte) (*HasuraMetadata, error) {
+	hMetadata := &HasuraMetadata{}
+
+	if err := json.Unmarshal(data, hMetadata); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	envelope := struct {
+		Metadata json.RawMessage `json:"metadata"`
+	}{}
+
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	hMetadata.Raw = envelope.Metadata
+
+	// a plain metadata document (without the resource_version envelope) is also accepted
+	if hMetadata.Metadata == nil {
+		plain := &Metadata{}
+		if err := json.Unmarshal(data, plain); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		hMetadata.Metadata = plain
+		hMetadata.Raw = append(json.RawMessage{}, data...)
+	}
+
+	return hMetadata, nil
+}
+
+func generateFile(m *Metadata, outputFile string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(outputFile), os.ModePerm); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return ioutil.WriteFile(outputFile, data, 0644)
+}
@@ -0,0 +1,171 @@
+package enthasura
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/minskylab/hasura-api/metadata"
+)
+
+func TestMetadataRoundTrip(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "metadata", "export.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := decodeHasuraMetadata(data)
+	if err != nil {
+		t.Fatalf("decoding export: %+v", err)
+	}
+
+	encoded, err := json.Marshal(exported)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertSameJSON(t, encoded, data)
+}
+
+func TestDecodeHasuraMetadataKeepsRaw(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "metadata", "export.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := decodeHasuraMetadata(data)
+	if err != nil {
+		t.Fatalf("decoding export: %+v", err)
+	}
+
+	envelope := struct {
+		Metadata json.RawMessage `json:"metadata"`
+	}{}
+
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(exported.Raw, envelope.Metadata) {
+		t.Errorf("raw document differs from the exported one:\n%s", exported.Raw)
+	}
+
+	plain, err := decodeHasuraMetadata(envelope.Metadata)
+	if err != nil {
+		t.Fatalf("decoding plain document: %+v", err)
+	}
+
+	if !bytes.Equal(plain.Raw, envelope.Metadata) {
+		t.Errorf("raw plain document differs from the decoded one:\n%s", plain.Raw)
+	}
+}
+
+func TestEnhanceHasuraMetadataKeepsUnknownFields(t *testing.T) {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", "metadata", "export.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	initial, err := decodeHasuraMetadata(data)
+	if err != nil {
+		t.Fatalf("decoding export: %+v", err)
+	}
+
+	generated := &Metadata{Version: metadataVersion, Sources: []*Source{newSource("default")}}
+	generated.Sources[0].Tables = []*Table{{
+		Table:         metadata.QualifiedTableName{Schema: "public", Name: "notes"},
+		Configuration: &TableConfiguration{TableConfiguration: metadata.TableConfiguration{CustomName: "Note"}},
+	}}
+
+	enhanceHasuraMetadata(initial.Metadata, generated, false)
+
+	encoded, err := json.Marshal(initial.Metadata)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	merged := map[string]interface{}{}
+	if err := json.Unmarshal(encoded, &merged); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"rest_endpoints", "network", "api_limits", "graphql_schema_introspection", "backend_configs", "metrics_config"} {
+		if _, isOk := merged[key]; !isOk {
+			t.Errorf("%s dropped by the merge", key)
+		}
+	}
+
+	source := merged["sources"].([]interface{})[0].(map[string]interface{})
+	if _, isOk := source["customization"]; !isOk {
+		t.Error("source customization dropped by the merge")
+	}
+
+	notes := source["tables"].([]interface{})[0].(map[string]interface{})
+	if _, isOk := notes["apollo_federation_config"]; !isOk {
+		t.Error("unknown table field dropped by the merge")
+	}
+
+	if comment := notes["configuration"].(map[string]interface{})["comment"]; comment != "notes of the users" {
+		t.Errorf("table configuration comment = %v, want it kept by the merge", comment)
+	}
+}
+
+func TestEncodeWithExtraSkipsKnownFields(t *testing.T) {
+	m := &Metadata{
+		Version: metadataVersion,
+		Sources: []*Source{},
+		Extra: map[string]json.RawMessage{
+			"version": json.RawMessage(`1`),
+			"network": json.RawMessage(`{}`),
+		},
+	}
+
+	encoded, err := json.Marshal(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assertSameJSON(t, encoded, []byte(`{"version":3,"sources":[],"network":{}}`))
+}
+
+func assertSameJSON(t *testing.T, got, want []byte) {
+	t.Helper()
+
+	var gotValue, wantValue interface{}
+
+	if err := json.Unmarshal(got, &gotValue); err != nil {
+		t.Fatalf("decoding %s: %s", got, err)
+	}
+
+	if err := json.Unmarshal(want, &wantValue); err != nil {
+		t.Fatalf("decoding %s: %s", want, err)
+	}
+
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("JSON differs\ngot:  %s\nwant: %s", got, want)
+	}
+}
+
+func TestApplyPermissionQueryUnexpectedTable(t *testing.T) {
+	source := newSource("default")
+	source.Tables = []*Table{{Table: metadata.QualifiedTableName{Schema: "public", Name: "notes"}}}
+
+	query := metadata.MetadataQuery{
+		Type: metadata.PgCreateSelectPermission,
+		Args: &metadata.PgCreateSelectPermissionArgs{
+			Table: &metadata.QualifiedTableName{Schema: "public", Name: "notes"},
+			Role:  "user",
+		},
+	}
+
+	if err := applyPermissionQuery(source, query); err == nil {
+		t.Fatal("expected an error for a table that is not a metadata.QualifiedTableName")
+	}
+
+	if len(source.Tables[0].SelectPermissions) != 0 {
+		t.Error("permission stored for an unexpected table")
+	}
+}
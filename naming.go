@@ -0,0 +1,294 @@
+package enthasura
+
+import (
+	"os"
+	"strings"
+
+	pluralize "github.com/gertd/go-pluralize"
+	"github.com/iancoleman/strcase"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+	logger "github.com/sirupsen/logrus"
+)
+
+const (
+	DefaultNamingName        = "default"
+	GraphQLDefaultNamingName = "graphql-default"
+	SnakeCaseNamingName      = "snake-case"
+)
+
+// NamingStrategy decides the GraphQL names of the generated tables. node is the ent type name of a
+// table, or empty for join tables. The builtin strategies take the verbs of their root fields from
+// Config, and WithRootFields overrides the root fields of single tables; the CLI sets both with its
+// verb flags and the naming file read by ReadNamingConfig.
+type NamingStrategy interface {
+	TypeName(table, node string) string
+	RootFields(table, node string) *metadata.CustomRootFields
+	// ColumnName returns the name of a column, field is the ent field name or empty for join tables.
+	ColumnName(column, field string) string
+	// ForeignKeyName returns the name of the foreign key column of an ent edge.
+	ForeignKeyName(column, edge string) string
+	// RelationshipName returns the name of the relationship of an ent edge, or of a join table
+	// column without its _id suffix.
+	RelationshipName(name string) string
+}
+
+// NamingStrategyByName returns one of the builtin strategies: "default", "graphql-default" or "snake-case".
+func NamingStrategyByName(name string, config Config) (NamingStrategy, error) {
+	switch name {
+	case "", DefaultNamingName:
+		return NewDefaultNaming(config), nil
+	case GraphQLDefaultNamingName:
+		return NewGraphQLDefaultNaming(config), nil
+	case SnakeCaseNamingName:
+		return NewSnakeCaseNaming(config), nil
+	}
+
+	return nil, errors.Errorf("unknown naming strategy %q", name)
+}
+
+func namingOrDefault(naming NamingStrategy) NamingStrategy {
+	if naming == nil {
+		return NewDefaultNaming(DefaultConfig)
+	}
+
+	return naming
+}
+
+// DefaultNaming names types after ent types and uses camel case with singular and plural root
+// fields, e.g. users, user, insertUsers, insertUser and usersAggregate.
+type DefaultNaming struct {
+	config    Config
+	pluralize *pluralize.Client
+}
+
+func NewDefaultNaming(config Config) *DefaultNaming {
+	return &DefaultNaming{config: config.withDefaults(), pluralize: pluralize.NewClient()}
+}
+
+func (n *DefaultNaming) TypeName(table, node string) string {
+	if node == "" {
+		return strcase.ToCamel(n.pluralize.Singular(table))
+	}
+
+	return node
+}
+
+func (n *DefaultNaming) RootFields(table, node string) *metadata.CustomRootFields {
+	nodeName := n.TypeName(table, node)
+
+	singularName := strcase.ToCamel(n.pluralize.Singular(nodeName))
+	pluralName := strcase.ToCamel(n.pluralize.Plural(nodeName))
+
+	aggregationSuffix := strcase.ToCamel(n.config.AggregateVerbName)
+
+	if singularName == pluralName {
+		logger.Warn("singular-plural equality found")
+		logger.Warn(singularName, " table:", table, " node:", nodeName)
+		pluralName = pluralName + "s"
+	}
+
+	return &metadata.CustomRootFields{
+		Insert:          strcase.ToLowerCamel(n.config.InsertVerbName + pluralName),
+		InsertOne:       strcase.ToLowerCamel(n.config.InsertVerbName + singularName),
+		Select:          strcase.ToLowerCamel(pluralName),
+		SelectByPk:      strcase.ToLowerCamel(singularName),
+		SelectAggregate: strcase.ToLowerCamel(pluralName + aggregationSuffix),
+		Update:          strcase.ToLowerCamel(n.config.UpdateVerbName + pluralName),
+		UpdateByPk:      strcase.ToLowerCamel(n.config.UpdateVerbName + singularName),
+		Delete:          strcase.ToLowerCamel(n.config.DeleteVerbName + pluralName),
+		DeleteByPk:      strcase.ToLowerCamel(n.config.DeleteVerbName + singularName),
+	}
+}
+
+func (n *DefaultNaming) ColumnName(column, field string) string {
+	if field != "" {
+		return strcase.ToLowerCamel(field)
+	}
+
+	words := strings.Split(column, "_")
+
+	for i, word := range words {
+		if strings.ToLower(word) == "id" {
+			words[i] = "ID"
+		}
+	}
+
+	return strcase.ToLowerCamel(strings.Join(words, "_"))
+}
+
+func (n *DefaultNaming) ForeignKeyName(column, edge string) string {
+	return strcase.ToLowerCamel(edge) + "ID"
+}
+
+func (n *DefaultNaming) RelationshipName(name string) string {
+	return strcase.ToLowerCamel(name)
+}
+
+// GraphQLDefaultNaming follows the graphql-default naming convention of Hasura: names are derived
+// from the table and column names, types in pascal case and fields in camel case, e.g. users,
+// usersByPk, insertUsersOne and usersAggregate.
+type GraphQLDefaultNaming struct {
+	config Config
+}
+
+func NewGraphQLDefaultNaming(config Config) *GraphQLDefaultNaming {
+	return &GraphQLDefaultNaming{config: config.withDefaults()}
+}
+
+func (n *GraphQLDefaultNaming) TypeName(table, node string) string {
+	return strcase.ToCamel(table)
+}
+
+func (n *GraphQLDefaultNaming) RootFields(table, node string) *metadata.CustomRootFields {
+	name := strcase.ToCamel(table)
+
+	return &metadata.CustomRootFields{
+		Insert:          strcase.ToLowerCamel(n.config.InsertVerbName + name),
+		InsertOne:       strcase.ToLowerCamel(n.config.InsertVerbName + name + "One"),
+		Select:          strcase.ToLowerCamel(name),
+		SelectByPk:      strcase.ToLowerCamel(name + "ByPk"),
+		SelectAggregate: strcase.ToLowerCamel(name + strcase.ToCamel(n.config.AggregateVerbName)),
+		Update:          strcase.ToLowerCamel(n.config.UpdateVerbName + name),
+		UpdateByPk:      strcase.ToLowerCamel(n.config.UpdateVerbName + name + "ByPk"),
+		Delete:          strcase.ToLowerCamel(n.config.DeleteVerbName + name),
+		DeleteByPk:      strcase.ToLowerCamel(n.config.DeleteVerbName + name + "ByPk"),
+	}
+}
+
+func (n *GraphQLDefaultNaming) ColumnName(column, field string) string {
+	return strcase.ToLowerCamel(column)
+}
+
+func (n *GraphQLDefaultNaming) ForeignKeyName(column, edge string) string {
+	return strcase.ToLowerCamel(column)
+}
+
+func (n *GraphQLDefaultNaming) RelationshipName(name string) string {
+	return strcase.ToLowerCamel(name)
+}
+
+// SnakeCaseNaming keeps the legacy names of Hasura: table and column names as they are in Postgres
+// and snake case root fields, e.g. users, users_by_pk, insert_users_one and users_aggregate.
+type SnakeCaseNaming struct {
+	config Config
+}
+
+func NewSnakeCaseNaming(config Config) *SnakeCaseNaming {
+	return &SnakeCaseNaming{config: config.withDefaults()}
+}
+
+func (n *SnakeCaseNaming) TypeName(table, node string) string {
+	return table
+}
+
+func (n *SnakeCaseNaming) RootFields(table, node string) *metadata.CustomRootFields {
+	return &metadata.CustomRootFields{
+		Insert:          strcase.ToSnake(n.config.InsertVerbName) + "_" + table,
+		InsertOne:       strcase.ToSnake(n.config.InsertVerbName) + "_" + table + "_one",
+		Select:          table,
+		SelectByPk:      table + "_by_pk",
+		SelectAggregate: table + "_" + strcase.ToSnake(n.config.AggregateVerbName),
+		Update:          strcase.ToSnake(n.config.UpdateVerbName) + "_" + table,
+		UpdateByPk:      strcase.ToSnake(n.config.UpdateVerbName) + "_" + table + "_by_pk",
+		Delete:          strcase.ToSnake(n.config.DeleteVerbName) + "_" + table,
+		DeleteByPk:      strcase.ToSnake(n.config.DeleteVerbName) + "_" + table + "_by_pk",
+	}
+}
+
+func (n *SnakeCaseNaming) ColumnName(column, field string) string {
+	return column
+}
+
+func (n *SnakeCaseNaming) ForeignKeyName(column, edge string) string {
+	return column
+}
+
+func (n *SnakeCaseNaming) RelationshipName(name string) string {
+	return strcase.ToSnake(name)
+}
+
+// WithRootFields overrides the root fields of the strategy with the non empty names given for a
+// table, e.g. to keep the names of an existing API.
+func WithRootFields(naming NamingStrategy, rootFields map[string]*metadata.CustomRootFields) NamingStrategy {
+	return &rootFieldsNaming{NamingStrategy: namingOrDefault(naming), rootFields: rootFields}
+}
+
+type rootFieldsNaming struct {
+	NamingStrategy
+	rootFields map[string]*metadata.CustomRootFields
+}
+
+func (n *rootFieldsNaming) RootFields(table, node string) *metadata.CustomRootFields {
+	fields := n.NamingStrategy.RootFields(table, node)
+
+	override, isOk := n.rootFields[table]
+	if !isOk || override == nil {
+		return fields
+	}
+
+	for _, field := range []struct{ name, override *string }{
+		{&fields.Insert, &override.Insert},
+		{&fields.InsertOne, &override.InsertOne},
+		{&fields.Select, &override.Select},
+		{&fields.SelectByPk, &override.SelectByPk},
+		{&fields.SelectAggregate, &override.SelectAggregate},
+		{&fields.Update, &override.Update},
+		{&fields.UpdateByPk, &override.UpdateByPk},
+		{&fields.Delete, &override.Delete},
+		{&fields.DeleteByPk, &override.DeleteByPk},
+	} {
+		if *field.override != "" {
+			*field.name = *field.override
+		}
+	}
+
+	return fields
+}
+
+// NamingConfig selects and configures a builtin naming strategy, e.g. from a naming file:
+//
+//	strategy: snake-case
+//	insert_verb: add
+//	root_fields:
+//	  users:
+//	    select_by_pk: user
+type NamingConfig struct {
+	Strategy string `json:"strategy,omitempty"`
+	Config
+	RootFields map[string]*metadata.CustomRootFields `json:"root_fields,omitempty"`
+}
+
+// ReadNamingConfig reads a naming config from a YAML or JSON file.
+func ReadNamingConfig(filename string) (*NamingConfig, error) {
+	if _, err := os.Stat(filename); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	config := &NamingConfig{}
+	if err := readYAML(filename, config); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return config, nil
+}
+
+// Naming returns the strategy of the config.
+func (c *NamingConfig) Naming() (NamingStrategy, error) {
+	naming, err := NamingStrategyByName(c.Strategy, c.Config)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(c.RootFields) == 0 {
+		return naming, nil
+	}
+
+	return WithRootFields(naming, c.RootFields), nil
+}
+
+var (
+	_ NamingStrategy = (*DefaultNaming)(nil)
+	_ NamingStrategy = (*GraphQLDefaultNaming)(nil)
+	_ NamingStrategy = (*SnakeCaseNaming)(nil)
+)
@@ -0,0 +1,215 @@
+package enthasura
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/minskylab/hasura-api/metadata"
+)
+
+func TestNamingStrategyByName(t *testing.T) {
+	tests := []struct {
+		name string
+		want NamingStrategy
+	}{
+		{"", &DefaultNaming{}},
+		{DefaultNamingName, &DefaultNaming{}},
+		{GraphQLDefaultNamingName, &GraphQLDefaultNaming{}},
+		{SnakeCaseNamingName, &SnakeCaseNaming{}},
+	}
+
+	for _, test := range tests {
+		naming, err := NamingStrategyByName(test.name, DefaultConfig)
+		if err != nil {
+			t.Fatalf("%q: %s", test.name, err)
+		}
+
+		if got, want := fmt.Sprintf("%T", naming), fmt.Sprintf("%T", test.want); got != want {
+			t.Errorf("%q: got %s, want %s", test.name, got, want)
+		}
+	}
+
+	if _, err := NamingStrategyByName("kebab-case", DefaultConfig); err == nil {
+		t.Error("expected an error for an unknown strategy")
+	}
+}
+
+func TestSnakeCaseNaming(t *testing.T) {
+	naming := NewSnakeCaseNaming(DefaultConfig)
+
+	assertNames(t, naming, "user_groups", "UserGroup", names{
+		typeName:     "user_groups",
+		column:       "created_at",
+		foreignKey:   "group_users",
+		relationship: "group_users",
+		rootFields: metadata.CustomRootFields{
+			Insert:          "insert_user_groups",
+			InsertOne:       "insert_user_groups_one",
+			Select:          "user_groups",
+			SelectByPk:      "user_groups_by_pk",
+			SelectAggregate: "user_groups_aggregate",
+			Update:          "update_user_groups",
+			UpdateByPk:      "update_user_groups_by_pk",
+			Delete:          "delete_user_groups",
+			DeleteByPk:      "delete_user_groups_by_pk",
+		},
+	})
+}
+
+func TestGraphQLDefaultNaming(t *testing.T) {
+	naming := NewGraphQLDefaultNaming(DefaultConfig)
+
+	assertNames(t, naming, "user_groups", "UserGroup", names{
+		typeName:     "UserGroups",
+		column:       "createdAt",
+		foreignKey:   "groupUsers",
+		relationship: "groupUsers",
+		rootFields: metadata.CustomRootFields{
+			Insert:          "insertUserGroups",
+			InsertOne:       "insertUserGroupsOne",
+			Select:          "userGroups",
+			SelectByPk:      "userGroupsByPk",
+			SelectAggregate: "userGroupsAggregate",
+			Update:          "updateUserGroups",
+			UpdateByPk:      "updateUserGroupsByPk",
+			Delete:          "deleteUserGroups",
+			DeleteByPk:      "deleteUserGroupsByPk",
+		},
+	})
+}
+
+func TestDefaultNaming(t *testing.T) {
+	naming := NewDefaultNaming(DefaultConfig)
+
+	assertNames(t, naming, "user_groups", "UserGroup", names{
+		typeName:     "UserGroup",
+		column:       "createdAt",
+		foreignKey:   "groupUsersID",
+		relationship: "groupUsers",
+		rootFields: metadata.CustomRootFields{
+			Insert:          "insertUserGroups",
+			InsertOne:       "insertUserGroup",
+			Select:          "userGroups",
+			SelectByPk:      "userGroup",
+			SelectAggregate: "userGroupsAggregate",
+			Update:          "updateUserGroups",
+			UpdateByPk:      "updateUserGroup",
+			Delete:          "deleteUserGroups",
+			DeleteByPk:      "deleteUserGroup",
+		},
+	})
+}
+
+func TestNamingVerbs(t *testing.T) {
+	config := Config{InsertVerbName: "add", UpdateVerbName: "edit", DeleteVerbName: "remove", AggregateVerbName: "stats"}
+
+	snake := NewSnakeCaseNaming(config).RootFields("users", "User")
+	if snake.Insert != "add_users" || snake.UpdateByPk != "edit_users_by_pk" || snake.Delete != "remove_users" || snake.SelectAggregate != "users_stats" {
+		t.Errorf("snake case root fields ignore the verbs: %+v", snake)
+	}
+
+	graphql := NewGraphQLDefaultNaming(config).RootFields("users", "User")
+	if graphql.InsertOne != "addUsersOne" || graphql.Update != "editUsers" || graphql.DeleteByPk != "removeUsersByPk" || graphql.SelectAggregate != "usersStats" {
+		t.Errorf("graphql-default root fields ignore the verbs: %+v", graphql)
+	}
+
+	// empty verbs fall back to the default ones
+	partial := NewSnakeCaseNaming(Config{InsertVerbName: "add"}).RootFields("users", "User")
+	if partial.Insert != "add_users" || partial.Update != "update_users" {
+		t.Errorf("partial config: %+v", partial)
+	}
+}
+
+func TestWithRootFields(t *testing.T) {
+	naming := WithRootFields(NewSnakeCaseNaming(DefaultConfig), map[string]*metadata.CustomRootFields{
+		"users": {Select: "all_users", SelectByPk: "user"},
+	})
+
+	users := naming.RootFields("users", "User")
+	if users.Select != "all_users" || users.SelectByPk != "user" || users.Insert != "insert_users" {
+		t.Errorf("root fields of users: %+v", users)
+	}
+
+	if groups := naming.RootFields("groups", "Group"); groups.Select != "groups" {
+		t.Errorf("root fields of a table without override: %+v", groups)
+	}
+
+	if name := naming.ColumnName("created_at", "created_at"); name != "created_at" {
+		t.Errorf("column name %q, want the one of the wrapped strategy", name)
+	}
+}
+
+func TestReadNamingConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "naming")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "naming.yaml")
+	content := `strategy: snake-case
+insert_verb: add
+aggregate_verb: stats
+root_fields:
+  users:
+    select_by_pk: user
+`
+
+	if err := ioutil.WriteFile(filename, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	config, err := ReadNamingConfig(filename)
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	naming, err := config.Naming()
+	if err != nil {
+		t.Fatalf("%+v", err)
+	}
+
+	users := naming.RootFields("users", "User")
+	if users.Insert != "add_users" || users.SelectAggregate != "users_stats" || users.SelectByPk != "user" || users.Update != "update_users" {
+		t.Errorf("root fields of the naming file: %+v", users)
+	}
+
+	if _, err := ReadNamingConfig(filepath.Join(dir, "missing.yaml")); err == nil {
+		t.Error("expected an error for a missing naming file")
+	}
+}
+
+type names struct {
+	typeName     string
+	column       string
+	foreignKey   string
+	relationship string
+	rootFields   metadata.CustomRootFields
+}
+
+func assertNames(t *testing.T, naming NamingStrategy, table, node string, want names) {
+	t.Helper()
+
+	if got := naming.TypeName(table, node); got != want.typeName {
+		t.Errorf("TypeName = %q, want %q", got, want.typeName)
+	}
+
+	if got := naming.ColumnName("created_at", "created_at"); got != want.column {
+		t.Errorf("ColumnName = %q, want %q", got, want.column)
+	}
+
+	if got := naming.ForeignKeyName("group_users", "group_users"); got != want.foreignKey {
+		t.Errorf("ForeignKeyName = %q, want %q", got, want.foreignKey)
+	}
+
+	if got := naming.RelationshipName("group_users"); got != want.relationship {
+		t.Errorf("RelationshipName = %q, want %q", got, want.relationship)
+	}
+
+	if got := naming.RootFields(table, node); *got != want.rootFields {
+		t.Errorf("RootFields = %+v, want %+v", *got, want.rootFields)
+	}
+}
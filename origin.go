@@ -0,0 +1,210 @@
+package enthasura
+
+import (
+	"strings"
+
+	"entgo.io/ent/entc/gen"
+	"github.com/minskylab/hasura-api/metadata"
+)
+
+// QueryOrigin identifies the ent node, edge, role and operation a metadata query was generated from.
+type QueryOrigin struct {
+	Node      string `json:"node,omitempty"`
+	Edge      string `json:"edge,omitempty"`
+	Role      string `json:"role,omitempty"`
+	Operation string `json:"operation,omitempty"`
+	Action    string `json:"action,omitempty"`
+}
+
+func (o *QueryOrigin) String() string {
+	if o == nil {
+		return "unknown origin"
+	}
+
+	parts := []string{}
+
+	if o.Node != "" {
+		parts = append(parts, "node="+o.Node)
+	}
+
+	if o.Edge != "" {
+		parts = append(parts, "edge="+o.Edge)
+	}
+
+	if o.Role != "" {
+		parts = append(parts, "role="+o.Role)
+	}
+
+	if o.Operation != "" {
+		parts = append(parts, "operation="+o.Operation)
+	}
+
+	if o.Action != "" {
+		parts = append(parts, "action="+o.Action)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+var queryOperations = map[metadata.MetadataRequestType]string{
+	metadata.PgTrackTable:               "track",
+	metadata.PgUntrackTable:             "untrack",
+	metadata.PgSetTableCustomization:    "customize",
+	metadata.PgCreateObjectRelationship: "object relationship",
+	metadata.PgCreateArrayRelationship:  "array relationship",
+	metadata.PgDropRelationship:         "drop relationship",
+	metadata.PgCreateInsertPermission:   "insert",
+	metadata.PgCreateSelectPermission:   "select",
+	metadata.PgCreateUpdatePermission:   "update",
+	metadata.PgCreateDeletePermission:   "delete",
+	metadata.PgDropInsertPermission:     "drop insert",
+	metadata.PgDropSelectPermission:     "drop select",
+	metadata.PgDropUpdatePermission:     "drop update",
+	metadata.PgDropDeletePermission:     "drop delete",
+	metadata.PgCreateEventTrigger:       "event trigger",
+	metadata.PgDeleteEventTrigger:       "delete event trigger",
+	metadata.SetCustomTypes:             "custom types",
+	metadata.CreateAction:               "create action",
+	metadata.UpdateAction:               "update action",
+	metadata.DropAction:                 "drop action",
+	metadata.CreateActionPermission:     "action permission",
+}
+
+// annotateOrigins sets the origin of every query of the phases, schemaName is the schema of the
+// tables without table annotation.
+func annotateOrigins(graph *gen.Graph, schemaName string, naming NamingStrategy, phases ...*PlanPhase) {
+	naming = namingOrDefault(naming)
+	schemas := newTableSchemas(graph, schemaName)
+
+	for _, phase := range phases {
+		phase.Origins = make([]*QueryOrigin, len(phase.Queries))
+
+		for i, query := range phase.Queries {
+			phase.Origins[i] = queryOrigin(graph, schemas, naming, query)
+		}
+	}
+}
+
+// queryOrigin finds the ent node (and edge, for join tables and relationships) a query was generated from.
+func queryOrigin(graph *gen.Graph, schemas *tableSchemas, naming NamingStrategy, query metadata.MetadataQuery) *QueryOrigin {
+	origin := &QueryOrigin{Operation: queryOperations[query.Type]}
+
+	switch args := query.Args.(type) {
+	case *ActionArgs:
+		origin.Action = args.Name
+		return origin
+	case *DropActionArgs:
+		origin.Action = args.Name
+		return origin
+	case *ActionPermissionArgs:
+		origin.Action, origin.Role = args.Action, args.Role
+		return origin
+	case *CustomTypes:
+		return origin
+	}
+
+	if graph == nil {
+		return origin
+	}
+
+	table, name, role := queryTarget(query)
+	origin.Role = role
+
+	return tableOrigin(graph, schemas, naming, origin, table, name)
+}
+
+// tableOrigin sets the node of the table to the origin, and the edge of the relationship name. The
+// table matches a node only in the schema the node is tracked in.
+func tableOrigin(graph *gen.Graph, schemas *tableSchemas, naming NamingStrategy, origin *QueryOrigin, table metadata.QualifiedTableName, name string) *QueryOrigin {
+	inSchema := func(name string) bool {
+		return name == table.Name && schemas.schema(name) == table.Schema
+	}
+
+	for _, node := range graph.Nodes {
+		if inSchema(node.Table()) {
+			origin.Node = node.Name
+
+			for _, edge := range node.Edges {
+				if name != "" && relationshipName(naming, edge) == name {
+					origin.Edge = edge.Name
+				}
+			}
+
+			return origin
+		}
+	}
+
+	for _, node := range graph.Nodes {
+		for _, edge := range node.Edges {
+			if inSchema(edge.Rel.Table) && !edge.IsInverse() {
+				origin.Node = node.Name
+				origin.Edge = edge.Name
+
+				return origin
+			}
+		}
+	}
+
+	return origin
+}
+
+// queryTarget returns the table, the relationship name and the role a query refers to.
+func queryTarget(query metadata.MetadataQuery) (metadata.QualifiedTableName, string, string) {
+	var (
+		table      metadata.ITableName
+		name, role string
+	)
+
+	switch args := query.Args.(type) {
+	case *metadata.PgTrackTableArgs:
+		table = args.Table
+	case *metadata.PgUntrackTableArgs:
+		table = args.Table
+	case *PgSetTableCustomizationArgs:
+		table = args.Table
+	case *metadata.PgCreateObjectRelationshipArgs:
+		table, name = args.Table, args.Name
+	case *metadata.PgCreateArrayRelationshipArgs:
+		table, name = args.Table, args.Name
+	case *metadata.PgDropRelationshipArgs:
+		table, name = args.Table, args.Relationship
+	case *metadata.PgCreateInsertPermissionArgs:
+		table, role = args.Table, args.Role
+	case *metadata.PgCreateSelectPermissionArgs:
+		table, role = args.Table, args.Role
+	case *metadata.PgCreateUpdatePermissionArgs:
+		table, role = args.Table, args.Role
+	case *metadata.PgCreateDeletePermissionArgs:
+		table, role = args.Table, args.Role
+	case *metadata.PgDropInsertPermissionArgs:
+		table, role = args.Table, args.Role
+	case *metadata.PgDropSelectPermissionArgs:
+		table, role = args.Table, args.Role
+	case *metadata.PgDropUpdatePermissionArgs:
+		table, role = args.Table, args.Role
+	case *metadata.PgDropDeletePermissionArgs:
+		table, role = args.Table, args.Role
+	case *PgCreateEventTriggerArgs:
+		table, name = args.Table, args.Name
+	case *PgDeleteEventTriggerArgs:
+		table, name = args.Table, args.Name
+	}
+
+	return qualifiedTableName(table), name, role
+}
+
+// qualifiedTableName returns the table with its schema, public when it is given by name like the
+// engine does.
+func qualifiedTableName(table metadata.ITableName) metadata.QualifiedTableName {
+	switch t := table.(type) {
+	case metadata.QualifiedTableName:
+		if t.Schema == "" {
+			t.Schema = "public"
+		}
+		return t
+	case metadata.TableName:
+		return metadata.QualifiedTableName{Schema: "public", Name: string(t)}
+	}
+
+	return metadata.QualifiedTableName{}
+}
@@ -4,7 +4,7 @@ import (
 	"github.com/minskylab/hasura-api/metadata"
 )
 
-func (r *Runtime) pgCreateInsertPermission(perm map[string]interface{}, tableName, roleName, sourceName, schemaName string) metadata.MetadataQuery {
+func pgCreateInsertPermission(perm map[string]interface{}, tableName, roleName, sourceName, schemaName string) metadata.MetadataQuery {
 	return metadata.PgCreateInsertPermissionQuery(&metadata.PgCreateInsertPermissionArgs{
 		Permission: metadata.GenericPermission(perm),
 		Table: metadata.QualifiedTableName{
@@ -16,7 +16,7 @@ func (r *Runtime) pgCreateInsertPermission(perm map[string]interface{}, tableNam
 	})
 }
 
-func (r *Runtime) pgCreateSelectPermission(perm map[string]interface{}, tableName, role, sourceName, schemaName string) metadata.MetadataQuery {
+func pgCreateSelectPermission(perm map[string]interface{}, tableName, role, sourceName, schemaName string) metadata.MetadataQuery {
 	return metadata.PgCreateSelectPermissionQuery(&metadata.PgCreateSelectPermissionArgs{
 		Permission: metadata.GenericPermission(perm),
 		Table: metadata.QualifiedTableName{
@@ -28,7 +28,7 @@ func (r *Runtime) pgCreateSelectPermission(perm map[string]interface{}, tableNam
 	})
 }
 
-func (r *Runtime) pgCreateUpdatePermission(perm map[string]interface{}, tableName, role, sourceName, schemaName string) metadata.MetadataQuery {
+func pgCreateUpdatePermission(perm map[string]interface{}, tableName, role, sourceName, schemaName string) metadata.MetadataQuery {
 	return metadata.PgCreateUpdatePermissionQuery(&metadata.PgCreateUpdatePermissionArgs{
 		Permission: metadata.GenericPermission(perm),
 		Table: metadata.QualifiedTableName{
@@ -40,7 +40,7 @@ func (r *Runtime) pgCreateUpdatePermission(perm map[string]interface{}, tableNam
 	})
 }
 
-func (r *Runtime) pgCreateDeletePermission(perm map[string]interface{}, tableName, role, sourceName, schemaName string) metadata.MetadataQuery {
+func pgCreateDeletePermission(perm map[string]interface{}, tableName, role, sourceName, schemaName string) metadata.MetadataQuery {
 	return metadata.PgCreateDeletePermissionQuery(&metadata.PgCreateDeletePermissionArgs{
 		Permission: metadata.GenericPermission(perm),
 		Table: metadata.QualifiedTableName{
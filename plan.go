@@ -0,0 +1,263 @@
+package enthasura
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+
+	"entgo.io/ent/entc"
+	"entgo.io/ent/entc/gen"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+)
+
+// PlanPhase is a group of metadata queries sent together in a single bulk request.
+type PlanPhase struct {
+	Name    string                   `json:"name"`
+	Queries []metadata.MetadataQuery `json:"queries"`
+	Origins []*QueryOrigin           `json:"origins,omitempty"`
+}
+
+// Plan holds every metadata query PerformFullMetadataTransform would send, in order.
+type Plan struct {
+	Phases []*PlanPhase `json:"phases"`
+}
+
+func (p *Plan) add(phases ...*PlanPhase) {
+	p.Phases = append(p.Phases, phases...)
+}
+
+// Len returns the number of queries in the plan.
+func (p *Plan) Len() int {
+	total := 0
+	for _, phase := range p.Phases {
+		total += len(phase.Queries)
+	}
+
+	return total
+}
+
+// PlanFullMetadataTransform loads the ent schema and returns the plan PerformFullMetadataTransform
+// would apply, without contacting a Hasura server.
+func PlanFullMetadataTransform(entSchemaPath string, sourceName, schemaName string, naming NamingStrategy) (*Plan, error) {
+	graph, err := entc.LoadGraph(entSchemaPath, &gen.Config{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return PlanFullGraphTransform(graph, sourceName, schemaName, naming)
+}
+
+// PlanFullGraphTransform is PlanFullMetadataTransform for an already loaded graph.
+func PlanFullGraphTransform(graph *gen.Graph, sourceName, schemaName string, naming NamingStrategy) (*Plan, error) {
+	return planFromGraph(graph, sourceName, schemaName, "", naming)
+}
+
+func planFromGraph(graph *gen.Graph, sourceName, schemaName, defaultRole string, naming NamingStrategy) (*Plan, error) {
+	if err := validateGraph(graph, schemaName, naming); err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{}
+
+	prelude, err := preludePhases(graph, sourceName, schemaName)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	track, err := trackPhases(graph, sourceName, schemaName)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	customize, err := customizePhases(graph, sourceName, schemaName, naming)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	plan.add(prelude...)
+	plan.add(track...)
+	plan.add(customize...)
+	permissions, err := permissionPhases(graph, sourceName, schemaName, defaultRole, naming)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	plan.add(permissions...)
+
+	triggers, err := eventTriggerPhases(graph, sourceName, schemaName)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	plan.add(triggers...)
+
+	annotateOrigins(graph, schemaName, naming, plan.Phases...)
+
+	return plan, nil
+}
+
+func preludePhases(graph *gen.Graph, sourceName, schemaName string) ([]*PlanPhase, error) {
+	untrackBatch, err := untrackTablesQueries(graph, sourceName, schemaName)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return []*PlanPhase{{Name: "untrack tables", Queries: untrackBatch}}, nil
+}
+
+func trackPhases(graph *gen.Graph, sourceName, schemaName string) ([]*PlanPhase, error) {
+	trackBatch, err := trackTablesQueries(graph, sourceName, schemaName)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return []*PlanPhase{{Name: "track tables", Queries: trackBatch}}, nil
+}
+
+func customizePhases(graph *gen.Graph, sourceName, schemaName string, naming NamingStrategy) ([]*PlanPhase, error) {
+	queries, err := customizeTablesQueries(graph, sourceName, schemaName, naming)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return []*PlanPhase{
+		{Name: "customize tables", Queries: queries.tables},
+		{Name: "object relationships", Queries: queries.objectRelationships},
+		{Name: "array relationships", Queries: queries.arrayRelationships},
+	}, nil
+}
+
+func permissionPhases(graph *gen.Graph, sourceName, schemaName, defaultRole string, naming NamingStrategy) ([]*PlanPhase, error) {
+	queries, err := permissionsQueries(graph, sourceName, schemaName, defaultRole, naming)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return []*PlanPhase{
+		{Name: "insert permissions", Queries: queries.inserts},
+		{Name: "select permissions", Queries: queries.selects},
+		{Name: "update permissions", Queries: queries.updates},
+		{Name: "delete permissions", Queries: queries.deletes},
+	}, nil
+}
+
+func eventTriggerPhases(graph *gen.Graph, sourceName, schemaName string) ([]*PlanPhase, error) {
+	queries, err := eventTriggersQueries(graph, sourceName, schemaName)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return []*PlanPhase{{Name: "event triggers", Queries: queries}}, nil
+}
+
+// WriteJSON writes the plan as indented JSON, with the exact queries that would be sent.
+func (p *Plan) WriteJSON(w io.Writer) error {
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	_, err = fmt.Fprintln(w, string(data))
+	return errors.WithStack(err)
+}
+
+// WriteText writes a human readable summary of the plan, one line per query.
+func (p *Plan) WriteText(w io.Writer) error {
+	for i, phase := range p.Phases {
+		if _, err := fmt.Fprintf(w, "[%d] %s (%d queries)\n", i+1, phase.Name, len(phase.Queries)); err != nil {
+			return errors.WithStack(err)
+		}
+
+		for j, query := range phase.Queries {
+			line := describeQuery(query)
+			if j < len(phase.Origins) && phase.Origins[j] != nil && phase.Origins[j].Node != "" {
+				line += " (" + phase.Origins[j].String() + ")"
+			}
+
+			if _, err := fmt.Fprintf(w, "    %s\n", line); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+	}
+
+	_, err := fmt.Fprintf(w, "%d queries in %d phases\n", p.Len(), len(p.Phases))
+	return errors.WithStack(err)
+}
+
+func describeTable(table metadata.ITableName) string {
+	switch t := table.(type) {
+	case metadata.QualifiedTableName:
+		if t.Schema == "" {
+			return t.Name
+		}
+		return t.Schema + "." + t.Name
+	case metadata.TableName:
+		return string(t)
+	}
+
+	return fmt.Sprint(table)
+}
+
+// tableNameOf returns the table name without its schema.
+func tableNameOf(table metadata.ITableName) string {
+	name := describeTable(table)
+	return name[strings.LastIndex(name, ".")+1:]
+}
+
+// describeQuery returns a one line description of a metadata query: its type, target table and name or role.
+func describeQuery(query metadata.MetadataQuery) string {
+	parts := []string{string(query.Type)}
+
+	switch args := query.Args.(type) {
+	case *metadata.PgTrackTableArgs:
+		parts = append(parts, describeTable(args.Table))
+	case *metadata.PgUntrackTableArgs:
+		parts = append(parts, describeTable(args.Table))
+		if args.Cascade {
+			parts = append(parts, "cascade")
+		}
+	case *PgSetTableCustomizationArgs:
+		parts = append(parts, describeTable(args.Table))
+		if args.Configuration != nil && args.Configuration.CustomName != "" {
+			parts = append(parts, "as "+args.Configuration.CustomName)
+		}
+	case *metadata.PgCreateObjectRelationshipArgs:
+		parts = append(parts, describeTable(args.Table), args.Name)
+	case *metadata.PgCreateArrayRelationshipArgs:
+		parts = append(parts, describeTable(args.Table), args.Name)
+	case *metadata.PgDropRelationshipArgs:
+		parts = append(parts, describeTable(args.Table), args.Relationship)
+	case *metadata.PgCreateInsertPermissionArgs:
+		parts = append(parts, describeTable(args.Table), "role="+args.Role)
+	case *metadata.PgCreateSelectPermissionArgs:
+		parts = append(parts, describeTable(args.Table), "role="+args.Role)
+	case *metadata.PgCreateUpdatePermissionArgs:
+		parts = append(parts, describeTable(args.Table), "role="+args.Role)
+	case *metadata.PgCreateDeletePermissionArgs:
+		parts = append(parts, describeTable(args.Table), "role="+args.Role)
+	case *metadata.PgDropInsertPermissionArgs:
+		parts = append(parts, describeTable(args.Table), "role="+args.Role)
+	case *metadata.PgDropSelectPermissionArgs:
+		parts = append(parts, describeTable(args.Table), "role="+args.Role)
+	case *metadata.PgDropUpdatePermissionArgs:
+		parts = append(parts, describeTable(args.Table), "role="+args.Role)
+	case *metadata.PgDropDeletePermissionArgs:
+		parts = append(parts, describeTable(args.Table), "role="+args.Role)
+	case *PgCreateEventTriggerArgs:
+		parts = append(parts, describeTable(args.Table), args.Name)
+	case *PgDeleteEventTriggerArgs:
+		parts = append(parts, describeTable(args.Table), args.Name)
+	case *ActionArgs:
+		parts = append(parts, args.Name)
+	case *DropActionArgs:
+		parts = append(parts, args.Name)
+	case *ActionPermissionArgs:
+		parts = append(parts, args.Action, "role="+args.Role)
+	case *CustomTypes:
+		parts = append(parts, fmt.Sprintf("%d input objects, %d objects, %d scalars", len(args.InputObjects), len(args.Objects), len(args.Scalars)))
+	}
+
+	return strings.Join(parts, " ")
+}
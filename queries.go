@@ -0,0 +1,471 @@
+package enthasura
+
+import (
+	"entgo.io/ent/entc/gen"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// untrackTablesQueries untracks every table of the graph, the skipped ones included.
+func untrackTablesQueries(graph *gen.Graph, sourceName, schemaName string) ([]metadata.MetadataQuery, error) {
+	allTables, err := graph.Tables()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	schemas := newTableSchemas(graph, schemaName)
+
+	untrackBatch := []metadata.MetadataQuery{}
+	for _, table := range allTables {
+		untrackBatch = append(untrackBatch, metadata.PgUntrackTableQuery(&metadata.PgUntrackTableArgs{
+			Table: metadata.QualifiedTableName{
+				Name:   table.Name,
+				Schema: schemas.schema(table.Name),
+			},
+			Cascade: true,
+			Source:  sourceName,
+		}))
+	}
+
+	return untrackBatch, nil
+}
+
+func trackTablesQueries(graph *gen.Graph, sourceName, schemaName string) ([]metadata.MetadataQuery, error) {
+	allTables, err := graph.Tables()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	schemas := newTableSchemas(graph, schemaName)
+
+	trackBatch := []metadata.MetadataQuery{}
+	for _, table := range allTables {
+		if schemas.skip(table.Name) {
+			logrus.Infof("skipping table %s", table.Name)
+			continue
+		}
+
+		trackBatch = append(trackBatch, metadata.PgTrackTableQuery(&metadata.PgTrackTableArgs{
+			Table: metadata.QualifiedTableName{
+				Name:   table.Name,
+				Schema: schemas.schema(table.Name),
+			},
+			Source: sourceName,
+		}))
+	}
+
+	return trackBatch, nil
+}
+
+type customizeQueries struct {
+	tables              []metadata.MetadataQuery
+	objectRelationships []metadata.MetadataQuery
+	arrayRelationships  []metadata.MetadataQuery
+}
+
+func customizeTablesQueries(graph *gen.Graph, sourceName, schemaName string, naming NamingStrategy) (*customizeQueries, error) {
+	tables, err := obtainHasuraTablesFromEntSchema(graph, schemaName, naming)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	queries := &customizeQueries{
+		tables:              []metadata.MetadataQuery{},
+		objectRelationships: []metadata.MetadataQuery{},
+		arrayRelationships:  []metadata.MetadataQuery{},
+	}
+
+	for _, def := range tables {
+		queries.tables = append(queries.tables, pgSetTableCustomizationQuery(&PgSetTableCustomizationArgs{
+			Table:         def.Table,
+			Source:        sourceName,
+			Configuration: def.Configuration,
+		}))
+
+		for _, rel := range def.ObjectRelationships {
+			queries.objectRelationships = append(queries.objectRelationships, metadata.PgCreateObjectRelationshipQuery(&metadata.PgCreateObjectRelationshipArgs{
+				Table:  def.Table,
+				Name:   rel.Name,
+				Source: sourceName,
+				Using:  rel.Using.(metadata.ObjRelUsing),
+			}))
+		}
+
+		for _, rel := range def.ArrayRelationships {
+			queries.arrayRelationships = append(queries.arrayRelationships, metadata.PgCreateArrayRelationshipQuery(&metadata.PgCreateArrayRelationshipArgs{
+				Table:  def.Table,
+				Name:   rel.Name,
+				Source: sourceName,
+				Using:  rel.Using.(metadata.ArrRelUsing),
+			}))
+		}
+	}
+
+	return queries, nil
+}
+
+type permissionQueries struct {
+	inserts []metadata.MetadataQuery
+	selects []metadata.MetadataQuery
+	updates []metadata.MetadataQuery
+	deletes []metadata.MetadataQuery
+}
+
+// permissionsQueries builds the permission queries declared with PermissionsRoleAnnotation.
+// defaultRole is used for annotations that do not declare a role.
+func permissionsQueries(graph *gen.Graph, sourceName, schemaName, defaultRole string, naming NamingStrategy) (*permissionQueries, error) {
+	naming = namingOrDefault(naming)
+
+	queries := &permissionQueries{
+		inserts: []metadata.MetadataQuery{},
+		selects: []metadata.MetadataQuery{},
+		updates: []metadata.MetadataQuery{},
+		deletes: []metadata.MetadataQuery{},
+	}
+
+	nodeTables := []string{} // "permissions"
+
+	for _, n := range graph.Nodes {
+		nodeTables = append(nodeTables, n.Table())
+	}
+
+	schemas := newTableSchemas(graph, schemaName)
+
+	for _, node := range graph.Nodes {
+		if schemas.skip(node.Table()) {
+			continue
+		}
+
+		nodeSchema := schemas.schema(node.Table())
+
+		for _, permAnn := range rolePermissionsFromNode(node, defaultRole) {
+			roleName, _ := permAnn["role"].(string)
+			if roleName == "" {
+				logrus.Warn("skipping node: ", node.Name, " as it does not have permissions role name in annotation")
+				continue
+			}
+
+			keepAllColumns, _ := permAnn["keep_all_columns"].(bool)
+
+			var err error
+
+			if insertPermission, isOk := permAnn["insert_permission"].(map[string]interface{}); isOk {
+				insertPermission = expandAllColumns(node, roleName, "insert", insertPermission, keepAllColumns)
+				insertPermission, err = applyColumnAnnotations(node, roleName, "insert", insertPermission)
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+
+				queries.inserts = append(
+					queries.inserts,
+					pgCreateInsertPermission(insertPermission, node.Table(), roleName, sourceName, nodeSchema),
+				)
+
+				queries.inserts = append(
+					queries.inserts,
+					createInsertPermissionForEdges(nodeTables, node, insertPermission, roleName, sourceName, schemas, naming)...,
+				)
+			}
+
+			if selectPermission, isOk := permAnn["select_permission"].(map[string]interface{}); isOk {
+				selectPermission = expandAllColumns(node, roleName, "select", selectPermission, keepAllColumns)
+				selectPermission, err = applyColumnAnnotations(node, roleName, "select", selectPermission)
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+
+				queries.selects = append(
+					queries.selects,
+					pgCreateSelectPermission(selectPermission, node.Table(), roleName, sourceName, nodeSchema),
+				)
+
+				queries.selects = append(
+					queries.selects,
+					createSelectPermissionForEdges(nodeTables, node, selectPermission, roleName, sourceName, schemas, naming)...,
+				)
+			}
+
+			if updatePermission, isOk := permAnn["update_permission"].(map[string]interface{}); isOk {
+				updatePermission = expandAllColumns(node, roleName, "update", updatePermission, keepAllColumns)
+				updatePermission, err = applyColumnAnnotations(node, roleName, "update", updatePermission)
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+
+				queries.updates = append(
+					queries.updates,
+					pgCreateUpdatePermission(updatePermission, node.Table(), roleName, sourceName, nodeSchema),
+				)
+
+				queries.updates = append(
+					queries.updates,
+					createUpdatePermissionForEdges(nodeTables, node, updatePermission, roleName, sourceName, schemas, naming)...,
+				)
+			}
+
+			if deletePermission, isOk := permAnn["delete_permission"].(map[string]interface{}); isOk {
+				queries.deletes = append(
+					queries.deletes,
+					pgCreateDeletePermission(deletePermission, node.Table(), roleName, sourceName, nodeSchema),
+				)
+
+				queries.deletes = append(
+					queries.deletes,
+					createDeletePermissionForEdges(nodeTables, node, deletePermission, roleName, sourceName, schemas, naming)...,
+				)
+			}
+		}
+	}
+
+	return queries, nil
+}
+
+// rolePermissionsFromNode returns the permissions of every role declared on the node, read from both
+// PermissionsRoleAnnotation and PermissionsAnnotation. Annotations declaring the same role are merged,
+// the last declared operation wins. defaultRole replaces empty role names.
+func rolePermissionsFromNode(node *gen.Type, defaultRole string) []map[string]interface{} {
+	declared := []interface{}{}
+
+	for _, name := range []string{hasuraPermissionsRoleAnnotationName, hasuraPermissionsAnnotationName} {
+		ann, isOk := node.Annotations[name].(map[string]interface{})
+		if !isOk {
+			continue
+		}
+
+		if roles, isOk := ann["roles"].([]interface{}); isOk { // merged or list annotations
+			declared = append(declared, roles...)
+			continue
+		}
+
+		declared = append(declared, ann)
+	}
+
+	roles := []map[string]interface{}{}
+
+	for _, raw := range declared {
+		permAnn, isOk := raw.(map[string]interface{})
+		if !isOk {
+			continue
+		}
+
+		roleName, _ := permAnn["role"].(string)
+		if roleName == "" {
+			roleName = defaultRole
+		}
+
+		var current map[string]interface{}
+		for _, role := range roles {
+			if role["role"] == roleName {
+				current = role
+			}
+		}
+
+		if current == nil {
+			current = map[string]interface{}{"role": roleName}
+			roles = append(roles, current)
+		}
+
+		for key, value := range permAnn {
+			if key != "role" && value != nil {
+				current[key] = value
+			}
+		}
+	}
+
+	return roles
+}
+
+// expandAllColumns replaces "*" in the columns of a permission with the columns of the node,
+// without the sensitive fields on select and the immutable fields on update.
+func expandAllColumns(node *gen.Type, role, operation string, permission map[string]interface{}, keepAllColumns bool) map[string]interface{} {
+	if keepAllColumns || permission["columns"] != string(AllColumns) {
+		return permission
+	}
+
+	columns := nodeColumns(node, func(field *gen.Field) bool {
+		excluded := (operation == "select" && field.Sensitive()) || (operation == "update" && field.Immutable)
+		if excluded {
+			logrus.Infof("excluding %s field %s of %s from %s permission of role %s", fieldTrait(field), field.Name, node.Name, operation, role)
+		}
+
+		return !excluded
+	})
+
+	expanded := make(map[string]interface{}, len(permission))
+	for key, value := range permission {
+		expanded[key] = value
+	}
+
+	expanded["columns"] = columns
+
+	return expanded
+}
+
+// nodeColumns returns the columns of the table of the node, the ones "*" stands for, without the
+// fields keep rejects. The id is a field too, e.g. an immutable string id is left out of updates. A nil
+// keep keeps every field.
+func nodeColumns(node *gen.Type, keep func(field *gen.Field) bool) []string {
+	columns := []string{}
+	if node.ID != nil && (keep == nil || keep(node.ID)) {
+		columns = append(columns, node.ID.StorageKey())
+	}
+
+	for _, field := range node.Fields {
+		if keep == nil || keep(field) {
+			columns = append(columns, field.StorageKey())
+		}
+	}
+
+	for _, edge := range node.Edges {
+		if (edge.M2O() || (edge.O2O() && edge.OwnFK())) && !elementInArray(columns, edge.Rel.Column()) && !isFieldColumn(node, edge.Rel.Column()) {
+			columns = append(columns, edge.Rel.Column())
+		}
+	}
+
+	// foreign keys of edges declared only on the other side.
+	for _, fk := range node.ForeignKeys {
+		if column := fk.Field.StorageKey(); !fk.UserDefined && !elementInArray(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+
+	return columns
+}
+
+func isFieldColumn(node *gen.Type, column string) bool {
+	for _, field := range node.Fields {
+		if field.StorageKey() == column {
+			return true
+		}
+	}
+
+	return false
+}
+
+func fieldTrait(field *gen.Field) string {
+	if field.Sensitive() {
+		return "sensitive"
+	}
+
+	return "immutable"
+}
+
+func isNodeTable(nodeTables []string, tableName string) bool {
+	for _, nodeTable := range nodeTables {
+		if nodeTable == tableName {
+			return true
+		}
+	}
+
+	return false
+}
+
+func createInsertPermissionForEdges(nodeTables []string, node *gen.Type, permission map[string]interface{}, role string, sourceName string, schemas *tableSchemas, naming NamingStrategy) []metadata.MetadataQuery {
+	bulkEdgePermissions := []metadata.MetadataQuery{}
+
+	for _, edge := range node.Edges {
+		if !edge.IsInverse() && !edge.OwnFK() {
+			tableName := edge.Rel.Table
+			if isNodeTable(nodeTables, tableName) || schemas.skip(tableName) {
+				continue
+			}
+
+			tableName, newPermission := tableAndPermissionsFromEdge(edge, nodeTables, permission, naming)
+
+			bulkEdgePermissions = append(bulkEdgePermissions, pgCreateInsertPermission(newPermission, tableName, role, sourceName, schemas.schema(tableName)))
+		}
+	}
+
+	return bulkEdgePermissions
+}
+
+func createSelectPermissionForEdges(nodeTables []string, node *gen.Type, permission map[string]interface{}, role string, sourceName string, schemas *tableSchemas, naming NamingStrategy) []metadata.MetadataQuery {
+	bulkEdgePermissions := []metadata.MetadataQuery{}
+
+	for _, edge := range node.Edges {
+		if !edge.IsInverse() && !edge.OwnFK() {
+			tableName := edge.Rel.Table
+			if isNodeTable(nodeTables, tableName) || schemas.skip(tableName) {
+				continue
+			}
+
+			tableName, newPermission := tableAndPermissionsFromEdge(edge, nodeTables, permission, naming)
+
+			bulkEdgePermissions = append(bulkEdgePermissions, pgCreateSelectPermission(newPermission, tableName, role, sourceName, schemas.schema(tableName)))
+		}
+	}
+
+	return bulkEdgePermissions
+}
+
+func createUpdatePermissionForEdges(nodeTables []string, node *gen.Type, permission map[string]interface{}, role string, sourceName string, schemas *tableSchemas, naming NamingStrategy) []metadata.MetadataQuery {
+	bulkEdgePermissions := []metadata.MetadataQuery{}
+
+	for _, edge := range node.Edges {
+		if !edge.IsInverse() && !edge.OwnFK() {
+			tableName := edge.Rel.Table
+			if isNodeTable(nodeTables, tableName) || schemas.skip(tableName) {
+				continue
+			}
+
+			tableName, newPermission := tableAndPermissionsFromEdge(edge, nodeTables, permission, naming)
+
+			bulkEdgePermissions = append(bulkEdgePermissions, pgCreateUpdatePermission(newPermission, tableName, role, sourceName, schemas.schema(tableName)))
+		}
+	}
+
+	return bulkEdgePermissions
+}
+
+func createDeletePermissionForEdges(nodeTables []string, node *gen.Type, permission map[string]interface{}, role string, sourceName string, schemas *tableSchemas, naming NamingStrategy) []metadata.MetadataQuery {
+	bulkEdgePermissions := []metadata.MetadataQuery{}
+
+	for _, edge := range node.Edges {
+		if !edge.IsInverse() && !edge.OwnFK() {
+			tableName := edge.Rel.Table
+			if isNodeTable(nodeTables, tableName) || schemas.skip(tableName) {
+				continue
+			}
+
+			tableName, newPermission := tableAndPermissionsFromEdge(edge, nodeTables, permission, naming)
+
+			bulkEdgePermissions = append(bulkEdgePermissions, pgCreateDeletePermission(newPermission, tableName, role, sourceName, schemas.schema(tableName)))
+		}
+	}
+
+	return bulkEdgePermissions
+}
+
+func tableAndPermissionsFromEdge(edge *gen.Edge, nodeTables []string, permission map[string]interface{}, naming NamingStrategy) (string, map[string]interface{}) {
+	tableName := edge.Rel.Table
+
+	edges := []joinEdge{{node: edge.Owner, edge: edge}}
+	if edge.Ref != nil {
+		edges = append(edges, joinEdge{node: edge.Type, edge: edge.Ref})
+	}
+
+	source, _ := joinColumns(edge)
+	levelUp := joinColumnRelationshipName(naming, edges, source)
+	newPermission := make(map[string]interface{})
+
+	for k, v := range permission {
+		newPermission[k] = v
+	}
+
+	newPermission["columns"] = edge.Rel.Columns
+
+	if newPermission["check"] != nil || levelUp == "" {
+		newPermission["check"] = map[string]interface{}{
+			levelUp: newPermission["check"],
+		}
+	}
+
+	if newPermission["filter"] != nil || levelUp == "" {
+		newPermission["filter"] = map[string]interface{}{
+			levelUp: newPermission["filter"],
+		}
+	}
+
+	return tableName, newPermission
+}
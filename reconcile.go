@@ -0,0 +1,780 @@
+package enthasura
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"entgo.io/ent/entc"
+	"entgo.io/ent/entc/gen"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+)
+
+// PerformIncrementalMetadataTransform reconciles the metadata of the Hasura server with the ent schema.
+// Unlike PerformFullMetadataTransform, no table is untracked: only the create, drop and replace
+// operations needed to reach the desired state are sent, so event triggers, remote relationships and
+// permissions of roles not declared in the ent schema are preserved. Relationships not produced by
+// an ent edge and event triggers not declared in the ent schema are dropped only when prune is set. A relationship is replaced only when its columns
+// change, the permissions of the ent schema using it are dropped before it and created again after;
+// it is left unchanged if other permissions use it.
+func (r *Runtime) PerformIncrementalMetadataTransform(entSchemaPath string, sourceName, schemaName string, prune bool) error {
+	graph, err := entc.LoadGraph(entSchemaPath, &gen.Config{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return r.PerformIncrementalGraphTransform(graph, sourceName, schemaName, prune)
+}
+
+// PerformIncrementalGraphTransform is PerformIncrementalMetadataTransform for an already loaded graph.
+func (r *Runtime) PerformIncrementalGraphTransform(graph *gen.Graph, sourceName, schemaName string, prune bool) error {
+	current, err := r.currentMetadata(graph, schemaName)
+	if err != nil {
+		return err
+	}
+
+	plan, err := r.incrementalPlan(graph, current.Metadata, sourceName, schemaName, prune)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// an up to date metadata can still be inconsistent, the check runs either way
+	if plan.Len() == 0 {
+		logrus.Info("metadata is up to date, nothing to apply")
+		return r.checkConsistency(graph, schemaName, current.Raw)
+	}
+
+	logrus.Infof("reconciling metadata with %d queries", plan.Len())
+
+	if err := r.applyPhases(plan.Phases...); err != nil {
+		return err
+	}
+
+	return r.checkConsistency(graph, schemaName, current.Raw)
+}
+
+// PlanIncrementalMetadataTransform exports the current metadata from the server and returns the
+// plan PerformIncrementalMetadataTransform would apply.
+func (r *Runtime) PlanIncrementalMetadataTransform(entSchemaPath string, sourceName, schemaName string, prune bool) (*Plan, error) {
+	graph, err := entc.LoadGraph(entSchemaPath, &gen.Config{})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return r.PlanIncrementalGraphTransform(graph, sourceName, schemaName, prune)
+}
+
+// PlanIncrementalGraphTransform is PlanIncrementalMetadataTransform for an already loaded graph.
+func (r *Runtime) PlanIncrementalGraphTransform(graph *gen.Graph, sourceName, schemaName string, prune bool) (*Plan, error) {
+	current, err := r.currentMetadata(graph, schemaName)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.incrementalPlan(graph, current.Metadata, sourceName, schemaName, prune)
+}
+
+// currentMetadata validates the graph and exports the current metadata, along with the raw document.
+func (r *Runtime) currentMetadata(graph *gen.Graph, schemaName string) (*HasuraMetadata, error) {
+	if err := validateGraph(graph, schemaName, r.naming); err != nil {
+		return nil, err
+	}
+
+	current, err := r.hasura.ExportMetadata()
+	if err != nil {
+		return nil, errors.WithMessage(errors.WithStack(err), "error exporting current metadata")
+	}
+
+	return current, nil
+}
+
+// incrementalPlan returns the plan reconciling the current metadata with the ent schema.
+func (r *Runtime) incrementalPlan(graph *gen.Graph, current *Metadata, sourceName, schemaName string, prune bool) (*Plan, error) {
+	desired, err := hasuraMetadataFromEntSchema(graph, sourceName, schemaName, "", r.naming)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	currentSource := current.source(sourceName)
+	if currentSource == nil {
+		currentSource = newSource(sourceName)
+	}
+
+	plan := reconcilePlan(currentSource, desired.source(sourceName), prune)
+
+	skipped, err := untrackSkippedTablesPhase(graph, currentSource, schemaName)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	plan.Phases = append([]*PlanPhase{skipped}, plan.Phases...)
+
+	actions, err := reconcileActionPhases(current, r.actions)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	plan.add(actions...)
+
+	annotateOrigins(graph, schemaName, r.naming, plan.Phases...)
+
+	return plan, nil
+}
+
+func (r *Runtime) exportMetadata() (*Metadata, error) {
+	hMetadata, err := r.hasura.ExportMetadata()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return hMetadata.Metadata, nil
+}
+
+// untrackSkippedTablesPhase untracks the tables skipped with TableAnnotation that are still tracked.
+func untrackSkippedTablesPhase(graph *gen.Graph, current *Source, schemaName string) (*PlanPhase, error) {
+	allTables, err := graph.Tables()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	schemas := newTableSchemas(graph, schemaName)
+	phase := &PlanPhase{Name: "untrack skipped tables", Queries: []metadata.MetadataQuery{}}
+
+	for _, table := range allTables {
+		if !schemas.skip(table.Name) || current.table(schemas.schema(table.Name), table.Name) == nil {
+			continue
+		}
+
+		phase.Queries = append(phase.Queries, metadata.PgUntrackTableQuery(&metadata.PgUntrackTableArgs{
+			Table: metadata.QualifiedTableName{
+				Name:   table.Name,
+				Schema: schemas.schema(table.Name),
+			},
+			Cascade: true,
+			Source:  current.Name,
+		}))
+	}
+
+	return phase, nil
+}
+
+type reconciler struct {
+	source  string
+	prune   bool
+	roles   []string
+	current *Source
+	desired *Source
+
+	// replaced holds the permissions already dropped or created, droppedRels the relationships dropped
+	replaced    map[string]bool
+	droppedRels []string
+
+	track        []metadata.MetadataQuery
+	customize    []metadata.MetadataQuery
+	dropPerms    []metadata.MetadataQuery
+	dropRels     []metadata.MetadataQuery
+	objectRels   []metadata.MetadataQuery
+	arrayRels    []metadata.MetadataQuery
+	insertPerms  []metadata.MetadataQuery
+	selectPerms  []metadata.MetadataQuery
+	updatePerms  []metadata.MetadataQuery
+	deletePerms  []metadata.MetadataQuery
+	dropTriggers []metadata.MetadataQuery
+	triggers     []metadata.MetadataQuery
+}
+
+// reconcilePlan compares the current and desired tables of a source and returns the phases needed
+// to go from one to the other. Tables that are not part of the desired source are left untouched.
+func reconcilePlan(current, desired *Source, prune bool) *Plan {
+	rec := &reconciler{
+		source:   desired.Name,
+		prune:    prune,
+		roles:    managedRoles(desired),
+		current:  current,
+		desired:  desired,
+		replaced: map[string]bool{},
+	}
+
+	for _, table := range desired.Tables {
+		rec.reconcileTable(current.table(table.Table.Schema, table.Table.Name), table)
+	}
+
+	rec.recreateDependentPermissions()
+
+	return &Plan{
+		Phases: []*PlanPhase{
+			{Name: "track tables", Queries: rec.track},
+			{Name: "customize tables", Queries: rec.customize},
+			{Name: "drop permissions", Queries: rec.dropPerms},
+			{Name: "drop relationships", Queries: rec.dropRels},
+			{Name: "object relationships", Queries: rec.objectRels},
+			{Name: "array relationships", Queries: rec.arrayRels},
+			{Name: "insert permissions", Queries: rec.insertPerms},
+			{Name: "select permissions", Queries: rec.selectPerms},
+			{Name: "update permissions", Queries: rec.updatePerms},
+			{Name: "delete permissions", Queries: rec.deletePerms},
+			{Name: "delete event triggers", Queries: rec.dropTriggers},
+			{Name: "event triggers", Queries: rec.triggers},
+		},
+	}
+}
+
+// managedRoles returns the roles declared by the ent schema, permissions of other roles are never dropped.
+func managedRoles(source *Source) []string {
+	roles := []string{}
+
+	for _, table := range source.Tables {
+		for _, perms := range [][]*RolePermission{table.InsertPermissions, table.SelectPermissions, table.UpdatePermissions, table.DeletePermissions} {
+			for _, perm := range perms {
+				if !elementInArray(roles, perm.Role) {
+					roles = append(roles, perm.Role)
+				}
+			}
+		}
+	}
+
+	return roles
+}
+
+func (rec *reconciler) reconcileTable(current, desired *Table) {
+	if current == nil {
+		var configuration *metadata.TableConfiguration
+		if desired.Configuration != nil {
+			configuration = &desired.Configuration.TableConfiguration
+		}
+
+		rec.track = append(rec.track, metadata.PgTrackTableQuery(&metadata.PgTrackTableArgs{
+			Table:         desired.Table,
+			Configuration: configuration,
+			Source:        rec.source,
+		}))
+
+		// pg_track_table does not take the column config, the customization sets it afterwards.
+		current = &Table{Table: desired.Table, Configuration: &TableConfiguration{}}
+		if configuration != nil {
+			current.Configuration.TableConfiguration = *configuration
+		}
+	}
+
+	if desired.Configuration != nil && !sameTableConfiguration(current.Configuration, desired.Configuration) {
+		rec.customize = append(rec.customize, pgSetTableCustomizationQuery(&PgSetTableCustomizationArgs{
+			Table:         desired.Table,
+			Configuration: desired.Configuration,
+			Source:        rec.source,
+		}))
+	}
+
+	rec.reconcileRelationships(desired.Table, current.ObjectRelationships, desired.ObjectRelationships, false)
+	rec.reconcileRelationships(desired.Table, current.ArrayRelationships, desired.ArrayRelationships, true)
+
+	rec.reconcilePermissions(desired.Table, metadata.PgCreateInsertPermission, current.InsertPermissions, desired.InsertPermissions)
+	rec.reconcilePermissions(desired.Table, metadata.PgCreateSelectPermission, current.SelectPermissions, desired.SelectPermissions)
+	rec.reconcilePermissions(desired.Table, metadata.PgCreateUpdatePermission, current.UpdatePermissions, desired.UpdatePermissions)
+	rec.reconcilePermissions(desired.Table, metadata.PgCreateDeletePermission, current.DeletePermissions, desired.DeletePermissions)
+
+	rec.reconcileEventTriggers(desired.Table, current.EventTriggers, desired.EventTriggers)
+}
+
+// reconcileEventTriggers creates or replaces the triggers declared in the ent schema, the other
+// triggers of the table are deleted only when prune is set.
+func (rec *reconciler) reconcileEventTriggers(table metadata.QualifiedTableName, current, desired []interface{}) {
+	for _, t := range desired {
+		trigger, isOk := t.(*EventTrigger)
+		if !isOk {
+			continue
+		}
+
+		existing := findEventTrigger(current, trigger.Name)
+		if existing != nil && sameJSON(existing, trigger) {
+			continue
+		}
+
+		rec.triggers = append(rec.triggers, pgCreateEventTriggerQuery(eventTriggerArgs(table, rec.source, trigger, existing != nil)))
+	}
+
+	if !rec.prune {
+		return
+	}
+
+	for _, trigger := range current {
+		name := eventTriggerName(trigger)
+		if findEventTrigger(desired, name) == nil {
+			rec.dropTriggers = append(rec.dropTriggers, pgDeleteEventTriggerQuery(&PgDeleteEventTriggerArgs{
+				Name:   name,
+				Source: rec.source,
+				Table:  table,
+			}))
+		}
+	}
+}
+
+func (rec *reconciler) reconcileRelationships(table metadata.QualifiedTableName, current, desired []*Relationship, array bool) {
+	for _, rel := range desired {
+		existing := findRelationship(current, rel.Name)
+		if existing != nil && sameRelationship(existing.Using, rel.Using) {
+			continue
+		}
+
+		if existing != nil && !rec.dropRelationship(table, rel.Name, "differs from the ent schema") {
+			continue
+		}
+
+		if array {
+			rec.arrayRels = append(rec.arrayRels, metadata.PgCreateArrayRelationshipQuery(&metadata.PgCreateArrayRelationshipArgs{
+				Table:  table,
+				Name:   rel.Name,
+				Source: rec.source,
+				Using:  rel.Using.(metadata.ArrRelUsing),
+			}))
+			continue
+		}
+
+		rec.objectRels = append(rec.objectRels, metadata.PgCreateObjectRelationshipQuery(&metadata.PgCreateObjectRelationshipArgs{
+			Table:  table,
+			Name:   rel.Name,
+			Source: rec.source,
+			Using:  rel.Using.(metadata.ObjRelUsing),
+		}))
+	}
+
+	if !rec.prune {
+		return
+	}
+
+	for _, rel := range current {
+		if findRelationship(desired, rel.Name) == nil {
+			rec.dropRelationship(table, rel.Name, "is not produced by the ent schema")
+		}
+	}
+}
+
+// dropRelationship drops the relationship, unless a permission not managed by the ent schema uses
+// it: the engine refuses to drop a relationship used by a permission, and only the permissions of
+// the ent schema can be dropped and created again around it.
+func (rec *reconciler) dropRelationship(table metadata.QualifiedTableName, name, reason string) bool {
+	if dependents := rec.unmanagedDependents(name); len(dependents) > 0 {
+		logrus.Warnf("relationship %s of %s.%s %s, it is left unchanged since it is used by the %s",
+			name, table.Schema, table.Name, reason, strings.Join(dependents, ", "))
+		return false
+	}
+
+	rec.dropRels = append(rec.dropRels, metadata.PgDropRelationshipQuery(&metadata.PgDropRelationshipArgs{
+		Table:        table,
+		Relationship: name,
+		Source:       rec.source,
+	}))
+
+	rec.droppedRels = append(rec.droppedRels, name)
+
+	return true
+}
+
+// unmanagedDependents describes the permissions using the relationship that are not part of the
+// desired source, i.e. of tables not owned by ent or of roles not declared in the ent schema.
+func (rec *reconciler) unmanagedDependents(name string) []string {
+	dependents := []string{}
+
+	for _, table := range rec.current.Tables {
+		owned := rec.desired.table(table.Table.Schema, table.Table.Name) != nil
+
+		for _, kind := range permissionKinds {
+			for _, perm := range table.permissions(kind) {
+				if owned && elementInArray(rec.roles, perm.Role) {
+					continue
+				}
+
+				if usesRelationship(perm.Permission, name) {
+					dependents = append(dependents, fmt.Sprintf("%s permission of role %s on %s.%s",
+						permissionKindName(kind), perm.Role, table.Table.Schema, table.Table.Name))
+				}
+			}
+		}
+	}
+
+	return dependents
+}
+
+// recreateDependentPermissions drops the unchanged permissions using a dropped relationship before
+// it, and creates them again once the relationships are created.
+func (rec *reconciler) recreateDependentPermissions() {
+	if len(rec.droppedRels) == 0 {
+		return
+	}
+
+	for _, table := range rec.desired.Tables {
+		current := rec.current.table(table.Table.Schema, table.Table.Name)
+		if current == nil {
+			continue
+		}
+
+		for _, kind := range permissionKinds {
+			for _, perm := range table.permissions(kind) {
+				existing := findRolePermission(current.permissions(kind), perm.Role)
+				if existing == nil || rec.replaced[permissionKey(table.Table, kind, perm.Role)] {
+					continue
+				}
+
+				for _, rel := range rec.droppedRels {
+					if usesRelationship(existing.Permission, rel) {
+						rec.dropPerms = append(rec.dropPerms, dropPermissionQuery(kind, table.Table, perm.Role, rec.source))
+						rec.createPermission(kind, table.Table, perm)
+						break
+					}
+				}
+			}
+		}
+	}
+}
+
+func (rec *reconciler) reconcilePermissions(table metadata.QualifiedTableName, kind metadata.MetadataRequestType, current, desired []*RolePermission) {
+	for _, perm := range desired {
+		existing := findRolePermission(current, perm.Role)
+		if existing != nil && sameJSON(existing.Permission, perm.Permission) {
+			continue
+		}
+
+		rec.replaced[permissionKey(table, kind, perm.Role)] = true
+
+		if existing != nil {
+			rec.dropPerms = append(rec.dropPerms, dropPermissionQuery(kind, table, perm.Role, rec.source))
+		}
+
+		rec.createPermission(kind, table, perm)
+	}
+
+	for _, perm := range current {
+		if elementInArray(rec.roles, perm.Role) && findRolePermission(desired, perm.Role) == nil {
+			rec.dropPerms = append(rec.dropPerms, dropPermissionQuery(kind, table, perm.Role, rec.source))
+		}
+	}
+}
+
+func (rec *reconciler) createPermission(kind metadata.MetadataRequestType, table metadata.QualifiedTableName, perm *RolePermission) {
+	switch kind {
+	case metadata.PgCreateInsertPermission:
+		rec.insertPerms = append(rec.insertPerms, pgCreateInsertPermission(perm.Permission, table.Name, perm.Role, rec.source, table.Schema))
+	case metadata.PgCreateSelectPermission:
+		rec.selectPerms = append(rec.selectPerms, pgCreateSelectPermission(perm.Permission, table.Name, perm.Role, rec.source, table.Schema))
+	case metadata.PgCreateUpdatePermission:
+		rec.updatePerms = append(rec.updatePerms, pgCreateUpdatePermission(perm.Permission, table.Name, perm.Role, rec.source, table.Schema))
+	case metadata.PgCreateDeletePermission:
+		rec.deletePerms = append(rec.deletePerms, pgCreateDeletePermission(perm.Permission, table.Name, perm.Role, rec.source, table.Schema))
+	}
+}
+
+func dropPermissionQuery(kind metadata.MetadataRequestType, table metadata.QualifiedTableName, role, sourceName string) metadata.MetadataQuery {
+	switch kind {
+	case metadata.PgCreateInsertPermission:
+		return metadata.PgDropInsertPermissionQuery(&metadata.PgDropInsertPermissionArgs{Table: table, Role: role, Source: sourceName})
+	case metadata.PgCreateSelectPermission:
+		return metadata.PgDropSelectPermissionQuery(&metadata.PgDropSelectPermissionArgs{Table: table, Role: role, Source: sourceName})
+	case metadata.PgCreateUpdatePermission:
+		return metadata.PgDropUpdatePermissionQuery(&metadata.PgDropUpdatePermissionArgs{Table: table, Role: role, Source: sourceName})
+	default:
+		return metadata.PgDropDeletePermissionQuery(&metadata.PgDropDeletePermissionArgs{Table: table, Role: role, Source: sourceName})
+	}
+}
+
+func findRelationship(rels []*Relationship, name string) *Relationship {
+	for _, rel := range rels {
+		if rel.Name == name {
+			return rel
+		}
+	}
+
+	return nil
+}
+
+func findRolePermission(perms []*RolePermission, role string) *RolePermission {
+	for _, perm := range perms {
+		if perm.Role == role {
+			return perm
+		}
+	}
+
+	return nil
+}
+
+var permissionKinds = []metadata.MetadataRequestType{
+	metadata.PgCreateInsertPermission,
+	metadata.PgCreateSelectPermission,
+	metadata.PgCreateUpdatePermission,
+	metadata.PgCreateDeletePermission,
+}
+
+// permissions returns the permissions of the table created by the kind of query.
+func (t *Table) permissions(kind metadata.MetadataRequestType) []*RolePermission {
+	switch kind {
+	case metadata.PgCreateInsertPermission:
+		return t.InsertPermissions
+	case metadata.PgCreateSelectPermission:
+		return t.SelectPermissions
+	case metadata.PgCreateUpdatePermission:
+		return t.UpdatePermissions
+	}
+
+	return t.DeletePermissions
+}
+
+func permissionKey(table metadata.QualifiedTableName, kind metadata.MetadataRequestType, role string) string {
+	return fmt.Sprintf("%s.%s %s %s", table.Schema, table.Name, kind, role)
+}
+
+// permissionKindName returns "insert", "select", "update" or "delete".
+func permissionKindName(kind metadata.MetadataRequestType) string {
+	return strings.TrimSuffix(strings.TrimPrefix(string(kind), "pg_create_"), "_permission")
+}
+
+// usesRelationship reports if the filter or the check of the permission goes through a relationship
+// with the given name. The tables of the relationships are not followed, so a relationship of
+// another table with the same name also counts.
+func usesRelationship(perm map[string]interface{}, name string) bool {
+	for _, key := range []string{"filter", "check"} {
+		expression, err := normalizeJSON(perm[key])
+		if err == nil && expressionUses(expression, name) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func expressionUses(expression interface{}, name string) bool {
+	switch exp := expression.(type) {
+	case map[string]interface{}:
+		for key, value := range exp {
+			if key == name || expressionUses(value, name) {
+				return true
+			}
+		}
+	case []interface{}:
+		for _, value := range exp {
+			if expressionUses(value, name) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// sameRelationship reports whether two using clauses join the same columns, whatever their form: a
+// foreign key column alone, in an object or in a list, or a table given by name or qualified.
+func sameRelationship(a, b interface{}) bool {
+	left, err := normalizeJSON(a)
+	if err != nil {
+		return false
+	}
+
+	right, err := normalizeJSON(b)
+	if err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(canonicalUsing(left), canonicalUsing(right))
+}
+
+func canonicalUsing(using interface{}) interface{} {
+	u, isOk := using.(map[string]interface{})
+	if !isOk {
+		return using
+	}
+
+	canonical := map[string]interface{}{}
+
+	for key, value := range u {
+		switch key {
+		case "foreign_key_constraint_on":
+			value = canonicalForeignKey(value)
+		case "manual_configuration":
+			value = canonicalManualConfiguration(value)
+		}
+
+		canonical[key] = value
+	}
+
+	return canonical
+}
+
+func canonicalForeignKey(fk interface{}) interface{} {
+	switch v := fk.(type) {
+	case string:
+		return map[string]interface{}{"columns": []interface{}{v}}
+	case map[string]interface{}:
+		canonical := map[string]interface{}{}
+
+		for key, value := range v {
+			switch key {
+			case "column":
+				canonical["columns"] = []interface{}{value}
+			case "table":
+				canonical["table"] = canonicalTableName(value)
+			default:
+				canonical[key] = value
+			}
+		}
+
+		return canonical
+	}
+
+	return fk
+}
+
+func canonicalManualConfiguration(config interface{}) interface{} {
+	c, isOk := config.(map[string]interface{})
+	if !isOk {
+		return config
+	}
+
+	canonical := map[string]interface{}{}
+
+	for key, value := range c {
+		switch {
+		case key == "remote_table":
+			canonical[key] = canonicalTableName(value)
+		case value != nil:
+			canonical[key] = value
+		}
+	}
+
+	return canonical
+}
+
+// canonicalTableName returns the table as a schema qualified name.
+func canonicalTableName(table interface{}) interface{} {
+	if name, isOk := table.(string); isOk {
+		return map[string]interface{}{"schema": "public", "name": name}
+	}
+
+	return table
+}
+
+// sameTableConfiguration reports whether two table configurations give the same names, whatever
+// the way the engine exports them: custom_column_names and column_config are merged, and empty
+// root fields and names, or names equal to their column, are left out.
+func sameTableConfiguration(a, b interface{}) bool {
+	left, err := normalizeJSON(a)
+	if err != nil {
+		return false
+	}
+
+	right, err := normalizeJSON(b)
+	if err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(canonicalTableConfiguration(left), canonicalTableConfiguration(right))
+}
+
+func canonicalTableConfiguration(configuration interface{}) interface{} {
+	c, isOk := configuration.(map[string]interface{})
+	if !isOk {
+		return map[string]interface{}{}
+	}
+
+	canonical := map[string]interface{}{}
+	columns := map[string]map[string]interface{}{}
+
+	column := func(name string) map[string]interface{} {
+		if columns[name] == nil {
+			columns[name] = map[string]interface{}{}
+		}
+
+		return columns[name]
+	}
+
+	// the column config wins over the custom column names, like it does in the engine
+	names, _ := c["custom_column_names"].(map[string]interface{})
+	for name, customName := range names {
+		if customName != nil && customName != name {
+			column(name)["custom_name"] = customName
+		}
+	}
+
+	configs, _ := c["column_config"].(map[string]interface{})
+	for name, config := range configs {
+		fields, _ := config.(map[string]interface{})
+		for field, value := range fields {
+			switch {
+			case value == nil || value == "":
+			case field == "custom_name" && value == name:
+				delete(column(name), field)
+			default:
+				column(name)[field] = value
+			}
+		}
+	}
+
+	for key, value := range c {
+		switch key {
+		case "custom_column_names", "column_config":
+		case "custom_root_fields":
+			if fields := canonicalRootFields(value); len(fields) > 0 {
+				canonical[key] = fields
+			}
+		default:
+			if value != nil && value != "" {
+				canonical[key] = value
+			}
+		}
+	}
+
+	columnConfig := map[string]interface{}{}
+	for name, config := range columns {
+		if len(config) > 0 {
+			columnConfig[name] = config
+		}
+	}
+
+	if len(columnConfig) > 0 {
+		canonical["column_config"] = columnConfig
+	}
+
+	return canonical
+}
+
+// canonicalRootFields returns the root fields that are set.
+func canonicalRootFields(rootFields interface{}) map[string]interface{} {
+	fields, _ := rootFields.(map[string]interface{})
+	canonical := map[string]interface{}{}
+
+	for key, value := range fields {
+		if value != nil && value != "" {
+			canonical[key] = value
+		}
+	}
+
+	return canonical
+}
+
+// sameJSON reports whether a and b have the same JSON representation, regardless of their Go types.
+func sameJSON(a, b interface{}) bool {
+	left, err := normalizeJSON(a)
+	if err != nil {
+		return false
+	}
+
+	right, err := normalizeJSON(b)
+	if err != nil {
+		return false
+	}
+
+	return reflect.DeepEqual(left, right)
+}
+
+func normalizeJSON(value interface{}) (interface{}, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var normalized interface{}
+	if err := json.Unmarshal(data, &normalized); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return normalized, nil
+}
@@ -0,0 +1,377 @@
+package enthasura_test
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"entgo.io/ent"
+	"entgo.io/ent/entc/gen"
+	enthasura "github.com/minskylab/ent-hasura"
+	basic "github.com/minskylab/ent-hasura/example/basic/ent/schema"
+	"github.com/minskylab/ent-hasura/hasuratest"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+)
+
+func basicGraph(t *testing.T) *gen.Graph {
+	return loadGraph(t, []ent.Interface{basic.User{}, basic.Note{}, basic.Like{}}...)
+}
+
+// appliedRuntime returns a runtime whose fake engine has the metadata of the graph applied.
+func appliedRuntime(t *testing.T, graph *gen.Graph) (*enthasura.Runtime, *hasuratest.MetadataClient) {
+	t.Helper()
+
+	client := hasuratest.NewMetadataClient()
+	run := enthasura.NewRuntimeWithClient(client)
+
+	if err := run.PerformIncrementalGraphTransform(graph, "default", "public", false); err != nil {
+		t.Fatalf("applying the metadata: %+v", err)
+	}
+
+	return run, client
+}
+
+// editMetadata replaces the metadata of the fake engine with an edited copy of its export.
+func editMetadata(t *testing.T, run *enthasura.Runtime, client *hasuratest.MetadataClient, edit func(source *enthasura.Source)) {
+	t.Helper()
+
+	exported, err := client.ExportMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edit(exported.Metadata.Sources[0])
+
+	if err := run.ReplaceMetadata(exported.Metadata); err != nil {
+		t.Fatalf("replacing the metadata: %+v", err)
+	}
+}
+
+func planQueries(t *testing.T, run *enthasura.Runtime, graph *gen.Graph, prune bool) []metadata.MetadataQuery {
+	t.Helper()
+
+	plan, err := run.PlanIncrementalGraphTransform(graph, "default", "public", prune)
+	if err != nil {
+		t.Fatalf("planning: %+v", err)
+	}
+
+	queries := []metadata.MetadataQuery{}
+	for _, phase := range plan.Phases {
+		queries = append(queries, phase.Queries...)
+	}
+
+	return queries
+}
+
+func findTable(t *testing.T, source *enthasura.Source, name string) *enthasura.Table {
+	t.Helper()
+
+	for _, table := range source.Tables {
+		if table.Table.Name == name {
+			return table
+		}
+	}
+
+	t.Fatalf("table %s is not tracked", name)
+
+	return nil
+}
+
+func relationship(t *testing.T, rels []*enthasura.Relationship, name string) *enthasura.Relationship {
+	t.Helper()
+
+	for _, rel := range rels {
+		if rel.Name == name {
+			return rel
+		}
+	}
+
+	t.Fatalf("relationship %s not found", name)
+
+	return nil
+}
+
+// describeQueries returns the type and the relationship or role of every query.
+func describeQueries(t *testing.T, queries []metadata.MetadataQuery) []string {
+	t.Helper()
+
+	described := []string{}
+
+	for _, query := range queries {
+		data, err := json.Marshal(query.Args)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		args := struct {
+			Table struct {
+				Schema string `json:"schema"`
+				Name   string `json:"name"`
+			} `json:"table"`
+			Name         string `json:"name"`
+			Relationship string `json:"relationship"`
+			Role         string `json:"role"`
+		}{}
+
+		if err := json.Unmarshal(data, &args); err != nil {
+			t.Fatal(err)
+		}
+
+		described = append(described, string(query.Type)+" "+args.Table.Schema+"."+args.Table.Name+" "+args.Name+args.Relationship+args.Role)
+	}
+
+	return described
+}
+
+func TestIncrementalTransformIsIdempotent(t *testing.T) {
+	graph := basicGraph(t)
+	run, client := appliedRuntime(t, graph)
+
+	applied := len(client.Queries())
+	if applied == 0 {
+		t.Fatal("nothing applied to an empty engine")
+	}
+
+	if queries := planQueries(t, run, graph, true); len(queries) != 0 {
+		t.Fatalf("second plan is not empty: %v", describeQueries(t, queries))
+	}
+
+	if err := run.PerformIncrementalGraphTransform(graph, "default", "public", true); err != nil {
+		t.Fatalf("applying twice: %+v", err)
+	}
+
+	if len(client.Queries()) != applied {
+		t.Errorf("second apply sent %d queries", len(client.Queries())-applied)
+	}
+
+	want, err := enthasura.BuildMetadata(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := client.ExportMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range want.Sources[0].Tables {
+		got := findTable(t, exported.Metadata.Sources[0], table.Table.Name)
+		assertSameJSON(t, got, table)
+	}
+}
+
+func TestIncrementalPlanIgnoresRelationshipShape(t *testing.T) {
+	graph := basicGraph(t)
+	run, client := appliedRuntime(t, graph)
+
+	editMetadata(t, run, client, func(source *enthasura.Source) {
+		// the forms of the engine export, a column in an object and a table by name
+		creator := relationship(t, findTable(t, source, "likes").ObjectRelationships, "creator")
+		creator.Using = map[string]interface{}{"foreign_key_constraint_on": map[string]interface{}{"column": "user_likes"}}
+
+		authors := relationship(t, findTable(t, source, "notes").ArrayRelationships, "authors")
+		authors.Using = map[string]interface{}{
+			"foreign_key_constraint_on": map[string]interface{}{"table": "user_notes", "columns": []interface{}{"note_id"}},
+		}
+	})
+
+	if queries := planQueries(t, run, graph, false); len(queries) != 0 {
+		t.Fatalf("plan replaces relationships of another shape: %v", describeQueries(t, queries))
+	}
+}
+
+func TestIncrementalPlanIgnoresConfigurationShape(t *testing.T) {
+	graph := basicGraph(t)
+	run, client := appliedRuntime(t, graph)
+
+	// the engine exports the custom names in both column_config and custom_column_names, and
+	// leaves out the names equal to their column
+	editMetadata(t, run, client, func(source *enthasura.Source) {
+		for _, table := range source.Tables {
+			config := table.Configuration
+			config.ColumnConfig = map[string]*enthasura.ColumnConfig{}
+
+			for column, name := range config.CustomColumnNames {
+				if name == column {
+					delete(config.CustomColumnNames, column)
+					continue
+				}
+
+				config.ColumnConfig[column] = &enthasura.ColumnConfig{CustomName: name}
+			}
+		}
+	})
+
+	if queries := planQueries(t, run, graph, false); len(queries) != 0 {
+		t.Fatalf("plan customizes tables exported in the engine shape: %v", describeQueries(t, queries))
+	}
+
+	editMetadata(t, run, client, func(source *enthasura.Source) {
+		findTable(t, source, "likes").Configuration.ColumnConfig["created_at"].CustomName = "likedAt"
+	})
+
+	got := describeQueries(t, planQueries(t, run, graph, false))
+	assertSameJSON(t, got, []string{`pg_set_table_customization public.likes `})
+}
+
+func TestIncrementalTransformChecksConsistencyWhenUpToDate(t *testing.T) {
+	graph := basicGraph(t)
+	run, client := appliedRuntime(t, graph)
+
+	client.SetInconsistentObjects(&enthasura.InconsistentObject{
+		Type:       "array_relation",
+		Reason:     "no foreign key constraint",
+		Definition: json.RawMessage(`{"table": {"schema": "public", "name": "notes"}, "name": "authors"}`),
+	})
+
+	err := run.PerformIncrementalGraphTransform(graph, "default", "public", false)
+
+	inconsistentErr := &enthasura.InconsistentMetadataError{}
+	if !errors.As(err, &inconsistentErr) {
+		t.Fatalf("expected an inconsistent metadata error without anything to apply, got %+v", err)
+	}
+}
+
+func TestIncrementalTransformRecreatesDependentPermissions(t *testing.T) {
+	graph := basicGraph(t)
+	run, client := appliedRuntime(t, graph)
+
+	// the select and update permissions of notes go through authors
+	res, err := client.Bulk([]metadata.MetadataQuery{metadata.PgDropRelationshipQuery(&metadata.PgDropRelationshipArgs{
+		Table:        metadata.QualifiedTableName{Schema: "public", Name: "notes"},
+		Relationship: "authors",
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errRes, isOk := res.(enthasura.ErrorResponse); !isOk || errRes.Code != "dependency-error" {
+		t.Fatalf("dropping a relationship used by a permission: got %#v, want a dependency-error", res)
+	}
+
+	editMetadata(t, run, client, func(source *enthasura.Source) {
+		authors := relationship(t, findTable(t, source, "notes").ArrayRelationships, "authors")
+		authors.Using = map[string]interface{}{
+			"foreign_key_constraint_on": map[string]interface{}{"table": "user_notes", "column": "previous_note_id"},
+		}
+	})
+
+	got := describeQueries(t, planQueries(t, run, graph, false))
+	want := []string{
+		`pg_drop_select_permission public.notes user`,
+		`pg_drop_update_permission public.notes user`,
+		`pg_drop_relationship public.notes authors`,
+		`pg_create_array_relationship public.notes authors`,
+		`pg_create_select_permission public.notes user`,
+		`pg_create_update_permission public.notes user`,
+	}
+
+	assertSameJSON(t, got, want)
+
+	if err := run.PerformIncrementalGraphTransform(graph, "default", "public", false); err != nil {
+		t.Fatalf("applying the plan: %+v", err)
+	}
+
+	if queries := planQueries(t, run, graph, false); len(queries) != 0 {
+		t.Fatalf("plan not empty once applied: %v", describeQueries(t, queries))
+	}
+}
+
+func TestIncrementalTransformKeepsRelationshipsOfOtherRoles(t *testing.T) {
+	graph := basicGraph(t)
+	run, client := appliedRuntime(t, graph)
+
+	editMetadata(t, run, client, func(source *enthasura.Source) {
+		notes := findTable(t, source, "notes")
+
+		authors := relationship(t, notes.ArrayRelationships, "authors")
+		authors.Using = map[string]interface{}{
+			"foreign_key_constraint_on": map[string]interface{}{"table": "user_notes", "column": "previous_note_id"},
+		}
+
+		notes.SelectPermissions = append(notes.SelectPermissions, &enthasura.RolePermission{
+			Role: "auditor",
+			Permission: map[string]interface{}{
+				"columns": []interface{}{"id"},
+				"filter":  map[string]interface{}{"authors": map[string]interface{}{"user_id": map[string]interface{}{"_is_null": false}}},
+			},
+		})
+	})
+
+	if queries := planQueries(t, run, graph, false); len(queries) != 0 {
+		t.Fatalf("plan drops a relationship used by a hand-made permission: %v", describeQueries(t, queries))
+	}
+}
+
+func TestIncrementalTransformPrune(t *testing.T) {
+	graph := basicGraph(t)
+	run, client := appliedRuntime(t, graph)
+
+	editMetadata(t, run, client, func(source *enthasura.Source) {
+		users := findTable(t, source, "users")
+
+		for _, name := range []string{"hand_likes", "audited_likes"} {
+			users.ArrayRelationships = append(users.ArrayRelationships, &enthasura.Relationship{
+				Name: name,
+				Using: map[string]interface{}{
+					"foreign_key_constraint_on": map[string]interface{}{"table": map[string]interface{}{"schema": "public", "name": "likes"}, "column": "user_likes"},
+				},
+			})
+		}
+
+		users.SelectPermissions = append(users.SelectPermissions, &enthasura.RolePermission{
+			Role: "auditor",
+			Permission: map[string]interface{}{
+				"columns": []interface{}{"id"},
+				"filter":  map[string]interface{}{"audited_likes": map[string]interface{}{}},
+			},
+		})
+	})
+
+	if queries := planQueries(t, run, graph, false); len(queries) != 0 {
+		t.Fatalf("plan without prune is not empty: %v", describeQueries(t, queries))
+	}
+
+	got := describeQueries(t, planQueries(t, run, graph, true))
+	assertSameJSON(t, got, []string{`pg_drop_relationship public.users hand_likes`})
+
+	if err := run.PerformIncrementalGraphTransform(graph, "default", "public", true); err != nil {
+		t.Fatalf("applying the pruning plan: %+v", err)
+	}
+
+	users := client.Table("default", "public", "users")
+	if users == nil {
+		t.Fatal("users is not tracked")
+	}
+
+	relationship(t, users.ArrayRelationships, "audited_likes")
+
+	for _, rel := range users.ArrayRelationships {
+		if rel.Name == "hand_likes" {
+			t.Error("hand_likes not pruned")
+		}
+	}
+}
+
+func assertSameJSON(t *testing.T, got, want interface{}) {
+	t.Helper()
+
+	gotData, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantData, err := json.Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var gotValue, wantValue interface{}
+	_ = json.Unmarshal(gotData, &gotValue)
+	_ = json.Unmarshal(wantData, &wantValue)
+
+	if !reflect.DeepEqual(gotValue, wantValue) {
+		t.Errorf("got:\n%s\nwant:\n%s", gotData, wantData)
+	}
+}
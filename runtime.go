@@ -1,23 +1,85 @@
 package enthasura
 
 import (
+	"strings"
+
 	hasura_api "github.com/minskylab/hasura-api"
 	"github.com/pkg/errors"
 )
 
+// SoftAllPhases makes every phase soft when passed to SetSoftPhases.
+const SoftAllPhases = "all"
+
+// defaultSoftPhases are the phases whose errors are only logged by default, untracking a table that
+// is not tracked yet fails on the first apply.
+var defaultSoftPhases = []string{"untrack tables"}
+
 type Runtime struct {
-	hasura *hasura_api.HasuraClient
+	hasura        MetadataClient
+	softPhases    []string
+	naming        NamingStrategy
+	actions       []*Action
+	inconsistency InconsistencyPolicy
 }
 
+// NewRuntime returns a runtime applying the metadata to the Hasura engine configured by the options.
 func NewRuntime(options ...hasura_api.HasuraClientOption) (*Runtime, error) {
-	client, err := hasura_api.NewHasuraClient(options...)
+	client, err := NewHasuraMetadataClient(options...)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
+	return NewRuntimeWithClient(client), nil
+}
+
+// NewRuntimeWithClient returns a runtime applying the metadata through the given client.
+func NewRuntimeWithClient(client MetadataClient) *Runtime {
 	return &Runtime{
-		hasura: client,
-	}, nil
+		hasura:        client,
+		softPhases:    defaultSoftPhases,
+		naming:        NewDefaultNaming(DefaultConfig),
+		inconsistency: InconsistencyFail,
+	}
+}
+
+// SetActions sets the actions registered by every apply.
+func (r *Runtime) SetActions(actions ...*Action) {
+	r.actions = actions
+}
+
+// SetNamingStrategy sets how tables, columns and relationships are named in the GraphQL schema.
+func (r *Runtime) SetNamingStrategy(naming NamingStrategy) {
+	r.naming = namingOrDefault(naming)
+}
+
+// SetInconsistencyPolicy sets what the transforms do when objects they produced are inconsistent
+// once applied, InconsistencyFail by default.
+func (r *Runtime) SetInconsistencyPolicy(policy InconsistencyPolicy) {
+	r.inconsistency = policy
+}
+
+// SetSoftPhases sets the phases (e.g. "select permissions" or "select-permissions") whose errors are
+// only logged instead of failing the apply. SoftAllPhases makes every phase soft.
+func (r *Runtime) SetSoftPhases(phases ...string) {
+	r.softPhases = []string{}
+
+	for _, phase := range phases {
+		r.softPhases = append(r.softPhases, normalizePhaseName(phase))
+	}
+}
+
+func (r *Runtime) isSoftPhase(phase string) bool {
+	for _, soft := range r.softPhases {
+		if soft == SoftAllPhases || normalizePhaseName(soft) == normalizePhaseName(phase) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func normalizePhaseName(phase string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(phase), "-", " "))
 }
 
 // type EphemeralRuntime struct {
@@ -0,0 +1,323 @@
+package enthasura_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	enthasura "github.com/minskylab/ent-hasura"
+	"github.com/minskylab/ent-hasura/hasuratest"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+)
+
+// renderTables renders the tables of the first source like the golden files, without the rest of
+// the document which differs between built and exported metadata. The keys are sorted, decoded
+// relationships are maps where built ones are structs.
+func renderTables(t *testing.T, m *enthasura.Metadata) []byte {
+	t.Helper()
+
+	rendered := renderMetadata(t, &enthasura.Metadata{
+		Version: 3,
+		Sources: []*enthasura.Source{{Name: "default", Kind: "postgres", Tables: m.Sources[0].Tables}},
+	})
+
+	var doc interface{}
+	if err := json.Unmarshal(rendered, &doc); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return data
+}
+
+func TestFullTransform(t *testing.T) {
+	graph := basicGraph(t)
+
+	client := hasuratest.NewMetadataClient()
+	run := enthasura.NewRuntimeWithClient(client)
+
+	// twice, the untrack tables phase fails on the empty engine and is soft by default
+	for i := 0; i < 2; i++ {
+		if err := run.PerformFullGraphTransform(graph, "default", "public"); err != nil {
+			t.Fatalf("applying the metadata, run %d: %+v", i+1, err)
+		}
+	}
+
+	built, err := enthasura.BuildMetadata(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	exported, err := client.ExportMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, want := renderTables(t, exported.Metadata), renderTables(t, built); !bytes.Equal(got, want) {
+		t.Errorf("applied metadata differs from BuildMetadata\ngot:\n%s\nwant:\n%s", got, want)
+	}
+
+	if queries := planQueries(t, run, graph, true); len(queries) != 0 {
+		t.Errorf("incremental plan after a full transform: %v", describeQueries(t, queries))
+	}
+}
+
+func TestSoftPhases(t *testing.T) {
+	graph := basicGraph(t)
+
+	client := hasuratest.NewMetadataClient()
+	run := enthasura.NewRuntimeWithClient(client)
+	run.SetSoftPhases()
+
+	err := run.PerformFullGraphTransform(graph, "default", "public")
+
+	badRequest := &enthasura.BadRequestError{}
+	if !errors.As(err, &badRequest) {
+		t.Fatalf("expected a bad request error, got %+v", err)
+	}
+
+	if badRequest.Phase != "untrack tables" || badRequest.Code != "already-untracked" {
+		t.Errorf("got %s error at %s, want already-untracked at untrack tables", badRequest.Code, badRequest.Phase)
+	}
+
+	if len(client.Queries()) != 0 {
+		t.Errorf("the failing bulk must not be applied, got %d queries", len(client.Queries()))
+	}
+
+	run.SetSoftPhases("untrack-tables")
+
+	if err := run.PerformFullGraphTransform(graph, "default", "public"); err != nil {
+		t.Fatalf("applying with a soft untrack tables phase: %+v", err)
+	}
+}
+
+func TestErrorPathMapping(t *testing.T) {
+	graph := basicGraph(t)
+
+	queries, err := enthasura.BuildQueries(graph)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	untracks := []metadata.MetadataQuery{}
+	for _, query := range queries {
+		if query.Type == metadata.PgUntrackTable {
+			untracks = append(untracks, query)
+		}
+	}
+
+	if len(untracks) < 2 {
+		t.Fatalf("expected several untrack queries, got %d", len(untracks))
+	}
+
+	// only the first table is tracked, the untrack bulk fails at its second query
+	first := untrackedTable(t, untracks[0])
+	second := untrackedTable(t, untracks[1])
+
+	client := hasuratest.NewMetadataClient()
+	if _, err := client.Bulk([]metadata.MetadataQuery{{
+		Type: metadata.PgTrackTable,
+		Args: map[string]interface{}{"source": "default", "table": map[string]string{"schema": "public", "name": first}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	run := enthasura.NewRuntimeWithClient(client)
+	run.SetSoftPhases()
+
+	err = run.PerformFullGraphTransform(graph, "default", "public")
+
+	badRequest := &enthasura.BadRequestError{}
+	if !errors.As(err, &badRequest) {
+		t.Fatalf("expected a bad request error, got %+v", err)
+	}
+
+	if badRequest.Path != "$.args[1].args" {
+		t.Errorf("path: got %s, want $.args[1].args", badRequest.Path)
+	}
+
+	if badRequest.Query == nil || untrackedTable(t, *badRequest.Query) != second {
+		t.Errorf("query: got %+v, want the untrack of %s", badRequest.Query, second)
+	}
+
+	if badRequest.Origin == nil || badRequest.Origin.Node == "" || badRequest.Origin.Operation != "untrack" {
+		t.Errorf("origin: got %s, want the node of %s", badRequest.Origin, second)
+	}
+
+	if client.Table("default", "public", first) == nil {
+		t.Errorf("the failing bulk must leave %s tracked", first)
+	}
+}
+
+func untrackedTable(t *testing.T, query metadata.MetadataQuery) string {
+	t.Helper()
+
+	data, err := json.Marshal(query.Args)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	args := struct {
+		Table struct {
+			Name string `json:"name"`
+		} `json:"table"`
+	}{}
+
+	if err := json.Unmarshal(data, &args); err != nil {
+		t.Fatal(err)
+	}
+
+	return args.Table.Name
+}
+
+func TestInconsistencyPolicies(t *testing.T) {
+	graph := basicGraph(t)
+
+	inconsistentRelationship := &enthasura.InconsistentObject{
+		Type:       "array_relation",
+		Name:       "array_relation authors in table notes",
+		Reason:     "no foreign key constraint",
+		Definition: json.RawMessage(`{"table": {"schema": "public", "name": "notes"}, "name": "authors"}`),
+	}
+
+	unmanagedTable := &enthasura.InconsistentObject{
+		Type:       "table",
+		Name:       "table audit_logs",
+		Reason:     "no such table",
+		Definition: json.RawMessage(`{"schema": "public", "name": "audit_logs"}`),
+	}
+
+	tests := []struct {
+		name           string
+		policy         enthasura.InconsistencyPolicy
+		objects        []*enthasura.InconsistentObject
+		wantErr        bool
+		wantRolledBack bool
+	}{
+		{name: "fail", policy: enthasura.InconsistencyFail, objects: []*enthasura.InconsistentObject{inconsistentRelationship}, wantErr: true},
+		{name: "rollback", policy: enthasura.InconsistencyRollback, objects: []*enthasura.InconsistentObject{inconsistentRelationship}, wantErr: true, wantRolledBack: true},
+		{name: "allow", policy: enthasura.InconsistencyAllow, objects: []*enthasura.InconsistentObject{inconsistentRelationship}},
+		{name: "not from the ent schema", policy: enthasura.InconsistencyFail, objects: []*enthasura.InconsistentObject{unmanagedTable}},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			client := hasuratest.NewMetadataClient()
+			client.SetInconsistentObjects(test.objects...)
+
+			run := enthasura.NewRuntimeWithClient(client)
+			run.SetInconsistencyPolicy(test.policy)
+
+			err := run.PerformFullGraphTransform(graph, "default", "public")
+
+			inconsistentErr := &enthasura.InconsistentMetadataError{}
+			if isInconsistent := errors.As(err, &inconsistentErr); isInconsistent != test.wantErr {
+				t.Fatalf("got error %+v, want an inconsistent metadata error: %t", err, test.wantErr)
+			}
+
+			if !test.wantErr {
+				return
+			}
+
+			if inconsistentErr.RolledBack != test.wantRolledBack {
+				t.Errorf("rolled back: got %t, want %t", inconsistentErr.RolledBack, test.wantRolledBack)
+			}
+
+			origin := inconsistentErr.Objects[0].Origin
+			if origin == nil || origin.Node != "Note" || origin.Edge != "authors" {
+				t.Errorf("origin: got %s, want node Note and edge authors", origin)
+			}
+
+			tracked := client.Table("default", "public", "notes") != nil
+			if tracked == test.wantRolledBack {
+				t.Errorf("notes tracked: got %t after the %s policy", tracked, test.policy)
+			}
+		})
+	}
+}
+
+// exportingClient is the fake engine exporting a raw document set by the test, and recording the
+// documents it is replaced with.
+type exportingClient struct {
+	*hasuratest.MetadataClient
+	raw      json.RawMessage
+	replaced []json.RawMessage
+}
+
+func (c *exportingClient) ExportMetadata() (*enthasura.HasuraMetadata, error) {
+	exported, err := c.MetadataClient.ExportMetadata()
+	if err != nil {
+		return nil, err
+	}
+
+	exported.Raw = c.raw
+
+	return exported, nil
+}
+
+func (c *exportingClient) ReplaceMetadata(m json.RawMessage) (metadata.MetadataResponse, error) {
+	c.replaced = append(c.replaced, m)
+
+	return c.MetadataClient.ReplaceMetadata(m)
+}
+
+func TestRollbackRestoresRawMetadata(t *testing.T) {
+	// parts of a document the Metadata type does not model
+	raw := json.RawMessage(`{"version":3,"sources":[{"name":"default","kind":"postgres","tables":[],` +
+		`"configuration":{},"customization":{"root_fields":{"namespace":"app"}}}],` +
+		`"rest_endpoints":[{"name":"notes","url":"notes","methods":["GET"],"definition":{"query":{"query_name":"notes","collection_name":"allowed-queries"}}}],` +
+		`"network":{"tls_allowlist":[{"host":"hooks.example.com"}]},"api_limits":{"disabled":false}}`)
+
+	inconsistent := &enthasura.InconsistentObject{
+		Type:       "array_relation",
+		Reason:     "no foreign key constraint",
+		Definition: json.RawMessage(`{"table": {"schema": "public", "name": "notes"}, "name": "authors"}`),
+	}
+
+	tests := []struct {
+		name           string
+		raw            json.RawMessage
+		wantRolledBack bool
+	}{
+		{name: "raw document", raw: raw, wantRolledBack: true},
+		{name: "no raw document", raw: nil},
+	}
+
+	for _, test := range tests {
+		client := &exportingClient{MetadataClient: hasuratest.NewMetadataClient(), raw: test.raw}
+		client.SetInconsistentObjects(inconsistent)
+
+		run := enthasura.NewRuntimeWithClient(client)
+		run.SetInconsistencyPolicy(enthasura.InconsistencyRollback)
+
+		err := run.PerformFullGraphTransform(basicGraph(t), "default", "public")
+
+		inconsistentErr := &enthasura.InconsistentMetadataError{}
+		if !errors.As(err, &inconsistentErr) {
+			t.Fatalf("%s: expected an inconsistent metadata error, got %+v", test.name, err)
+		}
+
+		if inconsistentErr.RolledBack != test.wantRolledBack || len(inconsistentErr.Objects) != 1 {
+			t.Errorf("%s: got %s, want rolled back %t", test.name, inconsistentErr, test.wantRolledBack)
+		}
+
+		if !test.wantRolledBack {
+			if len(client.replaced) != 0 {
+				t.Errorf("%s: replaced the metadata without the exported document", test.name)
+			}
+
+			continue
+		}
+
+		if len(client.replaced) != 1 || !bytes.Equal(client.replaced[0], test.raw) {
+			t.Errorf("%s: replaced with %s, want exactly the exported document", test.name, client.replaced)
+		}
+	}
+}
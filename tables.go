@@ -0,0 +1,150 @@
+package enthasura
+
+import (
+	"encoding/json"
+
+	"entgo.io/ent/entc/gen"
+	"entgo.io/ent/schema"
+	"github.com/sirupsen/logrus"
+)
+
+const hasuraTableAnnotationName = "hasura-table"
+
+// TableAnnotation decides how the table of a node is tracked: Skip keeps it out of Hasura and
+// Schema tracks it in another Postgres schema than the one given to the runtime. Join tables follow
+// the node declaring the edge and are skipped with any of their nodes.
+type TableAnnotation struct {
+	Skip   bool   `json:"skip,omitempty"`
+	Schema string `json:"schema,omitempty"`
+}
+
+func (TableAnnotation) Name() string {
+	return hasuraTableAnnotationName
+}
+
+// Merge implements the schema.Merger interface, the values set in other win.
+func (a TableAnnotation) Merge(other schema.Annotation) schema.Annotation {
+	var ann TableAnnotation
+
+	switch other := other.(type) {
+	case TableAnnotation:
+		ann = other
+	case *TableAnnotation:
+		if other == nil {
+			return a
+		}
+		ann = *other
+	default:
+		return a
+	}
+
+	if ann.Schema != "" {
+		a.Schema = ann.Schema
+	}
+
+	a.Skip = a.Skip || ann.Skip
+
+	return a
+}
+
+var (
+	_ schema.Annotation = (*TableAnnotation)(nil)
+	_ schema.Merger     = (*TableAnnotation)(nil)
+)
+
+// SkipTable keeps the table of the node out of Hasura.
+func SkipTable() TableAnnotation {
+	return TableAnnotation{Skip: true}
+}
+
+// TableSchema tracks the table of the node in the given Postgres schema.
+func TableSchema(schemaName string) TableAnnotation {
+	return TableAnnotation{Schema: schemaName}
+}
+
+func tableAnnotationFromNode(node *gen.Type) *TableAnnotation {
+	raw, isOk := node.Annotations[hasuraTableAnnotationName]
+	if !isOk || raw == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(raw)
+	if err != nil {
+		logrus.Warn(err)
+		return nil
+	}
+
+	ann := &TableAnnotation{}
+	if err := json.Unmarshal(data, ann); err != nil {
+		logrus.Warnf("decoding table annotation of %s: %s", node.Name, err)
+		return nil
+	}
+
+	return ann
+}
+
+// tableSchemas holds the Postgres schema of every table of the graph and the skipped ones.
+type tableSchemas struct {
+	defaultSchema string
+	schemas       map[string]string
+	skipped       map[string]bool
+}
+
+func newTableSchemas(graph *gen.Graph, defaultSchema string) *tableSchemas {
+	s := &tableSchemas{
+		defaultSchema: defaultSchema,
+		schemas:       map[string]string{},
+		skipped:       map[string]bool{},
+	}
+
+	if graph == nil {
+		return s
+	}
+
+	for _, node := range graph.Nodes {
+		ann := tableAnnotationFromNode(node)
+		if ann == nil {
+			continue
+		}
+
+		if ann.Schema != "" {
+			s.schemas[node.Table()] = ann.Schema
+		}
+
+		if ann.Skip {
+			s.skipped[node.Table()] = true
+		}
+	}
+
+	for _, node := range graph.Nodes {
+		for _, edge := range node.Edges {
+			if !edge.M2M() || edge.IsInverse() {
+				continue
+			}
+
+			if schemaName, isOk := s.schemas[node.Table()]; isOk {
+				s.schemas[edge.Rel.Table] = schemaName
+			}
+
+			if s.skipped[node.Table()] || s.skipped[edge.Type.Table()] {
+				s.skipped[edge.Rel.Table] = true
+			}
+		}
+	}
+
+	return s
+}
+
+// schema returns the Postgres schema of the table.
+func (s *tableSchemas) schema(table string) string {
+	if schemaName, isOk := s.schemas[table]; isOk {
+		return schemaName
+	}
+
+	return s.defaultSchema
+}
+
+// skip reports whether the table is kept out of Hasura.
+func (s *tableSchemas) skip(table string) bool {
+	return s.skipped[table]
+}
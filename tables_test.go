@@ -0,0 +1,131 @@
+package enthasura_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	enthasura "github.com/minskylab/ent-hasura"
+	"github.com/minskylab/ent-hasura/hasuratest"
+	"github.com/minskylab/ent-hasura/testdata/fixtures/tableannotations"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+)
+
+func TestTableAnnotations(t *testing.T) {
+	m, err := enthasura.BuildMetadata(loadGraph(t, tableannotations.Schemas...))
+	if err != nil {
+		t.Fatalf("building metadata: %+v", err)
+	}
+
+	tables := []string{}
+	for _, table := range m.Sources[0].Tables {
+		tables = append(tables, table.Table.Schema+"."+table.Table.Name)
+	}
+
+	assertSameJSON(t, tables, []string{"public.accounts", "billing.ledgers", "public.tags", "billing.ledger_tags"})
+
+	accounts := findTable(t, m.Sources[0], "accounts")
+	if len(accounts.ArrayRelationships) != 1 || accounts.ArrayRelationships[0].Name != "ledgers" {
+		t.Errorf("relationships of accounts: got %s, want only ledgers", jsonString(t, accounts.ArrayRelationships))
+	}
+
+	ledgers := relationship(t, accounts.ArrayRelationships, "ledgers")
+	if got, want := jsonString(t, ledgers.Using), `{"foreign_key_constraint_on":{"table":{"schema":"billing","name":"ledgers"},"column":"account_ledgers"}}`; got != want {
+		t.Errorf("using of ledgers: got %s, want %s", got, want)
+	}
+}
+
+func TestIncrementalTransformTableAnnotations(t *testing.T) {
+	graph := loadGraph(t, tableannotations.Schemas...)
+
+	// secrets was tracked before it was skipped
+	client := hasuratest.NewMetadataClient()
+	if _, err := client.Bulk([]metadata.MetadataQuery{{
+		Type: metadata.PgTrackTable,
+		Args: map[string]interface{}{"source": "default", "table": map[string]string{"schema": "public", "name": "secrets"}},
+	}}); err != nil {
+		t.Fatal(err)
+	}
+
+	run := enthasura.NewRuntimeWithClient(client)
+
+	got := describeQueries(t, planQueries(t, run, graph, false))
+	if len(got) == 0 || got[0] != "pg_untrack_table public.secrets " {
+		t.Fatalf("plan does not start by untracking the skipped table: %v", got)
+	}
+
+	for _, query := range got[1:] {
+		if query == "pg_track_table public.ledgers " || query == "pg_track_table public.secrets " {
+			t.Errorf("plan tracks %s", query)
+		}
+	}
+
+	if err := run.PerformIncrementalGraphTransform(graph, "default", "public", false); err != nil {
+		t.Fatalf("applying the metadata: %+v", err)
+	}
+
+	for _, table := range []struct{ schema, name string }{
+		{"public", "accounts"}, {"billing", "ledgers"}, {"public", "tags"}, {"billing", "ledger_tags"},
+	} {
+		if client.Table("default", table.schema, table.name) == nil {
+			t.Errorf("%s.%s is not tracked", table.schema, table.name)
+		}
+	}
+
+	for _, table := range []struct{ schema, name string }{
+		{"public", "secrets"}, {"public", "ledgers"}, {"public", "ledger_tags"},
+	} {
+		if client.Table("default", table.schema, table.name) != nil {
+			t.Errorf("%s.%s is tracked", table.schema, table.name)
+		}
+	}
+
+	if queries := planQueries(t, run, graph, true); len(queries) != 0 {
+		t.Fatalf("plan not empty once applied: %v", describeQueries(t, queries))
+	}
+}
+
+func TestInconsistentObjectSchema(t *testing.T) {
+	graph := loadGraph(t, tableannotations.Schemas...)
+
+	tests := []struct {
+		name       string
+		definition string
+		wantNode   string
+	}{
+		{name: "table of another schema", definition: `{"schema": "public", "name": "ledgers"}`},
+		{name: "table of a default schema node in another schema", definition: `{"schema": "other", "name": "accounts"}`},
+		{name: "table in its schema", definition: `{"schema": "billing", "name": "ledgers"}`, wantNode: "Ledger"},
+		{name: "join table in its schema", definition: `{"schema": "billing", "name": "ledger_tags"}`, wantNode: "Ledger"},
+		{name: "table given by name", definition: `"accounts"`, wantNode: "Account"},
+	}
+
+	for _, test := range tests {
+		client := hasuratest.NewMetadataClient()
+		client.SetInconsistentObjects(&enthasura.InconsistentObject{
+			Type:       "table",
+			Reason:     "no such table",
+			Definition: json.RawMessage(test.definition),
+		})
+
+		err := enthasura.NewRuntimeWithClient(client).PerformFullGraphTransform(graph, "default", "public")
+
+		inconsistentErr := &enthasura.InconsistentMetadataError{}
+		isInconsistent := errors.As(err, &inconsistentErr)
+
+		if test.wantNode == "" {
+			if err != nil {
+				t.Errorf("%s: an object not from the ent schema fails the transform: %+v", test.name, err)
+			}
+			continue
+		}
+
+		if !isInconsistent {
+			t.Fatalf("%s: expected an inconsistent metadata error, got %+v", test.name, err)
+		}
+
+		if origin := inconsistentErr.Objects[0].Origin; origin == nil || origin.Node != test.wantNode {
+			t.Errorf("%s: origin: got %s, want node %s", test.name, origin, test.wantNode)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+// Package customids is a fixture of non integer ids: a UUID, a string and a prefixed string id like
+// the ones of pulid, with a join table keyed by both of its columns.
+package customids
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	"github.com/google/uuid"
+	hasura "github.com/minskylab/ent-hasura"
+)
+
+// Schemas are the schemas of the fixture.
+var Schemas = []ent.Interface{Org{}, Member{}, Session{}}
+
+// ID is a prefixed, sortable string id like the ones of pulid.
+type ID string
+
+type Org struct {
+	ent.Schema
+}
+
+func (Org) Fields() []ent.Field {
+	return []ent.Field{
+		field.UUID("id", uuid.UUID{}).Default(uuid.New),
+		field.String("name"),
+	}
+}
+
+func (Org) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("members", Member.Type),
+	}
+}
+
+func (Org) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		hasura.PermissionsRoleAnnotation{
+			Role: "user",
+			SelectPermission: &hasura.SelectPermission{
+				Columns: hasura.AllColumns,
+				Filter:  hasura.Field("members.member.id", hasura.Eq(hasura.XHasuraUserID)),
+			},
+		},
+	}
+}
+
+type Member struct {
+	ent.Schema
+}
+
+func (Member) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("id").NotEmpty().Immutable(),
+		field.String("email"),
+	}
+}
+
+func (Member) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("orgs", Org.Type).Ref("members"),
+		edge.To("sessions", Session.Type),
+	}
+}
+
+func (Member) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		hasura.PermissionsRoleAnnotation{
+			Role: "user",
+			SelectPermission: &hasura.SelectPermission{
+				Columns: hasura.AllColumns,
+				Filter:  hasura.Field("id", hasura.Eq(hasura.XHasuraUserID)),
+			},
+			UpdatePermission: &hasura.UpdatePermission{
+				Columns: hasura.AllColumns,
+				Filter:  hasura.Field("id", hasura.Eq(hasura.XHasuraUserID)),
+			},
+		},
+	}
+}
+
+type Session struct {
+	ent.Schema
+}
+
+func (Session) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("id").GoType(ID("")),
+		field.Time("expires_at"),
+	}
+}
+
+func (Session) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("member", Member.Type).Ref("sessions").Unique(),
+	}
+}
+
+func (Session) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		hasura.PermissionsRoleAnnotation{
+			Role: "user",
+			InsertPermission: &hasura.InsertPermission{
+				Columns: hasura.AllColumns,
+				Check:   hasura.Field("member.id", hasura.Eq(hasura.XHasuraUserID)),
+			},
+			SelectPermission: &hasura.SelectPermission{
+				Columns: hasura.AllColumns,
+				Filter:  hasura.Field("member.id", hasura.Eq(hasura.XHasuraUserID)),
+			},
+		},
+	}
+}
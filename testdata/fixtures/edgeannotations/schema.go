@@ -0,0 +1,93 @@
+// Package edgeannotations is a fixture of the relationship annotations of edges: a renamed
+// relationship, a skipped one, the names of the relationships of a M2M join table and a manual
+// configuration.
+package edgeannotations
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	hasura "github.com/minskylab/ent-hasura"
+)
+
+// Schemas are the schemas of the fixture.
+var Schemas = []ent.Interface{Team{}, Player{}, Score{}, Audit{}}
+
+type Team struct {
+	ent.Schema
+}
+
+func (Team) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name"),
+	}
+}
+
+func (Team) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("players", Player.Type).Annotations(hasura.JoinNames("squad", "member")),
+	}
+}
+
+type Player struct {
+	ent.Schema
+}
+
+func (Player) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("nickname"),
+	}
+}
+
+func (Player) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("teams", Team.Type).Ref("players"),
+		edge.To("scores", Score.Type).Annotations(hasura.RelationshipName("results")),
+		edge.To("audits", Audit.Type).Annotations(hasura.SkipRelationship()),
+	}
+}
+
+func (Player) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		hasura.PermissionsRoleAnnotation{
+			Role: "user",
+			SelectPermission: &hasura.SelectPermission{
+				Columns: hasura.AllColumns,
+				Filter:  hasura.Field("results.points", hasura.Eq(100)),
+			},
+		},
+	}
+}
+
+type Score struct {
+	ent.Schema
+}
+
+func (Score) Fields() []ent.Field {
+	return []ent.Field{
+		field.Int("points"),
+	}
+}
+
+func (Score) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("player", Player.Type).Ref("scores").Unique().Annotations(hasura.ManualRelationship()),
+	}
+}
+
+type Audit struct {
+	ent.Schema
+}
+
+func (Audit) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("action"),
+	}
+}
+
+func (Audit) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("player", Player.Type).Ref("audits").Unique(),
+	}
+}
@@ -0,0 +1,118 @@
+// Package roles is a fixture of nodes with the permissions of several roles.
+package roles
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	hasura "github.com/minskylab/ent-hasura"
+)
+
+// Schemas are the schemas of the fixture.
+var Schemas = []ent.Interface{User{}, Post{}}
+
+type User struct {
+	ent.Schema
+}
+
+func (User) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("email"),
+		field.String("name"),
+		field.String("password").Sensitive(),
+	}
+}
+
+func (User) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("posts", Post.Type),
+	}
+}
+
+func (User) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		hasura.Permissions(
+			hasura.PermissionsRoleAnnotation{
+				Role: "user",
+				SelectPermission: &hasura.SelectPermission{
+					Columns: hasura.AllColumns,
+					Filter:  hasura.Field("id", hasura.Eq(hasura.XHasuraUserID)),
+				},
+				UpdatePermission: &hasura.UpdatePermission{
+					Columns: hasura.Columns("name"),
+					Filter:  hasura.Field("id", hasura.Eq(hasura.XHasuraUserID)),
+				},
+			},
+			hasura.PermissionsRoleAnnotation{
+				Role: "anonymous",
+				SelectPermission: &hasura.SelectPermission{
+					Columns: hasura.Columns("id", "name"),
+					Filter:  hasura.M{},
+				},
+			},
+			hasura.PermissionsRoleAnnotation{
+				Role:           "admin",
+				KeepAllColumns: true,
+				InsertPermission: &hasura.InsertPermission{
+					Columns: hasura.AllColumns,
+					Check:   hasura.M{},
+				},
+				SelectPermission: &hasura.SelectPermission{
+					Columns:           hasura.AllColumns,
+					Filter:            hasura.M{},
+					AllowAggregations: true,
+				},
+				DeletePermission: &hasura.DeletePermission{
+					Filter: hasura.M{},
+				},
+			},
+		),
+	}
+}
+
+type Post struct {
+	ent.Schema
+}
+
+func (Post) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("title"),
+		field.Bool("published").Default(false),
+	}
+}
+
+func (Post) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("author", User.Type).Ref("posts").Unique(),
+	}
+}
+
+func (Post) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		hasura.Permissions(
+			hasura.PermissionsRoleAnnotation{
+				Role: "user",
+				InsertPermission: &hasura.InsertPermission{
+					Columns: hasura.Columns("title", "published"),
+					Check:   hasura.Field("author.id", hasura.Eq(hasura.XHasuraUserID)),
+					Set:     hasura.M{"user_posts": hasura.XHasuraUserID},
+				},
+				SelectPermission: &hasura.SelectPermission{
+					Columns: hasura.AllColumns,
+					Filter: hasura.Or(
+						hasura.Field("published", hasura.Eq(true)),
+						hasura.Field("author.id", hasura.Eq(hasura.XHasuraUserID)),
+					),
+				},
+			},
+			hasura.PermissionsRoleAnnotation{
+				Role: "anonymous",
+				SelectPermission: &hasura.SelectPermission{
+					Columns: hasura.AllColumns,
+					Filter:  hasura.Field("published", hasura.Eq(true)),
+				},
+			},
+		),
+	}
+}
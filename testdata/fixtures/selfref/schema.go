@@ -0,0 +1,47 @@
+// Package selfref is a fixture of self referencing edges: a M2M edge, a O2O edge and a tree on
+// the same type.
+package selfref
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	hasura "github.com/minskylab/ent-hasura"
+)
+
+// Schemas are the schemas of the fixture.
+var Schemas = []ent.Interface{User{}}
+
+type User struct {
+	ent.Schema
+}
+
+func (User) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name"),
+	}
+}
+
+func (User) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("friends", User.Type),
+		edge.To("spouse", User.Type).Unique(),
+		edge.To("children", User.Type).From("parent").Unique(),
+	}
+}
+
+func (User) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		hasura.PermissionsRoleAnnotation{
+			Role: "user",
+			SelectPermission: &hasura.SelectPermission{
+				Columns: hasura.AllColumns,
+				Filter: hasura.Or(
+					hasura.Field("id", hasura.Eq(hasura.XHasuraUserID)),
+					hasura.Field("parent.id", hasura.Eq(hasura.XHasuraUserID)),
+				),
+			},
+		},
+	}
+}
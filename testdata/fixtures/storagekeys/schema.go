@@ -0,0 +1,89 @@
+// Package storagekeys is a fixture of custom storage keys: id column, field columns, edge columns
+// and a join table.
+package storagekeys
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	"github.com/google/uuid"
+	hasura "github.com/minskylab/ent-hasura"
+)
+
+// Schemas are the schemas of the fixture.
+var Schemas = []ent.Interface{Account{}, Team{}, Token{}}
+
+type Account struct {
+	ent.Schema
+}
+
+func (Account) Fields() []ent.Field {
+	return []ent.Field{
+		field.UUID("id", uuid.UUID{}).StorageKey("account_id"),
+		field.String("display_name").StorageKey("name"),
+	}
+}
+
+func (Account) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("teams", Team.Type).StorageKey(edge.Table("memberships"), edge.Columns("member_id", "team_id")),
+		edge.To("tokens", Token.Type).StorageKey(edge.Column("owner_account_id")),
+	}
+}
+
+func (Account) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		hasura.PermissionsRoleAnnotation{
+			Role: "user",
+			SelectPermission: &hasura.SelectPermission{
+				Columns: hasura.AllColumns,
+				Filter:  hasura.Field("account_id", hasura.Eq(hasura.XHasuraUserID)),
+			},
+		},
+	}
+}
+
+type Team struct {
+	ent.Schema
+}
+
+func (Team) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name"),
+	}
+}
+
+func (Team) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("members", Account.Type).Ref("teams"),
+	}
+}
+
+type Token struct {
+	ent.Schema
+}
+
+func (Token) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("value").StorageKey("token").Sensitive(),
+	}
+}
+
+func (Token) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("owner", Account.Type).Ref("tokens").Unique(),
+	}
+}
+
+func (Token) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		hasura.PermissionsRoleAnnotation{
+			Role: "user",
+			SelectPermission: &hasura.SelectPermission{
+				Columns: hasura.AllColumns,
+				Filter:  hasura.Field("owner.account_id", hasura.Eq(hasura.XHasuraUserID)),
+			},
+		},
+	}
+}
@@ -0,0 +1,122 @@
+// Package tableannotations is a fixture of the table annotations of nodes: a table tracked in
+// another Postgres schema with its join table, and a skipped table, both with event triggers.
+package tableannotations
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	hasura "github.com/minskylab/ent-hasura"
+)
+
+// Schemas are the schemas of the fixture.
+var Schemas = []ent.Interface{Account{}, Ledger{}, Tag{}, Secret{}}
+
+type Account struct {
+	ent.Schema
+}
+
+func (Account) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("email"),
+	}
+}
+
+func (Account) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		hasura.EventTriggers(
+			hasura.EventTriggerAnnotation{Trigger: "account_created", Insert: hasura.OnInsert(), Webhook: "http://accounts:8080/created"},
+			hasura.EventTriggerAnnotation{Trigger: "account_deleted", Delete: hasura.OnDelete(), EnableManual: true, Webhook: "http://accounts:8080/deleted"},
+		),
+	}
+}
+
+func (Account) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("ledgers", Ledger.Type),
+		edge.To("secrets", Secret.Type),
+	}
+}
+
+// Ledger is tracked in the billing schema, and so is its ledger_tags join table.
+type Ledger struct {
+	ent.Schema
+}
+
+func (Ledger) Fields() []ent.Field {
+	return []ent.Field{
+		field.Float("balance"),
+	}
+}
+
+func (Ledger) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("account", Account.Type).Ref("ledgers").Unique(),
+		edge.To("tags", Tag.Type),
+	}
+}
+
+func (Ledger) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		hasura.TableSchema("billing"),
+		hasura.EventTriggerAnnotation{
+			Trigger:        "ledger_balance_changed",
+			Update:         hasura.OnUpdate("balance"),
+			WebhookFromEnv: "BILLING_WEBHOOK",
+			RetryConf:      &hasura.RetryConf{NumRetries: 2, TimeoutSec: 30},
+			Headers:        []hasura.EventTriggerHeader{hasura.HeaderFromEnv("Authorization", "BILLING_TOKEN")},
+		},
+		hasura.PermissionsRoleAnnotation{
+			Role: "user",
+			SelectPermission: &hasura.SelectPermission{
+				Columns: hasura.AllColumns,
+				Filter:  hasura.Field("account.id", hasura.Eq(hasura.XHasuraUserID)),
+			},
+		},
+	}
+}
+
+type Tag struct {
+	ent.Schema
+}
+
+func (Tag) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("label"),
+	}
+}
+
+func (Tag) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("ledgers", Ledger.Type).Ref("tags"),
+	}
+}
+
+// Secret is kept out of Hasura, with the relationship of Account to it.
+type Secret struct {
+	ent.Schema
+}
+
+func (Secret) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("value"),
+	}
+}
+
+func (Secret) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("account", Account.Type).Ref("secrets").Unique(),
+	}
+}
+
+func (Secret) Annotations() []schema.Annotation {
+	return []schema.Annotation{
+		hasura.SkipTable(),
+		hasura.EventTriggerAnnotation{
+			Trigger: "secret_created",
+			Insert:  hasura.OnInsert(),
+			Webhook: "http://vault:8200/created",
+		},
+	}
+}
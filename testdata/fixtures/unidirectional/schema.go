@@ -0,0 +1,60 @@
+// Package unidirectional is a fixture of edges without inverse, O2M and M2O: the referenced nodes
+// have no edge back to the user.
+package unidirectional
+
+import (
+	"entgo.io/ent"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+)
+
+// Schemas are the schemas of the fixture.
+var Schemas = []ent.Interface{User{}, Pet{}, Group{}, File{}}
+
+type User struct {
+	ent.Schema
+}
+
+func (User) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name"),
+	}
+}
+
+func (User) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("pets", Pet.Type),
+		edge.To("groups", Group.Type),
+		edge.To("avatar", File.Type).Unique(),
+	}
+}
+
+type Pet struct {
+	ent.Schema
+}
+
+func (Pet) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name"),
+	}
+}
+
+type Group struct {
+	ent.Schema
+}
+
+func (Group) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name"),
+	}
+}
+
+type File struct {
+	ent.Schema
+}
+
+func (File) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("path"),
+	}
+}
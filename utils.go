@@ -16,7 +16,9 @@ func elementInArray(array []string, element string) bool {
 	return false
 }
 
-func logAndResponseMetadataResponse(res metadata.MetadataResponse, soft bool) error {
+// logAndResponseMetadataResponse logs the response of a phase and returns its typed error, if any.
+// In soft mode the error is only logged.
+func logAndResponseMetadataResponse(res metadata.MetadataResponse, phase *PlanPhase, soft bool) error {
 	if res == nil {
 		if soft {
 			return nil
@@ -33,33 +35,14 @@ func logAndResponseMetadataResponse(res metadata.MetadataResponse, soft bool) er
 		}).Debug("metadata response")
 	}
 
-	// switch msg := res.(type) {
-	// case metadata.ObjectResponse, metadata.ArrayResponse:
-	// 	logrus.Debug(msg)
-	// 	return nil
-	// case metadata.MetadataResponses:
-	// 	logrus.Debug(msg)
-	// case metadata.BadRequestResponse:
-	// 	logrus.Error(msg)
-	// 	if soft {
-	// 		return nil
-	// 	}
-	// 	return errors.New(msg.Error)
-	// case metadata.InternalServerErrorResponse:
-	// 	logrus.Error(msg)
-	// 	if soft {
-	// 		return nil
-	// 	}
-	// 	return errors.New(msg.Error)
-	// case metadata.UnauthorizedResponse:
-	// 	logrus.Error(msg)
-	// 	if soft {
-	// 		return nil
-	// 	}
-	// 	return errors.New(msg.Error)
-	// default:
-	// 	logrus.Warn(msg)
-	// }
+	if err := metadataResponseError(res, phase); err != nil {
+		if soft {
+			logrus.Warn(err)
+			return nil
+		}
+
+		return err
+	}
 
 	return nil
 }
@@ -0,0 +1,347 @@
+package enthasura
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"entgo.io/ent/dialect/sql/schema"
+	"entgo.io/ent/entc"
+	"entgo.io/ent/entc/gen"
+	"github.com/minskylab/hasura-api/metadata"
+	"github.com/pkg/errors"
+)
+
+var permissionOperations = []string{"insert_permission", "select_permission", "update_permission", "delete_permission"}
+
+// ValidationError points at a permission of an ent type referencing a column or relationship
+// that the generated metadata does not have.
+type ValidationError struct {
+	Node      string
+	Role      string
+	Operation string
+	Path      string
+	Message   string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("%s (role=%s, %s): %s: %s", e.Node, e.Role, e.Operation, e.Path, e.Message)
+}
+
+// ValidationErrors holds every problem found by ValidateSchema.
+type ValidationErrors []*ValidationError
+
+func (errs ValidationErrors) Error() string {
+	lines := make([]string, 0, len(errs))
+	for _, err := range errs {
+		lines = append(lines, err.Error())
+	}
+
+	return fmt.Sprintf("%d invalid permissions:\n%s", len(errs), strings.Join(lines, "\n"))
+}
+
+// ValidateSchema loads the ent schema and checks that the filters, checks, presets and columns of
+// every permission annotation refer to existing columns and relationships.
+func ValidateSchema(entSchemaPath string, schemaName string, naming NamingStrategy) error {
+	graph, err := entc.LoadGraph(entSchemaPath, &gen.Config{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return validateGraph(graph, schemaName, naming)
+}
+
+// validatedTable is a table as seen by permissions: its schema, Postgres columns, the tables its
+// relationships point to and the columns of the custom GraphQL names, which permissions do not take.
+type validatedTable struct {
+	schema        string
+	columns       map[string]bool
+	relationships map[string]string
+	customNames   map[string]string
+}
+
+type validator struct {
+	tables map[string]*validatedTable
+	errs   ValidationErrors
+}
+
+func validateGraph(graph *gen.Graph, schemaName string, naming NamingStrategy) error {
+	v, err := newValidator(graph, schemaName, naming)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	schemas := newTableSchemas(graph, schemaName)
+
+	for _, node := range graph.Nodes {
+		if schemas.skip(node.Table()) {
+			continue
+		}
+
+		for _, perm := range rolePermissionsFromNode(node, "") {
+			role, _ := perm["role"].(string)
+
+			for _, operation := range permissionOperations {
+				if permission, isOk := perm[operation].(map[string]interface{}); isOk {
+					v.validatePermission(node, role, operation, permission)
+				}
+			}
+		}
+	}
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+
+	return nil
+}
+
+func newValidator(graph *gen.Graph, schemaName string, naming NamingStrategy) (*validator, error) {
+	schemaTables, err := graph.Tables()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	definitions, err := obtainHasuraTablesFromEntSchema(graph, schemaName, naming)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	relational := map[string]*schema.Table{}
+	for _, table := range schemaTables {
+		relational[table.Name] = table
+	}
+
+	v := &validator{tables: map[string]*validatedTable{}}
+
+	for _, def := range definitions {
+		tableName := def.Table.Name
+
+		table := &validatedTable{schema: def.Table.Schema, columns: map[string]bool{}, relationships: map[string]string{}, customNames: map[string]string{}}
+
+		if rt, isOk := relational[tableName]; isOk {
+			for _, column := range rt.Columns {
+				table.columns[column.Name] = true
+			}
+		}
+
+		for column, customName := range def.Configuration.CustomColumnNames {
+			table.customNames[customName] = column
+		}
+
+		for column, config := range def.Configuration.ColumnConfig {
+			if config.CustomName != "" {
+				table.customNames[config.CustomName] = column
+			}
+		}
+
+		for _, rel := range def.ObjectRelationships {
+			using, _ := rel.Using.(metadata.ObjRelUsing)
+
+			switch fk := using.ForeignKeyConstraintOn.(type) {
+			case metadata.SameTable:
+				table.relationships[rel.Name] = referencedTable(relational[tableName], string(fk))
+			case metadata.RemoteTable:
+				table.relationships[rel.Name] = tableNameOf(fk.Table)
+			}
+
+			if using.ManualConfiguration != nil {
+				table.relationships[rel.Name] = tableNameOf(using.ManualConfiguration.RemoteTable)
+			}
+		}
+
+		for _, rel := range def.ArrayRelationships {
+			using, _ := rel.Using.(metadata.ArrRelUsing)
+
+			if using.ForeignKeyConstraintOn != nil {
+				table.relationships[rel.Name] = tableNameOf(using.ForeignKeyConstraintOn.Table)
+			}
+
+			if using.ManualConfiguration != nil {
+				table.relationships[rel.Name] = tableNameOf(using.ManualConfiguration.RemoteTable)
+			}
+		}
+
+		v.tables[tableName] = table
+	}
+
+	return v, nil
+}
+
+// referencedTable returns the table a foreign key column points to.
+func referencedTable(table *schema.Table, column string) string {
+	if table == nil {
+		return ""
+	}
+
+	for _, fk := range table.ForeignKeys {
+		for _, c := range fk.Columns {
+			if c.Name == column && fk.RefTable != nil {
+				return fk.RefTable.Name
+			}
+		}
+	}
+
+	return ""
+}
+
+func (v *validator) fail(node *gen.Type, role, operation, path, format string, args ...interface{}) {
+	v.errs = append(v.errs, &ValidationError{
+		Node:      node.Name,
+		Role:      role,
+		Operation: operation,
+		Path:      path,
+		Message:   fmt.Sprintf(format, args...),
+	})
+}
+
+func (v *validator) validatePermission(node *gen.Type, role, operation string, permission map[string]interface{}) {
+	table := v.tables[node.Table()]
+	if table == nil {
+		v.fail(node, role, operation, node.Table(), "table is not generated")
+		return
+	}
+
+	for _, key := range []string{"filter", "check"} {
+		if exp, isOk := permission[key].(map[string]interface{}); isOk {
+			v.validateBoolExp(node, role, operation, key, node.Table(), exp)
+		}
+	}
+
+	if set, isOk := permission["set"].(map[string]interface{}); isOk {
+		for _, column := range sortedKeys(set) {
+			if !table.columns[column] {
+				v.fail(node, role, operation, "set."+column, "%s", table.unknownColumn(column, node.Table()))
+			}
+		}
+	}
+
+	if columns, isOk := permission["columns"].([]interface{}); isOk {
+		for i, column := range columns {
+			name, _ := column.(string)
+			if !table.columns[name] {
+				v.fail(node, role, operation, fmt.Sprintf("columns[%d]", i), "%s", table.unknownColumn(name, node.Table()))
+			}
+		}
+	}
+}
+
+// unknownColumn describes a name that is not a column of the table, pointing to the column when the
+// name is a custom GraphQL name.
+func (t *validatedTable) unknownColumn(name, tableName string) string {
+	if column, isOk := t.customNames[name]; isOk {
+		return fmt.Sprintf("%q is the GraphQL name of the column %q of %s, permissions take the column name", name, column, tableName)
+	}
+
+	return fmt.Sprintf("unknown column %q of %s", name, tableName)
+}
+
+func (v *validator) validateBoolExp(node *gen.Type, role, operation, path, tableName string, exp map[string]interface{}) {
+	table := v.tables[tableName]
+	if table == nil {
+		v.fail(node, role, operation, path, "unknown table %q", tableName)
+		return
+	}
+
+	for _, key := range sortedKeys(exp) {
+		value := exp[key]
+		keyPath := path + "." + key
+
+		switch key {
+		case "_and", "_or":
+			exps, isOk := value.([]interface{})
+			if !isOk {
+				v.fail(node, role, operation, keyPath, "expected a list of expressions")
+				continue
+			}
+
+			for i, item := range exps {
+				if itemExp, isOk := item.(map[string]interface{}); isOk {
+					v.validateBoolExp(node, role, operation, fmt.Sprintf("%s[%d]", keyPath, i), tableName, itemExp)
+				}
+			}
+		case "_not":
+			if notExp, isOk := value.(map[string]interface{}); isOk {
+				v.validateBoolExp(node, role, operation, keyPath, tableName, notExp)
+			}
+		case "_exists":
+			v.validateExists(node, role, operation, keyPath, value)
+		default:
+			if strings.HasPrefix(key, "_") {
+				v.fail(node, role, operation, keyPath, "operator %s must be applied to a column", key)
+				continue
+			}
+
+			if target, isOk := table.relationships[key]; isOk {
+				if relExp, isOk := value.(map[string]interface{}); isOk {
+					v.validateBoolExp(node, role, operation, keyPath, target, relExp)
+				}
+				continue
+			}
+
+			if !table.columns[key] {
+				if _, isOk := table.customNames[key]; isOk {
+					v.fail(node, role, operation, keyPath, "%s", table.unknownColumn(key, tableName))
+					continue
+				}
+
+				v.fail(node, role, operation, keyPath, "unknown column or relationship of %s", tableName)
+				continue
+			}
+
+			ops, isOk := value.(map[string]interface{})
+			if !isOk {
+				v.fail(node, role, operation, keyPath, "expected comparison operators")
+				continue
+			}
+
+			for _, op := range sortedKeys(ops) {
+				if !strings.HasPrefix(op, "_") {
+					v.fail(node, role, operation, keyPath+"."+op, "%s is a column, not a relationship", key)
+				}
+			}
+		}
+	}
+}
+
+func (v *validator) validateExists(node *gen.Type, role, operation, path string, value interface{}) {
+	exists, isOk := value.(map[string]interface{})
+	if !isOk {
+		v.fail(node, role, operation, path, "expected _table and _where")
+		return
+	}
+
+	tableName, schemaName := "", ""
+	switch table := exists["_table"].(type) {
+	case string:
+		tableName = table
+	case map[string]interface{}:
+		tableName, _ = table["name"].(string)
+		schemaName, _ = table["schema"].(string)
+	}
+
+	if tableName == "" {
+		v.fail(node, role, operation, path+"._table", "expected a table name")
+		return
+	}
+
+	// a table outside the ent graph has no known columns, its expression is left to the engine
+	table := v.tables[tableName]
+	if table == nil || (schemaName != "" && schemaName != table.schema) {
+		return
+	}
+
+	where, _ := exists["_where"].(map[string]interface{})
+	v.validateBoolExp(node, role, operation, path+"._where", tableName, where)
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
@@ -0,0 +1,201 @@
+package enthasura_test
+
+import (
+	"strings"
+	"testing"
+
+	"entgo.io/ent"
+	"entgo.io/ent/schema"
+	"entgo.io/ent/schema/edge"
+	"entgo.io/ent/schema/field"
+	enthasura "github.com/minskylab/ent-hasura"
+)
+
+// Author and Post are the schema of the validator tests, the permission of Post is set per test.
+type Author struct {
+	ent.Schema
+}
+
+func (Author) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("name"),
+	}
+}
+
+func (Author) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.To("posts", Post.Type),
+	}
+}
+
+type Post struct {
+	ent.Schema
+	permission enthasura.PermissionsRoleAnnotation
+}
+
+func (Post) Fields() []ent.Field {
+	return []ent.Field{
+		field.String("title"),
+		field.Time("created_at"),
+	}
+}
+
+func (Post) Edges() []ent.Edge {
+	return []ent.Edge{
+		edge.From("author", Author.Type).Ref("posts").Unique(),
+	}
+}
+
+func (p Post) Annotations() []schema.Annotation {
+	return []schema.Annotation{p.permission}
+}
+
+func TestValidatePermissions(t *testing.T) {
+	tests := []struct {
+		name       string
+		permission *enthasura.SelectPermission
+		set        map[string]interface{}
+		wantPaths  []string
+	}{
+		{
+			name: "valid",
+			permission: &enthasura.SelectPermission{
+				Columns: enthasura.Columns("id", "title", "created_at"),
+				Filter:  enthasura.And(enthasura.Field("created_at", enthasura.IsNull(false)), enthasura.Field("author.name", enthasura.Eq("x"))),
+			},
+		},
+		{
+			name: "camelCase column",
+			permission: &enthasura.SelectPermission{
+				Columns: enthasura.Columns("createdAt"),
+				Filter:  enthasura.Field("createdAt", enthasura.IsNull(false)),
+			},
+			wantPaths: []string{"filter.createdAt", "columns[0]"},
+		},
+		{
+			name: "unknown column",
+			permission: &enthasura.SelectPermission{
+				Columns: enthasura.Columns("id", "body"),
+				Filter:  enthasura.Or(enthasura.Field("body", enthasura.Eq("x")), enthasura.Not(enthasura.Field("author.email", enthasura.Eq("x")))),
+			},
+			wantPaths: []string{"filter._or[0].body", "filter._or[1]._not.author.email", "columns[1]"},
+		},
+		{
+			name: "unknown relationship",
+			permission: &enthasura.SelectPermission{
+				Columns: enthasura.Columns("id"),
+				Filter:  enthasura.Field("editor.id", enthasura.Eq(enthasura.XHasuraUserID)),
+			},
+			wantPaths: []string{"filter.editor"},
+		},
+		{
+			name: "column used as relationship",
+			permission: &enthasura.SelectPermission{
+				Columns: enthasura.Columns("id"),
+				Filter:  enthasura.Field("title.id", enthasura.Eq(1)),
+			},
+			wantPaths: []string{"filter.title.id"},
+		},
+		{
+			name: "exists",
+			permission: &enthasura.SelectPermission{
+				Columns: enthasura.Columns("id"),
+				Filter:  enthasura.Exists("public", "authors", enthasura.Field("posts.title", enthasura.Eq("x"))),
+			},
+		},
+		{
+			name: "exists with unknown column",
+			permission: &enthasura.SelectPermission{
+				Columns: enthasura.Columns("id"),
+				Filter:  enthasura.Exists("public", "authors", enthasura.Field("email", enthasura.Eq("x"))),
+			},
+			wantPaths: []string{"filter._exists._where.email"},
+		},
+		{
+			name: "exists on a table outside the graph",
+			permission: &enthasura.SelectPermission{
+				Columns: enthasura.Columns("id"),
+				Filter:  enthasura.Exists("public", "editors", enthasura.Field("user_id", enthasura.Eq(enthasura.XHasuraUserID))),
+			},
+		},
+		{
+			name: "exists on a table of another schema",
+			permission: &enthasura.SelectPermission{
+				Columns: enthasura.Columns("id"),
+				Filter:  enthasura.Exists("audit", "authors", enthasura.Field("email", enthasura.Eq("x"))),
+			},
+		},
+		{
+			name: "exists without a table",
+			permission: &enthasura.SelectPermission{
+				Columns: enthasura.Columns("id"),
+				Filter:  enthasura.Exists("public", "", enthasura.Field("id", enthasura.Eq(1))),
+			},
+			wantPaths: []string{"filter._exists._table"},
+		},
+		{
+			name: "exists with GraphQL name",
+			permission: &enthasura.SelectPermission{
+				Columns: enthasura.Columns("id"),
+				Filter:  enthasura.Exists("public", "posts", enthasura.Field("createdAt", enthasura.IsNull(false))),
+			},
+			wantPaths: []string{"filter._exists._where.createdAt"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+
+		t.Run(test.name, func(t *testing.T) {
+			post := Post{permission: enthasura.PermissionsRoleAnnotation{Role: "user", SelectPermission: test.permission}}
+
+			_, err := enthasura.BuildMetadata(loadGraph(t, Author{}, post))
+
+			assertValidationPaths(t, err, test.wantPaths)
+		})
+	}
+}
+
+func TestValidatePresetColumns(t *testing.T) {
+	post := Post{permission: enthasura.PermissionsRoleAnnotation{
+		Role: "user",
+		InsertPermission: &enthasura.InsertPermission{
+			Columns: enthasura.Columns("title"),
+			Check:   enthasura.M{},
+			Set:     map[string]interface{}{"created_at": "now()", "createdAt": "now()"},
+		},
+	}}
+
+	_, err := enthasura.BuildMetadata(loadGraph(t, Author{}, post))
+
+	assertValidationPaths(t, err, []string{"set.createdAt"})
+
+	if err != nil && !strings.Contains(err.Error(), `GraphQL name of the column "created_at"`) {
+		t.Errorf("error does not point to the column: %s", err)
+	}
+}
+
+func assertValidationPaths(t *testing.T, err error, wantPaths []string) {
+	t.Helper()
+
+	if len(wantPaths) == 0 {
+		if err != nil {
+			t.Fatalf("unexpected error: %+v", err)
+		}
+		return
+	}
+
+	errs, isOk := err.(enthasura.ValidationErrors)
+	if !isOk {
+		t.Fatalf("got %#v, want validation errors at %v", err, wantPaths)
+	}
+
+	paths := []string{}
+	for _, e := range errs {
+		paths = append(paths, e.Path)
+	}
+
+	if strings.Join(paths, " ") != strings.Join(wantPaths, " ") {
+		t.Errorf("got errors at %v, want %v:\n%s", paths, wantPaths, err)
+	}
+}